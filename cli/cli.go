@@ -10,18 +10,25 @@ import (
 	"github.com/sigrunnr/tmuxai/config"
 	"github.com/sigrunnr/tmuxai/internal"
 	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
 	"github.com/spf13/cobra"
 )
 
 var (
 	initMessage  string
 	taskFileFlag string
+	dryRunFlag   bool
+	chatFlag     bool
 )
 
+// defaultStdinQuestion is asked when input is piped without a message
+const defaultStdinQuestion = "Explain the provided input, point out errors and how to fix them."
+
 var rootCmd = &cobra.Command{
 	Use:   "tmuxai [request message]",
 	Short: "TmuxAI - AI-Powered Tmux Companion",
 	Long:  `TmuxAI - AI-Powered Tmux Companion`,
+	Args:  cobra.ArbitraryArgs,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		if v, _ := cmd.Flags().GetBool("version"); v {
 			fmt.Printf("tmuxai version: %s\ncommit: %s\nbuild date: %s\n", internal.Version, internal.Commit, internal.Date)
@@ -40,22 +47,71 @@ var rootCmd = &cobra.Command{
 			initMessage = strings.Join(args, " ")
 		}
 
+		var task *internal.Task
 		if taskFileFlag != "" {
-			content, err := os.ReadFile(taskFileFlag)
+			task, err = internal.LoadTask(taskFileFlag)
+			if err == nil {
+				initMessage, err = task.Render(nil)
+			}
 			if err != nil {
 				logger.Error("Error reading task file: %v", err)
 				fmt.Fprintf(os.Stderr, "Error reading task file: %v\n", err)
 				os.Exit(1)
 			}
-			initMessage = string(content)
 			logger.Info("Read request from file: %s", taskFileFlag)
 		}
+		applyTask := func(mgr *internal.Manager) error {
+			if task == nil {
+				return nil
+			}
+			return mgr.ApplyTask(task)
+		}
+
+		// piped input is answered once, like `tmuxai ask`, unless the chat is requested
+		if internal.StdinIsPiped() && !chatFlag {
+			if initMessage == "" {
+				initMessage = defaultStdinQuestion
+			}
+			os.Exit(runOneShot(initMessage, true, applyTask))
+		}
+
+		var stdinContent string
+		var stdinTotal int
+		if internal.StdinIsPiped() {
+			if _, err := system.TmuxCurrentPaneId(); err != nil {
+				fmt.Fprintln(os.Stderr, "--chat with piped input must be run inside tmux")
+				os.Exit(1)
+			}
+			stdinContent, stdinTotal, err = internal.ReadStdin(os.Stdin, cfg.MaxStdinSize)
+			if err != nil {
+				logger.Error("Error reading stdin: %v", err)
+				fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+				os.Exit(1)
+			}
+			if err := internal.AttachTerminal(); err != nil {
+				logger.Error("internal.AttachTerminal failed: %v", err)
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		}
 
 		mgr, err := internal.NewManager(cfg)
 		if err != nil {
 			logger.Error("manager.NewManager failed: %v", err)
 			os.Exit(1)
 		}
+		mgr.PlanMode = dryRunFlag
+		if err := applyTask(mgr); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if stdinTotal > 0 {
+			mgr.SetStdinContext(stdinContent, stdinTotal)
+		}
+		if err := startRecording(mgr); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
 		if initMessage != "" {
 			logger.Info("Starting with initial subcommand: %s", initMessage)
 		}
@@ -68,7 +124,12 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&taskFileFlag, "file", "f", "", "Read request from specified file")
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.Flags().StringVarP(&taskFileFlag, "file", "f", "", "Read request from specified file or task file, parameters get their defaults")
+	rootCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Start in plan mode: actions are printed and collected, never sent to panes")
+	rootCmd.Flags().BoolVar(&chatFlag, "chat", false, "Open the chat with piped input as context instead of answering once")
+	addOutputFlag(rootCmd)
+	addRecordFlag(rootCmd)
 	rootCmd.Flags().BoolP("version", "v", false, "Print version information")
 }
 
@@ -0,0 +1,122 @@
+// ctl.go: Client for the control API of a running TmuxAI instance
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sigrunnr/tmuxai/internal"
+	"github.com/sigrunnr/tmuxai/system"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ctlSocketFlag string
+	ctlTargetFlag string
+	ctlNoWaitFlag bool
+	ctlLimitFlag  int
+)
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Control the TmuxAI instance running in a tmux window",
+	Long: `Control the TmuxAI instance running in a tmux window through its Unix socket.
+Results are printed as JSON. By default the instance of the current window is used.`,
+}
+
+func init() {
+	ctlCmd.PersistentFlags().StringVar(&ctlSocketFlag, "socket", "", "Control socket path")
+	ctlCmd.PersistentFlags().StringVarP(&ctlTargetFlag, "target", "t", "", "A pane in the window of the instance (e.g. %3), defaults to the current pane")
+
+	sendCmd := ctlMethodCommand("send <message>", "Send a message to the AI", "send_message", cobra.MinimumNArgs(1),
+		func(args []string) any {
+			return map[string]any{"message": strings.Join(args, " "), "wait": !ctlNoWaitFlag}
+		})
+	sendCmd.Flags().BoolVar(&ctlNoWaitFlag, "no-wait", false, "Return once the message is queued")
+
+	commandCmd := ctlMethodCommand("command </command>", "Run a slash command, e.g. /squash", "command", cobra.MinimumNArgs(1),
+		func(args []string) any {
+			return map[string]any{"command": strings.Join(args, " "), "wait": !ctlNoWaitFlag}
+		})
+	commandCmd.Flags().BoolVar(&ctlNoWaitFlag, "no-wait", false, "Return once the command is queued")
+
+	messagesCmd := ctlMethodCommand("messages", "Print the chat history", "messages", cobra.NoArgs,
+		func(args []string) any { return map[string]any{"limit": ctlLimitFlag} })
+	messagesCmd.Flags().IntVar(&ctlLimitFlag, "limit", 0, "Print only the last n messages")
+
+	ctlCmd.AddCommand(
+		sendCmd,
+		commandCmd,
+		messagesCmd,
+		ctlMethodCommand("status", "Print the status of the instance", "status", cobra.NoArgs, nil),
+		ctlMethodCommand("history", "Print the commands run in the prepared exec pane", "exec_history", cobra.NoArgs, nil),
+		ctlMethodCommand("watch <description>", "Start watch mode", "watch_start", cobra.MinimumNArgs(1),
+			func(args []string) any { return map[string]any{"description": strings.Join(args, " ")} }),
+		ctlMethodCommand("unwatch", "Stop watch mode", "watch_stop", cobra.NoArgs, nil),
+		&cobra.Command{
+			Use:   "subscribe",
+			Short: "Stream events as JSON lines",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				err := internal.ControlSubscribe(ctlSocketPath(), func(event internal.Event) {
+					internal.WriteJSON(os.Stdout, event)
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+			},
+		},
+	)
+	rootCmd.AddCommand(ctlCmd)
+}
+
+// ctlMethodCommand creates a subcommand calling a control API method and printing its result
+func ctlMethodCommand(use, short, method string, args cobra.PositionalArgs, params func(args []string) any) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  args,
+		Run: func(cmd *cobra.Command, args []string) {
+			var p any
+			if params != nil {
+				p = params(args)
+			}
+			result, err := internal.ControlCall(ctlSocketPath(), method, p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			var out bytes.Buffer
+			if err := json.Indent(&out, result, "", "  "); err != nil {
+				out.Write(result)
+			}
+			fmt.Println(out.String())
+		},
+	}
+}
+
+// ctlSocketPath returns the socket of the instance to control
+func ctlSocketPath() string {
+	if ctlSocketFlag != "" {
+		return ctlSocketFlag
+	}
+	paneId := ctlTargetFlag
+	if paneId == "" {
+		var err error
+		if paneId, err = system.TmuxCurrentPaneId(); err != nil {
+			fmt.Fprintln(os.Stderr, "Not inside tmux, use --target or --socket to choose the instance")
+			os.Exit(1)
+		}
+	}
+	path, err := internal.ControlSocketPath(paneId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	return path
+}
@@ -0,0 +1,70 @@
+// dev.go: Development tools, like a fake LLM to try prompts without a real model
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/sigrunnr/tmuxai/internal/fakellm"
+	"github.com/spf13/cobra"
+)
+
+var fakeLLMListen string
+
+var devCmd = &cobra.Command{
+	Use:    "dev",
+	Short:  "Tools for developing TmuxAI",
+	Hidden: true,
+}
+
+var fakeLLMCmd = &cobra.Command{
+	Use:   "fake-llm <script.yaml>",
+	Short: "Serve scripted responses as an OpenAI compatible API",
+	Long: `Serve scripted responses as an OpenAI compatible chat completions API.
+Each request gets the first response of the script whose turn is the request
+number and whose match regexp matches the last user message. Responses without
+turn and match are sent once each, in order. Point openrouter.base_url to the
+printed URL to run tmuxai against the script:
+
+  responses:
+    - turn: 1
+      content: <ExecCommand>ls</ExecCommand>
+    - match: 'README'
+      content: |
+        Done.
+        <RequestAccomplished>1</RequestAccomplished>`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		script, err := fakellm.LoadScript(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		llm, err := fakellm.NewServer(script)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		listener, err := net.Listen("tcp", fakeLLMListen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Serving %d scripted responses, set the base URL:\n", len(script.Responses))
+		fmt.Printf("  TMUXAI_OPENROUTER_BASE_URL=http://%s/v1\n", listener.Addr())
+		if err := http.Serve(listener, llm); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	fakeLLMCmd.Flags().StringVar(&fakeLLMListen, "listen", "127.0.0.1:8089", "address to listen on")
+	devCmd.AddCommand(fakeLLMCmd)
+	rootCmd.AddCommand(devCmd)
+}
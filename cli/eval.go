@@ -0,0 +1,140 @@
+// eval.go: Evaluation of models over the task library
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	evalModelFlags  []string
+	evalBackendFlag string
+	evalParamFlags  []string
+	evalTimeoutFlag time.Duration
+	evalKeepFlag    bool
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval [task...]",
+	Short: "Run tasks with one or more models and compare the results",
+	Long: `Run tasks with one or more models and compare the results. Each run gets a new
+directory and a new tmux session whose pane is the exec pane, or with --backend fake
+a simulated pane whose commands run with sh. Commands are not confirmed, the
+blacklist of the config and of the task still applies.
+
+A run succeeds when the check of the task passes, or for tasks without a check when
+the request is accomplished. Without task names all tasks with a check are run,
+without --model the model of the config. Exit code 1 when a run did not succeed.
+
+  tmuxai eval git-commit dns-bench --model openai/gpt-4.1 --model anthropic/claude-sonnet-4`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if outputFlag != outputText && outputFlag != outputJSON && outputFlag != outputJSONL {
+			fmt.Fprintf(os.Stderr, "Unknown output format %q, use text, json or jsonl\n", outputFlag)
+			os.Exit(1)
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		if cfg.OpenRouter.APIKey == "" {
+			fmt.Fprintln(os.Stderr, "OpenRouter API key is required. Set it in the config file or as an environment variable: TMUXAI_OPENROUTER_API_KEY")
+			os.Exit(1)
+		}
+
+		opts := internal.EvalOptions{
+			Models:  evalModelFlags,
+			Backend: evalBackendFlag,
+			Timeout: evalTimeoutFlag,
+			Keep:    evalKeepFlag,
+			Params:  make(map[string]string),
+		}
+		if len(opts.Models) == 0 {
+			opts.Models = []string{cfg.OpenRouter.Model}
+		}
+		for _, param := range evalParamFlags {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok {
+				fmt.Fprintf(os.Stderr, "invalid --param %q, use name=value\n", param)
+				os.Exit(1)
+			}
+			opts.Params[name] = value
+		}
+		if opts.Tasks, err = evalTasks(args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		// keep stdout for the results, the output of the runs goes to stderr
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+		opts.Progress = func(run internal.EvalRun) {
+			if outputFlag == outputJSONL {
+				internal.WriteJSON(stdout, run)
+			}
+			fmt.Fprintf(os.Stderr, "%s with %s: %s, check %s, %d steps\n", run.Task, run.Model, run.Status, run.Check, run.Steps)
+		}
+		report := internal.RunEval(cfg, opts)
+		os.Stdout = stdout
+
+		switch outputFlag {
+		case outputText:
+			report.WriteTable(os.Stdout)
+		default:
+			internal.WriteJSON(os.Stdout, report)
+		}
+		for _, run := range report.Runs {
+			if !run.Success {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// evalTasks finds the named tasks, or returns all tasks with a check
+func evalTasks(names []string) ([]*internal.Task, error) {
+	var tasks []*internal.Task
+	for _, name := range names {
+		task, err := internal.FindTask(name)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if len(names) > 0 {
+		return tasks, nil
+	}
+
+	all, errs := internal.ListTasks()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	for _, task := range all {
+		if task.Check != nil {
+			tasks = append(tasks, task)
+		}
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no tasks with a check found in %s", strings.Join(internal.TaskDirs(), ", "))
+	}
+	return tasks, nil
+}
+
+func init() {
+	evalCmd.Flags().StringArrayVarP(&evalModelFlags, "model", "m", nil, "Model to evaluate, can be repeated")
+	evalCmd.Flags().StringVar(&evalBackendFlag, "backend", internal.EvalTmux, "Where the tasks run: tmux or fake")
+	evalCmd.Flags().StringArrayVar(&evalParamFlags, "param", nil, "Task parameter as name=value for the tasks that declare it, can be repeated")
+	evalCmd.Flags().DurationVar(&evalTimeoutFlag, "timeout", 10*time.Minute, "Time limit of each run")
+	evalCmd.Flags().BoolVar(&evalKeepFlag, "keep", false, "Keep the directories and tmux sessions of the runs")
+	addOutputFlag(evalCmd)
+	rootCmd.AddCommand(evalCmd)
+}
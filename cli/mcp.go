@@ -0,0 +1,47 @@
+// mcp.go: Model Context Protocol server exposing tmux panes as tools
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/internal"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/spf13/cobra"
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Run a Model Context Protocol server over stdio",
+	Long: `Run a Model Context Protocol server over stdio exposing tmux panes as tools:
+list_panes, capture_pane, send_keys, run_command and exec_wait_capture.
+Actions follow the whitelist, blacklist and confirmation settings. Actions that
+need a confirmation are denied.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		if err != nil {
+			logger.Error("Error loading configuration: %v", err)
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		// stdout carries the protocol, anything else goes to stderr
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+
+		logger.Info("Starting MCP server")
+		if err := internal.NewMCPServer(cfg).Serve(os.Stdin, stdout); err != nil {
+			logger.Error("MCP server failed: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+}
@@ -0,0 +1,173 @@
+// oneshot.go: Non-interactive ask and run commands for scripting
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/internal"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paneFlag        string
+	interactiveFlag bool
+	outputFlag      string
+	recordFlag      string
+)
+
+// Output formats of the non-interactive commands
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+)
+
+var askCmd = &cobra.Command{
+	Use:   "ask <question>",
+	Short: "Answer a question about the panes once and print the answer",
+	Long: `Answer a question about the panes once and print the answer to stdout.
+Nothing is sent to panes. Exit codes: 0 accomplished, 1 failed, 2 waiting for user.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runOneShot(strings.Join(args, " "), true, nil))
+	},
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run <task>",
+	Short: "Run a task once in the exec pane and print the final message",
+	Long: `Run the agent loop once against the exec pane and print the final message to stdout.
+Actions that need confirmation are declined unless --interactive is passed.
+Exit codes: 0 accomplished, 1 failed, 2 waiting for user.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runOneShot(strings.Join(args, " "), false, nil))
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{askCmd, runCmd} {
+		cmd.Flags().StringVarP(&paneFlag, "pane", "p", "", "Pane to work with (e.g. %3), defaults to another pane of the current window")
+		cmd.Flags().BoolVarP(&interactiveFlag, "interactive", "i", false, "Prompt for confirmations instead of declining them")
+		addOutputFlag(cmd)
+		addRecordFlag(cmd)
+		rootCmd.AddCommand(cmd)
+	}
+}
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", outputText, "Output format of one-shot requests: text, json or jsonl")
+}
+
+func addRecordFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&recordFlag, "record", "", "Record the session to a file for tmuxai replay")
+}
+
+// startRecording records the session when --record is passed
+func startRecording(mgr *internal.Manager) error {
+	if recordFlag == "" {
+		return nil
+	}
+	return mgr.StartRecording(recordFlag)
+}
+
+// runOneShot runs a single request and returns the process exit code.
+// setup, if set, prepares the manager before the request is sent.
+func runOneShot(message string, readOnly bool, setup func(*internal.Manager) error) int {
+	if outputFlag != outputText && outputFlag != outputJSON && outputFlag != outputJSONL {
+		fmt.Fprintf(os.Stderr, "Unknown output format %q, use text, json or jsonl\n", outputFlag)
+		return 1
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("Error loading configuration: %v", err)
+		return oneShotError(fmt.Errorf("error loading configuration: %w", err))
+	}
+
+	mgr, err := internal.NewHeadlessManager(cfg, paneFlag, readOnly)
+	if err != nil {
+		logger.Error("internal.NewHeadlessManager failed: %v", err)
+		return oneShotError(err)
+	}
+	mgr.Interactive = interactiveFlag
+	if setup != nil {
+		if err := setup(mgr); err != nil {
+			return oneShotError(err)
+		}
+	}
+	if err := attachStdinContext(mgr); err != nil {
+		return oneShotError(err)
+	}
+	if err := startRecording(mgr); err != nil {
+		return oneShotError(err)
+	}
+
+	// keep stdout for the final message, progress goes to stderr
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	color.Output = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	var steps []internal.StepRecord
+	switch outputFlag {
+	case outputJSON:
+		mgr.StepHandler = func(step internal.StepRecord) { steps = append(steps, step) }
+	case outputJSONL:
+		mgr.StepHandler = func(step internal.StepRecord) { internal.WriteJSON(stdout, step) }
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	status := mgr.RunOnce(ctx, message)
+	logger.Info("One-shot request finished with status: %s", status)
+
+	if outputFlag != outputText {
+		internal.WriteJSON(stdout, mgr.NewRunReport(status, steps))
+	} else if mgr.LastMessage != "" {
+		fmt.Fprintln(stdout, mgr.LastMessage)
+	}
+	return status.ExitCode()
+}
+
+// oneShotError reports an error that happened before the request was sent
+func oneShotError(err error) int {
+	if outputFlag == outputText {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	} else {
+		internal.WriteJSON(os.Stdout, internal.RunReport{
+			Type:          "result",
+			SchemaVersion: internal.OutputSchemaVersion,
+			Status:        internal.RunFailed,
+			Error:         err.Error(),
+		})
+	}
+	return internal.RunFailed.ExitCode()
+}
+
+// attachStdinContext sends piped input to the AI together with the pane content
+func attachStdinContext(mgr *internal.Manager) error {
+	if !internal.StdinIsPiped() {
+		return nil
+	}
+	content, total, err := internal.ReadStdin(os.Stdin, mgr.Config.MaxStdinSize)
+	if err != nil {
+		logger.Error("Error reading stdin: %v", err)
+		return fmt.Errorf("error reading stdin: %w", err)
+	}
+	if total == 0 {
+		return nil
+	}
+	logger.Info("Read %d bytes of context from stdin", total)
+	mgr.SetStdinContext(content, total)
+	return nil
+}
@@ -0,0 +1,66 @@
+// replay.go: Replay of sessions recorded with --record
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayStepFlag   int
+	replayModelFlags []string
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <recording>",
+	Short: "Replay a session recorded with --record",
+	Long: `Replay a session recorded with --record. The requests of the user are processed
+again, tmux, the model, files, tools and confirmations answer as they did in the
+recording, nothing is sent anywhere. Requests to the model that differ from the
+recorded ones are reported, the exit code is 1 when the replay left the recording.
+
+With --step and --model the request to the model at that step is also sent to the
+given models with the API of the config, their responses are printed next to the
+recorded one:
+
+  tmuxai replay session.jsonl --step 3 --model anthropic/claude-sonnet-4 --model openai/gpt-4.1`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := internal.ReplayOptions{Step: replayStepFlag, Models: replayModelFlags, Out: os.Stdout}
+		if (opts.Step > 0) != (len(opts.Models) > 0) {
+			fmt.Fprintln(os.Stderr, "--step and --model are used together")
+			os.Exit(1)
+		}
+		if opts.Step > 0 {
+			cfg, err := config.Load()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+				os.Exit(1)
+			}
+			opts.API = &cfg.OpenRouter
+		}
+
+		result, err := internal.Replay(args[0], opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Replayed %d messages and %d requests to the model", result.Messages, result.Requests)
+		if len(result.Divergences) > 0 {
+			fmt.Printf(", %d differences to the recording\n", len(result.Divergences))
+			os.Exit(1)
+		}
+		fmt.Println(", no differences to the recording")
+	},
+}
+
+func init() {
+	replayCmd.Flags().IntVar(&replayStepFlag, "step", 0, "Request to the model to send again, counted from 1")
+	replayCmd.Flags().StringArrayVar(&replayModelFlags, "model", nil, "Model to send the request at --step to, can be repeated")
+	rootCmd.AddCommand(replayCmd)
+}
@@ -0,0 +1,142 @@
+// task.go: Task library commands to list, show and run task files
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sigrunnr/tmuxai/internal"
+	"github.com/spf13/cobra"
+)
+
+var taskParamFlags []string
+
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "List, show and run tasks of the task library",
+	Long: `List, show and run tasks of the task library. Tasks are searched in
+.tmuxai/tasks of the current directory, then in the tasks directory of the config dir.`,
+}
+
+var taskListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available tasks",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		tasks, errs := internal.ListTasks()
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Skipping %v\n", err)
+		}
+		if len(tasks) == 0 {
+			fmt.Printf("No tasks found in %s\n", strings.Join(internal.TaskDirs(), ", "))
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPE\tDESCRIPTION")
+		for _, task := range tasks {
+			scope := "global"
+			if task.Local {
+				scope = "project"
+			}
+			description := task.Description
+			if description == "" {
+				description, _, _ = strings.Cut(task.Prompt, "\n")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", task.Name, scope, description)
+		}
+		w.Flush()
+	},
+}
+
+var taskShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show the parameters, settings and prompt of a task",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		task, err := internal.FindTask(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Name:        %s\n", task.Name)
+		fmt.Printf("File:        %s\n", task.Path)
+		if task.Description != "" {
+			fmt.Printf("Description: %s\n", task.Description)
+		}
+		if task.Model != "" {
+			fmt.Printf("Model:       %s\n", task.Model)
+		}
+		if len(task.Tools) > 0 {
+			fmt.Printf("Tools:       %s\n", strings.Join(task.Tools, ", "))
+		}
+		if task.Policy.ReadOnly {
+			fmt.Println("Policy:      read only")
+		}
+		if task.Check != nil {
+			if task.Check.Command != "" {
+				fmt.Printf("Check:       %s exits 0\n", task.Check.Command)
+			}
+			if task.Check.PaneRegex != "" {
+				fmt.Printf("Check:       pane matches /%s/\n", task.Check.PaneRegex)
+			}
+		}
+		if len(task.Params) > 0 {
+			fmt.Println("Parameters:")
+			for _, p := range task.Params {
+				detail := fmt.Sprintf("default %q", p.Default)
+				if p.Required {
+					detail = "required"
+				}
+				fmt.Printf("  %s (%s) %s\n", p.Name, detail, p.Description)
+			}
+		}
+		fmt.Printf("\n%s\n", task.Prompt)
+	},
+}
+
+var taskRunCmd = &cobra.Command{
+	Use:   "run <name>",
+	Short: "Run a task once in the exec pane and print the final message",
+	Long: `Run a task once in the exec pane and print the final message to stdout, like
+'tmuxai run'. Parameters are set with --param name=value.
+Exit codes: 0 accomplished, 1 failed, 2 waiting for user.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		task, err := internal.FindTask(args[0])
+		if err != nil {
+			os.Exit(oneShotError(err))
+		}
+		values := make(map[string]string)
+		for _, param := range taskParamFlags {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok {
+				os.Exit(oneShotError(fmt.Errorf("invalid --param %q, use name=value", param)))
+			}
+			values[name] = value
+		}
+		message, err := task.Render(values)
+		if err != nil {
+			os.Exit(oneShotError(fmt.Errorf("task %s: %w", task.Name, err)))
+		}
+
+		os.Exit(runOneShot(message, task.Policy.ReadOnly, func(mgr *internal.Manager) error {
+			return mgr.ApplyTask(task)
+		}))
+	},
+}
+
+func init() {
+	taskRunCmd.Flags().StringArrayVar(&taskParamFlags, "param", nil, "Task parameter as name=value, can be repeated")
+	taskRunCmd.Flags().StringVarP(&paneFlag, "pane", "p", "", "Pane to work with (e.g. %3), defaults to another pane of the current window")
+	taskRunCmd.Flags().BoolVarP(&interactiveFlag, "interactive", "i", false, "Prompt for confirmations instead of declining them")
+	addOutputFlag(taskRunCmd)
+	addRecordFlag(taskRunCmd)
+
+	taskCmd.AddCommand(taskListCmd, taskShowCmd, taskRunCmd)
+	rootCmd.AddCommand(taskCmd)
+}
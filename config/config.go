@@ -6,23 +6,87 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
-
-	"github.com/spf13/viper"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Debug                 bool             `mapstructure:"debug"`
-	MaxCaptureLines       int              `mapstructure:"max_capture_lines"`
-	MaxContextSize        int              `mapstructure:"max_context_size"`
-	WaitInterval          int              `mapstructure:"wait_interval"`
-	SendKeysConfirm       bool             `mapstructure:"send_keys_confirm"`
-	PasteMultilineConfirm bool             `mapstructure:"paste_multiline_confirm"`
-	ExecConfirm           bool             `mapstructure:"exec_confirm"`
-	WhitelistPatterns     []string         `mapstructure:"whitelist_patterns"`
-	BlacklistPatterns     []string         `mapstructure:"blacklist_patterns"`
-	OpenRouter            OpenRouterConfig `mapstructure:"openrouter"`
-	Prompts               PromptsConfig    `mapstructure:"prompts"`
+	Debug                 bool                       `mapstructure:"debug"`
+	MaxCaptureLines       int                        `mapstructure:"max_capture_lines"`
+	MaxContextSize        int                        `mapstructure:"max_context_size"`
+	MaxStdinSize          int                        `mapstructure:"max_stdin_size"`
+	VerifyAttempts        int                        `mapstructure:"verify_attempts"`
+	WaitInterval          int                        `mapstructure:"wait_interval"`
+	SendKeysConfirm       bool                       `mapstructure:"send_keys_confirm"`
+	PasteMultilineConfirm bool                       `mapstructure:"paste_multiline_confirm"`
+	ExecConfirm           bool                       `mapstructure:"exec_confirm"`
+	WhitelistPatterns     []string                   `mapstructure:"whitelist_patterns"`
+	BlacklistPatterns     []string                   `mapstructure:"blacklist_patterns"`
+	RedactPatterns        []string                   `mapstructure:"redact_patterns"`
+	RedactPanes           bool                       `mapstructure:"redact_panes"`
+	ControlSocket         bool                       `mapstructure:"control_socket"`
+	TmuxControlMode       bool                       `mapstructure:"tmux_control_mode"`
+	Capture               CaptureConfig              `mapstructure:"capture"`
+	Files                 FilesConfig                `mapstructure:"files"`
+	Limits                LimitsConfig               `mapstructure:"limits"`
+	Squash                SquashConfig               `mapstructure:"squash"`
+	Memory                MemoryConfig               `mapstructure:"memory"`
+	MCPServers            map[string]MCPServerConfig `mapstructure:"mcp_servers"`
+	Commands              map[string]CommandConfig   `mapstructure:"commands"`
+	OpenRouter            OpenRouterConfig           `mapstructure:"openrouter"`
+	Prompts               PromptsConfig              `mapstructure:"prompts"`
+	Layers                *Layers                    `mapstructure:"-" json:"-"` // where the values were loaded from, nil for DefaultConfig
+}
+
+// CaptureConfig controls how pane content is captured before it is sent to the AI
+type CaptureConfig struct {
+	Mode  string            `mapstructure:"mode"`  // plain or ansi
+	Panes map[string]string `mapstructure:"panes"` // per pane mode, keyed by pane id (%3) or current command (cargo)
+}
+
+// FilesConfig controls the ReadFile, WriteFile and ApplyPatch actions
+type FilesConfig struct {
+	Roots        []string `mapstructure:"roots"`         // allowed directories, the exec pane's directory if empty
+	ReadConfirm  bool     `mapstructure:"read_confirm"`  // confirm before reading files
+	WriteConfirm bool     `mapstructure:"write_confirm"` // confirm before writing files
+	MaxReadSize  int      `mapstructure:"max_read_size"` // maximum bytes of a file sent to the AI
+}
+
+// LimitsConfig bounds the agent loop of a request, 0 means no limit.
+// When a limit is reached the user can continue, adjust or abort the request.
+type LimitsConfig struct {
+	MaxSteps            int `mapstructure:"max_steps"`             // AI responses per request
+	MaxGuidelineRetries int `mapstructure:"max_guideline_retries"` // consecutive responses not following the guidelines
+	MaxDuration         int `mapstructure:"max_duration"`          // seconds per request
+	MaxTokens           int `mapstructure:"max_tokens"`            // tokens per request
+}
+
+// SquashConfig controls the summary of the chat history when the context grows too large
+type SquashConfig struct {
+	Model   string `mapstructure:"model"`   // model that summarizes, openrouter.model if empty
+	Timeout int    `mapstructure:"timeout"` // seconds to wait for the summary, 0 means no limit
+}
+
+// MemoryConfig controls the project memory file appended to the system prompt
+type MemoryConfig struct {
+	Files   []string `mapstructure:"files"`    // names looked up in the exec pane's directory, then the git root
+	MaxSize int      `mapstructure:"max_size"` // bytes of the file sent to the AI
+}
+
+// MCPServerConfig configures an MCP server whose tools are offered to the AI.
+// Either Command (stdio) or URL (streamable HTTP) is set.
+type MCPServerConfig struct {
+	Command     string            `mapstructure:"command"`
+	Args        []string          `mapstructure:"args"`
+	Env         map[string]string `mapstructure:"env"`
+	URL         string            `mapstructure:"url"`
+	Headers     map[string]string `mapstructure:"headers"`
+	AutoApprove []string          `mapstructure:"auto_approve"` // tools called without confirmation
+}
+
+// CommandConfig defines a user slash command, Prompt is a text/template
+type CommandConfig struct {
+	Description string `mapstructure:"description"`
+	Prompt      string `mapstructure:"prompt"`
 }
 
 // OpenRouterConfig holds OpenRouter API configuration
@@ -46,12 +110,44 @@ func DefaultConfig() *Config {
 		Debug:                 false,
 		MaxCaptureLines:       200,
 		MaxContextSize:        20000,
+		MaxStdinSize:          50000,
+		VerifyAttempts:        3,
 		WaitInterval:          5,
 		SendKeysConfirm:       true,
 		PasteMultilineConfirm: true,
 		ExecConfirm:           true,
 		WhitelistPatterns:     []string{},
 		BlacklistPatterns:     []string{},
+		RedactPatterns:        []string{},
+		RedactPanes:           true,
+		ControlSocket:         false,
+		TmuxControlMode:       false,
+		Capture: CaptureConfig{
+			Mode:  "plain",
+			Panes: map[string]string{},
+		},
+		Files: FilesConfig{
+			Roots:        []string{},
+			ReadConfirm:  false,
+			WriteConfirm: true,
+			MaxReadSize:  100000,
+		},
+		Limits: LimitsConfig{
+			MaxSteps:            30,
+			MaxGuidelineRetries: 3,
+			MaxDuration:         1800,
+			MaxTokens:           0,
+		},
+		Squash: SquashConfig{
+			Model:   "",
+			Timeout: 120,
+		},
+		Memory: MemoryConfig{
+			Files:   []string{".tmuxai.md", "AGENTS.md"},
+			MaxSize: 16000,
+		},
+		MCPServers: map[string]MCPServerConfig{},
+		Commands:   map[string]CommandConfig{},
 		OpenRouter: OpenRouterConfig{
 			BaseURL: "https://openrouter.ai/api/v1",
 			Model:   "google/gemini-2.5-flash-preview",
@@ -63,50 +159,11 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load loads the configuration from file or environment variables
+// Load loads the configuration for the current directory, see LoadFor. The session
+// layer is applied by the manager, which knows the tmux session through its backend.
 func Load() (*Config, error) {
-	config := DefaultConfig()
-
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
-	}
-
-	viper.AddConfigPath(".")
-
-	configDir, err := GetConfigDir()
-	if err == nil {
-		viper.AddConfigPath(configDir)
-	} else {
-		viper.AddConfigPath(filepath.Join(homeDir, ".config", "tmuxai"))
-	}
-
-	// Environment variables
-	viper.SetEnvPrefix("TMUXAI")
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
-	// Automatically bind all config keys to environment variables
-	configType := reflect.TypeOf(*config)
-	for _, key := range EnumerateConfigKeys(configType, "") {
-		viper.BindEnv(key)
-	}
-
-	viper.AutomaticEnv()
-
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("failed to read config file: %w", err)
-		}
-	}
-
-	if err := viper.Unmarshal(config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
-	}
-
-	return config, nil
+	dir, _ := os.Getwd()
+	return LoadFor(dir, "")
 }
 
 // EnumerateConfigKeys returns all config keys (dot notation) for the given struct type.
@@ -115,6 +172,9 @@ func EnumerateConfigKeys(cfgType reflect.Type, prefix string) []string {
 	for i := 0; i < cfgType.NumField(); i++ {
 		field := cfgType.Field(i)
 		tag := field.Tag.Get("mapstructure")
+		if tag == "-" {
+			continue
+		}
 		if tag == "" {
 			tag = strings.ToLower(field.Name)
 		}
@@ -150,65 +210,3 @@ func GetConfigFilePath(filename string) string {
 	configDir, _ := GetConfigDir()
 	return filepath.Join(configDir, filename)
 }
-
-func TryInferType(key, value string) any {
-	var typedValue any = value
-	// Only basic type inference for bool/int/string
-	for i := 0; i < reflect.TypeOf(Config{}).NumField(); i++ {
-		field := reflect.TypeOf(Config{}).Field(i)
-		tag := field.Tag.Get("mapstructure")
-		if tag == "" {
-			tag = strings.ToLower(field.Name)
-		}
-		// Support dot notation for nested fields
-		fullKey := tag
-		if key == fullKey {
-			switch field.Type.Kind() {
-			case reflect.Bool:
-				if value == "true" {
-					typedValue = true
-				} else if value == "false" {
-					typedValue = false
-				}
-			case reflect.Int, reflect.Int64, reflect.Int32:
-				var intVal int
-				_, err := fmt.Sscanf(value, "%d", &intVal)
-				if err == nil {
-					typedValue = intVal
-				}
-			}
-		}
-		// Nested struct support
-		if field.Type.Kind() == reflect.Struct {
-			nestedType := field.Type
-			prefix := tag + "."
-			if strings.HasPrefix(key, prefix) {
-				nestedKey := key[len(prefix):]
-				for j := 0; j < nestedType.NumField(); j++ {
-					nf := nestedType.Field(j)
-					ntag := nf.Tag.Get("mapstructure")
-					if ntag == "" {
-						ntag = strings.ToLower(nf.Name)
-					}
-					if ntag == nestedKey {
-						switch nf.Type.Kind() {
-						case reflect.Bool:
-							if value == "true" {
-								typedValue = true
-							} else if value == "false" {
-								typedValue = false
-							}
-						case reflect.Int, reflect.Int64, reflect.Int32:
-							var intVal int
-							_, err := fmt.Sscanf(value, "%d", &intVal)
-							if err == nil {
-								typedValue = intVal
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	return typedValue
-}
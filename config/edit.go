@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+// Keys returns the keys of the config in dot notation
+func Keys() []string {
+	return EnumerateConfigKeys(reflect.TypeOf(Config{}), "")
+}
+
+// Get returns the value of a key in dot notation. Keys below a map name its entries,
+// like mcp_servers.db.command or capture.panes.%3.
+func Get(cfg *Config, key string) (any, error) {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, name := range strings.Split(key, ".") {
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByTag(v, name)
+			if !ok {
+				return nil, fmt.Errorf("unknown config key %s", key)
+			}
+			v = field
+		case reflect.Map:
+			v = v.MapIndex(reflect.ValueOf(name))
+			if !v.IsValid() {
+				return nil, fmt.Errorf("%s is not set", key)
+			}
+		default:
+			return nil, fmt.Errorf("unknown config key %s", key)
+		}
+	}
+	return v.Interface(), nil
+}
+
+// Set sets the value of a key in dot notation. The value is converted to the type of the key
+// like values of a config file: "300" to an int, a single value to a list, a map to a section.
+func Set(cfg *Config, key string, value any) error {
+	return setPath(reflect.ValueOf(cfg).Elem(), strings.Split(key, "."), value, key)
+}
+
+func setPath(v reflect.Value, path []string, value any, key string) error {
+	if len(path) == 0 {
+		target := reflect.New(v.Type())
+		if err := mapstructure.WeakDecode(value, target.Interface()); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.Set(target.Elem())
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := fieldByTag(v, path[0])
+		if !ok {
+			return fmt.Errorf("unknown config key %s", key)
+		}
+		return setPath(field, path[1:], value, key)
+	case reflect.Map:
+		// map entries aren't addressable, the entry is set on a copy and stored again
+		name := reflect.ValueOf(path[0])
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(name); existing.IsValid() {
+			elem.Set(existing)
+		}
+		if err := setPath(elem, path[1:], value, key); err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(name, elem)
+		return nil
+	}
+	return fmt.Errorf("unknown config key %s", key)
+}
+
+// Delete removes the entry of a map named by a key, like capture.panes.%3
+func Delete(cfg *Config, key string) error {
+	parent, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		parent, name = key[:i], key[i+1:]
+	}
+	if parent == "" {
+		return fmt.Errorf("%s is not an entry of a map", key)
+	}
+	value, err := Get(cfg, parent)
+	if err != nil {
+		return err
+	}
+	m := reflect.ValueOf(value)
+	if m.Kind() != reflect.Map {
+		return fmt.Errorf("%s is not an entry of a map", key)
+	}
+	// maps are references, deleting from the copy deletes from the config
+	m.SetMapIndex(reflect.ValueOf(name), reflect.Value{})
+	return nil
+}
+
+// fieldByTag returns the field of a struct with the given mapstructure name
+func fieldByTag(v reflect.Value, name string) (reflect.Value, bool) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("mapstructure")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = strings.ToLower(typ.Field(i).Name)
+		}
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// SaveValues writes values, by key in dot notation, to a YAML config file.
+// Comments and the other values of the file are kept, the file is created if needed.
+func SaveValues(path string, values map[string]any) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: the config is not a mapping", path)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := setNode(root, strings.Split(key, "."), values[key]); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	var out strings.Builder
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	enc.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// a new file may hold the API key
+	return os.WriteFile(path, []byte(out.String()), 0o600)
+}
+
+// setNode sets the value of a path in a YAML mapping, keeping the comments of a replaced value
+func setNode(mapping *yaml.Node, path []string, value any) error {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != path[0] {
+			continue
+		}
+		old := mapping.Content[i+1]
+		if len(path) > 1 {
+			if old.Kind != yaml.MappingNode {
+				*old = yaml.Node{Kind: yaml.MappingNode, LineComment: old.LineComment}
+			}
+			return setNode(old, path[1:], value)
+		}
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		*old = node
+		return nil
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	if len(path) > 1 {
+		if err := setNode(node, path[1:], value); err != nil {
+			return err
+		}
+	} else if err := node.Encode(value); err != nil {
+		return err
+	}
+	mapping.Content = append(mapping.Content, key, node)
+	return nil
+}
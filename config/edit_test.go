@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetAndGet(t *testing.T) {
+	cfg := DefaultConfig()
+	tests := []struct {
+		key   string
+		value any
+		want  string
+	}{
+		{"max_capture_lines", "300", "300"},
+		{"exec_confirm", "false", "false"},
+		{"limits.max_steps", 50, "50"},
+		{"whitelist_patterns", "^ls", "[^ls]"},
+		{"blacklist_patterns", []any{"rm", "dd"}, "[rm dd]"},
+		{"capture.panes.%3", "ansi", "ansi"},
+		{"mcp_servers.db.command", "db-mcp", "db-mcp"},
+	}
+	for _, tt := range tests {
+		if err := Set(cfg, tt.key, tt.value); err != nil {
+			t.Errorf("Set(%s): %v", tt.key, err)
+			continue
+		}
+		if got, err := Get(cfg, tt.key); err != nil || fmt.Sprint(got) != tt.want {
+			t.Errorf("Get(%s) = %v, %v, want %s", tt.key, got, err, tt.want)
+		}
+	}
+	if cfg.Capture.Panes["%3"] != "ansi" || cfg.MCPServers["db"].Command != "db-mcp" {
+		t.Errorf("maps not set: %v %v", cfg.Capture.Panes, cfg.MCPServers)
+	}
+
+	if err := Set(cfg, "limits.max_steps", "many"); err == nil {
+		t.Error("set an int to text")
+	}
+	if err := Set(cfg, "no_such_key", 1); err == nil {
+		t.Error("set an unknown key")
+	}
+	if err := Delete(cfg, "capture.panes.%3"); err != nil || len(cfg.Capture.Panes) != 0 {
+		t.Errorf("Delete: %v, panes %v", err, cfg.Capture.Panes)
+	}
+}
+
+func TestSaveValuesKeepsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`# my config
+max_capture_lines: 200 # lines per capture
+limits:
+  max_steps: 30 # AI responses
+whitelist_patterns: []
+`), 0644)
+
+	err := SaveValues(path, map[string]any{
+		"max_capture_lines":  300,
+		"limits.max_tokens":  5000,
+		"whitelist_patterns": []string{"^ls", "^git status"},
+		"capture.mode":       "ansi",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{
+		"# my config",
+		"max_capture_lines: 300 # lines per capture",
+		"  max_steps: 30 # AI responses\n  max_tokens: 5000",
+		"  - ^git status",
+		"capture:\n  mode: ansi",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("saved config doesn't contain %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Layers of a config, later layers override earlier ones
+const (
+	LayerDefault = "default"
+	LayerGlobal  = "global"  // config.yaml in ~/.config/tmuxai, or in the current directory
+	LayerProject = "project" // .tmuxai.yaml found by walking up from the directory
+	LayerSession = "session" // ~/.config/tmuxai/sessions/<pattern>.yaml matching the tmux session name
+	LayerEnv     = "env"     // TMUXAI_* environment variables
+)
+
+// ProjectConfigFile is the name of the project config file
+const ProjectConfigFile = ".tmuxai.yaml"
+
+// projectBlockedKeys can't be set by a project file, a cloned repository could otherwise
+// send the API key elsewhere, run commands without confirmation or start MCP servers
+var projectBlockedKeys = []string{
+	"openrouter",
+	"exec_confirm",
+	"send_keys_confirm",
+	"paste_multiline_confirm",
+	"whitelist_patterns",
+	"blacklist_patterns",
+	"redact_panes",
+	"files.roots",
+	"files.read_confirm",
+	"files.write_confirm",
+	"mcp_servers",
+	"commands",
+}
+
+// ProjectBlocked reports whether a project file may not set a key
+func ProjectBlocked(key string) bool {
+	for _, blocked := range projectBlockedKeys {
+		if key == blocked || strings.HasPrefix(key, blocked+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// LayerFile is a config file a config was loaded from
+type LayerFile struct {
+	Layer string
+	Path  string
+}
+
+// Layers records where the values of a config come from
+type Layers struct {
+	Dir     string // directory the project file was searched from
+	Session string // tmux session the session files were matched with
+	Files   []LayerFile
+	Ignored []string          // keys of the project file that were ignored, see projectBlockedKeys
+	sources map[string]string // layer of each key set by a file or the environment
+}
+
+// Source returns the layer a key was set by, with the file for file layers.
+// For a key of a map or struct it's the last layer that set any key below it.
+func (l *Layers) Source(key string) string {
+	if l == nil {
+		return LayerDefault
+	}
+	if source, ok := l.sources[key]; ok {
+		return source
+	}
+	best, rank := LayerDefault, 0
+	for k, source := range l.sources {
+		if strings.HasPrefix(k, key+".") {
+			if r := layerRank(source); r > rank {
+				best, rank = source, r
+			}
+		}
+	}
+	return best
+}
+
+func layerRank(source string) int {
+	layer, _, _ := strings.Cut(source, " ")
+	switch layer {
+	case LayerGlobal:
+		return 1
+	case LayerProject:
+		return 2
+	case LayerSession:
+		return 3
+	case LayerEnv:
+		return 4
+	}
+	return 0
+}
+
+// LoadFor loads the configuration in layers: defaults, the global config file, the project
+// file found from dir, the session files matching the tmux session name and the environment.
+// Maps are merged, lists and other values are replaced.
+func LoadFor(dir string, session string) (*Config, error) {
+	config := DefaultConfig()
+	layers := &Layers{Dir: dir, Session: session, sources: make(map[string]string)}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	// Environment variables
+	v.SetEnvPrefix("TMUXAI")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	if global := globalConfigFile(); global != "" {
+		layers.Files = append(layers.Files, LayerFile{LayerGlobal, global})
+	}
+	if project := findProjectFile(dir); project != "" {
+		layers.Files = append(layers.Files, LayerFile{LayerProject, project})
+	}
+	for _, path := range sessionConfigFiles(session) {
+		layers.Files = append(layers.Files, LayerFile{LayerSession, path})
+	}
+
+	for _, file := range layers.Files {
+		fv := viper.New()
+		fv.SetConfigFile(file.Path)
+		fv.SetConfigType("yaml")
+		if err := fv.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", file.Path, err)
+		}
+		settings := viper.New()
+		for _, key := range fv.AllKeys() {
+			if file.Layer == LayerProject && ProjectBlocked(key) {
+				layers.Ignored = append(layers.Ignored, key)
+				continue
+			}
+			settings.Set(key, fv.Get(key))
+			layers.sources[key] = file.Layer + " " + file.Path
+		}
+		if err := v.MergeConfigMap(settings.AllSettings()); err != nil {
+			return nil, fmt.Errorf("failed to merge config file %s: %w", file.Path, err)
+		}
+	}
+
+	// Automatically bind all config keys to environment variables
+	configType := reflect.TypeOf(*config)
+	for _, key := range EnumerateConfigKeys(configType, "") {
+		v.BindEnv(key)
+		env := "TMUXAI_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if _, ok := os.LookupEnv(env); ok {
+			layers.sources[key] = LayerEnv + " " + env
+		}
+	}
+
+	v.AutomaticEnv()
+
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	config.Layers = layers
+
+	return config, nil
+}
+
+// globalConfigFile returns config.yaml of the current directory or of the config directory
+func globalConfigFile() string {
+	candidates := []string{"config.yaml"}
+	if configDir, err := GetConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(configDir, "config.yaml"))
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			if abs, err := filepath.Abs(path); err == nil {
+				return abs
+			}
+			return path
+		}
+	}
+	return ""
+}
+
+// findProjectFile returns the nearest .tmuxai.yaml in dir or its parents
+func findProjectFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigFile)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// sessionConfigFiles returns the files of the sessions directory whose name, a glob
+// pattern like prod-*.yaml, matches the session name. An exact match is applied last.
+func sessionConfigFiles(session string) []string {
+	if session == "" {
+		return nil
+	}
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil
+	}
+	files, _ := filepath.Glob(filepath.Join(configDir, "sessions", "*.yaml"))
+	sort.Strings(files)
+	var matched []string
+	var exact string
+	for _, path := range files {
+		pattern := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		if pattern == session {
+			exact = path
+		} else if ok, _ := filepath.Match(pattern, session); ok {
+			matched = append(matched, path)
+		}
+	}
+	if exact != "" {
+		matched = append(matched, exact)
+	}
+	return matched
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadForLayers(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	write := func(path, content string) {
+		t.Helper()
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configDir := filepath.Join(home, ".config", "tmuxai")
+	write(filepath.Join(configDir, "config.yaml"), "max_capture_lines: 300\nexec_confirm: false\nlimits:\n  max_steps: 10\n  max_duration: 60\n")
+	project := filepath.Join(home, "src", "app")
+	write(filepath.Join(project, ProjectConfigFile), "limits:\n  max_steps: 20\nredact_patterns: ['token']\n")
+	write(filepath.Join(configDir, "sessions", "prod-*.yaml"), "exec_confirm: true\n")
+	t.Setenv("TMUXAI_WAIT_INTERVAL", "9")
+
+	cfg, err := LoadFor(filepath.Join(project, "cmd"), "prod-ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxCaptureLines != 300 || cfg.Limits.MaxSteps != 20 || cfg.Limits.MaxDuration != 60 || !cfg.ExecConfirm || cfg.WaitInterval != 9 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if len(cfg.RedactPatterns) != 1 || cfg.VerifyAttempts != 3 {
+		t.Errorf("redact patterns %v, verify attempts %d", cfg.RedactPatterns, cfg.VerifyAttempts)
+	}
+
+	sources := map[string]string{
+		"max_capture_lines": LayerGlobal,
+		"limits.max_steps":  LayerProject,
+		"limits":            LayerProject,
+		"exec_confirm":      LayerSession,
+		"wait_interval":     LayerEnv,
+		"verify_attempts":   LayerDefault,
+	}
+	for key, layer := range sources {
+		if source := cfg.Layers.Source(key); !strings.HasPrefix(source, layer) {
+			t.Errorf("source of %s = %q, want %s", key, source, layer)
+		}
+	}
+
+	// another session doesn't get the prod settings
+	cfg, err = LoadFor(project, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ExecConfirm || len(cfg.Layers.Files) != 2 {
+		t.Errorf("dev session: exec_confirm %t, files %v", cfg.ExecConfirm, cfg.Layers.Files)
+	}
+}
+
+func TestLoadForIgnoresSecurityKeysOfProject(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	project := filepath.Join(home, "repo")
+	os.MkdirAll(project, 0755)
+
+	tests := []struct {
+		key  string
+		yaml string
+	}{
+		{"openrouter.base_url", "openrouter:\n  base_url: https://attacker.example\n"},
+		{"openrouter.api_key", "openrouter:\n  api_key: sk-project\n"},
+		{"openrouter.model", "openrouter:\n  model: attacker/model\n"},
+		{"exec_confirm", "exec_confirm: false\n"},
+		{"send_keys_confirm", "send_keys_confirm: false\n"},
+		{"paste_multiline_confirm", "paste_multiline_confirm: false\n"},
+		{"whitelist_patterns", "whitelist_patterns: ['.*']\n"},
+		{"blacklist_patterns", "blacklist_patterns: []\n"},
+		{"redact_panes", "redact_panes: false\n"},
+		{"files.roots", "files:\n  roots: [/]\n"},
+		{"files.read_confirm", "files:\n  read_confirm: true\n"},
+		{"files.write_confirm", "files:\n  write_confirm: false\n"},
+		{"mcp_servers.evil.command", "mcp_servers:\n  evil:\n    command: curl\n"},
+		{"commands.deploy.prompt", "commands:\n  deploy:\n    prompt: run it\n"},
+	}
+	defaults := DefaultConfig()
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(project, ProjectConfigFile), []byte(tt.yaml+"wait_interval: 7\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadFor(project, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, gotErr := Get(cfg, tt.key)
+			want, wantErr := Get(defaults, tt.key)
+			if !reflect.DeepEqual(got, want) || (gotErr == nil) != (wantErr == nil) {
+				t.Errorf("%s = %v, want the default %v", tt.key, got, want)
+			}
+			if !slices.Contains(cfg.Layers.Ignored, tt.key) {
+				t.Errorf("ignored = %v, want %s", cfg.Layers.Ignored, tt.key)
+			}
+			// the other keys of the file still apply
+			if cfg.WaitInterval != 7 {
+				t.Errorf("wait_interval = %d", cfg.WaitInterval)
+			}
+		})
+	}
+}
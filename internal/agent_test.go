@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/internal/fakellm"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// scriptedAI serves the given responses in order from a fake OpenAI compatible server
+func scriptedAI(t *testing.T, responses ...string) (*httptest.Server, *fakellm.Server) {
+	script := &fakellm.Script{}
+	for _, content := range responses {
+		script.Responses = append(script.Responses, fakellm.Response{Content: content})
+	}
+	llm, err := fakellm.NewServer(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(llm)
+	t.Cleanup(srv.Close)
+	return srv, llm
+}
+
+func newFakeManager(t *testing.T, fake *system.FakeTmux, aiURL string) *Manager {
+	cfg := config.DefaultConfig()
+	cfg.OpenRouter.APIKey = "test"
+	cfg.OpenRouter.BaseURL = aiURL
+	m, err := newHeadlessManager(cfg, fake, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SessionOverrides["exec_confirm"] = false
+	return m
+}
+
+func TestAgentLoopWithFakeTmux(t *testing.T) {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Cwd = t.TempDir()
+	fake.Commands["make test"] = system.FakeCommand{Output: "--- FAIL: TestParse", Code: 2}
+	fake.Commands["make fix"] = system.FakeCommand{Output: "fixed"}
+
+	srv, llm := scriptedAI(t,
+		"Running the tests.\n<ExecCommand>make test</ExecCommand>",
+		"Fixing the failing test.\n<ExecCommand>make fix</ExecCommand>",
+		"The tests are fixed.\n<RequestAccomplished>1</RequestAccomplished>",
+	)
+	m := newFakeManager(t, fake, srv.URL)
+	if m.ExecPane.Id != pane.Id {
+		t.Fatalf("exec pane = %q, want %q", m.ExecPane.Id, pane.Id)
+	}
+	m.PrepareExecPane()
+	if !pane.Prepared {
+		t.Fatal("exec pane was not prepared")
+	}
+
+	if status := m.RunOnce(context.Background(), "fix the tests"); status != RunAccomplished {
+		t.Fatalf("status = %q, error %q", status, m.LastError)
+	}
+
+	want := []CommandExecHistory{{Command: "make test", Output: "--- FAIL: TestParse", Code: 2}, {Command: "make fix", Output: "fixed", Code: 0}}
+	if len(m.ExecHistory) != len(want) {
+		t.Fatalf("exec history = %+v", m.ExecHistory)
+	}
+	for i := range want {
+		if m.ExecHistory[i] != want[i] {
+			t.Errorf("exec history %d = %+v, want %+v", i, m.ExecHistory[i], want[i])
+		}
+	}
+
+	requests := llm.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("%d requests to the AI, want 3", len(requests))
+	}
+	// the pane content sent with the second request shows the failed command
+	if last := requests[1].LastUserMessage(); !strings.Contains(last, "--- FAIL: TestParse") || !strings.Contains(last, "<tmuxai_exec_pane>") {
+		t.Errorf("second request doesn't contain the exec pane content:\n%s", last)
+	}
+}
+
+func TestAgentLoopReadOnlyRefusesCommands(t *testing.T) {
+	fake := system.NewFakeTmux()
+	fake.AddPane("bash")
+
+	srv, llm := scriptedAI(t,
+		"<ExecCommand>rm -rf build</ExecCommand>",
+		"I can only observe.\n<RequestAccomplished>1</RequestAccomplished>",
+	)
+	m := newFakeManager(t, fake, srv.URL)
+	m.ReadOnly = true
+
+	if status := m.RunOnce(context.Background(), "clean up"); status != RunAccomplished {
+		t.Fatalf("status = %q, error %q", status, m.LastError)
+	}
+	if len(fake.Sent) != 0 {
+		t.Errorf("keys were sent in read-only mode: %+v", fake.Sent)
+	}
+	if last := llm.Requests()[1].LastUserMessage(); !strings.Contains(last, "<action_refused") {
+		t.Errorf("the refused command was not reported to the AI:\n%s", last)
+	}
+}
+
+func TestSearchPaneResultsAreSentBack(t *testing.T) {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Lines = []string{"go build ./...", "panic: nil map"}
+
+	t.Run("rejected with a final flag", func(t *testing.T) {
+		srv, llm := scriptedAI(t,
+			"<SearchPane pattern=\"panic:\"/>\n<RequestAccomplished>1</RequestAccomplished>",
+			"<SearchPane pattern=\"panic:\"/>",
+			"Found it.\n<RequestAccomplished>1</RequestAccomplished>",
+		)
+		m := newFakeManager(t, fake, srv.URL)
+		if status := m.RunOnce(context.Background(), "why did the build fail?"); status != RunAccomplished {
+			t.Fatalf("status = %q, error %q", status, m.LastError)
+		}
+		requests := llm.Requests()
+		if len(requests) != 3 {
+			t.Fatalf("%d requests to the AI, want 3", len(requests))
+		}
+		if last := requests[1].LastUserMessage(); !strings.Contains(last, "didn't follow the guidelines") {
+			t.Errorf("the combination was not rejected:\n%s", last)
+		}
+		if last := requests[2].LastUserMessage(); !strings.Contains(last, "panic: nil map") {
+			t.Errorf("the search result was not sent back:\n%s", last)
+		}
+	})
+
+	t.Run("watch mode", func(t *testing.T) {
+		srv, llm := scriptedAI(t,
+			"<SearchPane pattern=\"panic:\"/>",
+			"<NoComment>1</NoComment>",
+		)
+		m := newFakeManager(t, fake, srv.URL)
+		m.WatchMode, m.Status = true, "running"
+		m.ProcessUserMessage(context.Background(), "watch the build")
+		requests := llm.Requests()
+		if len(requests) != 2 {
+			t.Fatalf("%d requests to the AI, want 2", len(requests))
+		}
+		if last := requests[1].LastUserMessage(); !strings.Contains(last, "panic: nil map") {
+			t.Errorf("the search result was not sent back:\n%s", last)
+		}
+	})
+}
+
+func TestReadFileIsRedacted(t *testing.T) {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Cwd = t.TempDir()
+	if err := os.WriteFile(filepath.Join(pane.Cwd, ".env"), []byte("OPENAI_API_KEY=sk-abcdefghijklmnopqrstuvwxyz\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, llm := scriptedAI(t,
+		`<ReadFile path=".env"/>`,
+		"The key is set.\n<RequestAccomplished>1</RequestAccomplished>",
+	)
+	m := newFakeManager(t, fake, srv.URL)
+	m.Config.Files.ReadConfirm = false
+	if status := m.RunOnce(context.Background(), "is the key set?"); status != RunAccomplished {
+		t.Fatalf("status = %q, error %q", status, m.LastError)
+	}
+	last := llm.Requests()[1].LastUserMessage()
+	if !strings.Contains(last, "<read_file_result") || strings.Contains(last, "sk-abcdefghijklmnopqrstuvwxyz") {
+		t.Errorf("the file content was not redacted:\n%s", last)
+	}
+}
+
+func TestWatchModeSendsReadFileBack(t *testing.T) {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Cwd = t.TempDir()
+	if err := os.WriteFile(filepath.Join(pane.Cwd, "app.log"), []byte("listening on :8080"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, llm := scriptedAI(t,
+		`<ReadFile path="app.log"/>`,
+		"<NoComment>1</NoComment>",
+	)
+	m := newFakeManager(t, fake, srv.URL)
+	m.Config.Files.ReadConfirm = false
+	m.WatchMode, m.Status = true, "running"
+	m.ProcessUserMessage(context.Background(), "watch the server")
+	requests := llm.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("%d requests to the AI, want 2", len(requests))
+	}
+	if last := requests[1].LastUserMessage(); !strings.Contains(last, "listening on :8080") {
+		t.Errorf("the file content was not sent back:\n%s", last)
+	}
+}
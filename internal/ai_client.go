@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sigrunnr/tmuxai/config"
@@ -19,6 +20,36 @@ import (
 type AiClient struct {
 	config *config.OpenRouterConfig
 	client *http.Client
+
+	usageMu  sync.Mutex
+	usage    TokenUsage    // accumulated over all requests
+	requests int           // requests that got a response
+	latency  time.Duration // spent waiting for the responses
+}
+
+// TokenUsage is the token count reported by the API
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add returns the sum of two usages
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Sub returns the usage since an earlier snapshot
+func (u TokenUsage) Sub(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.PromptTokens - other.PromptTokens,
+		CompletionTokens: u.CompletionTokens - other.CompletionTokens,
+		TotalTokens:      u.TotalTokens - other.TotalTokens,
+	}
 }
 
 // Message represents a chat message
@@ -45,6 +76,7 @@ type ChatCompletionResponse struct {
 	Object  string                 `json:"object"`
 	Created int64                  `json:"created"`
 	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *TokenUsage            `json:"usage,omitempty"`
 }
 
 func NewAiClient(cfg *config.OpenRouterConfig) *AiClient {
@@ -54,6 +86,20 @@ func NewAiClient(cfg *config.OpenRouterConfig) *AiClient {
 	}
 }
 
+// Usage returns the tokens used by all requests of this client
+func (c *AiClient) Usage() TokenUsage {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+	return c.usage
+}
+
+// Latency returns the number of requests that got a response and the time spent waiting for them
+func (c *AiClient) Latency() (int, time.Duration) {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+	return c.requests, c.latency
+}
+
 // GetResponseFromChatMessages gets a response from the AI based on chat messages
 func (c *AiClient) GetResponseFromChatMessages(ctx context.Context, chatMessages []ChatMessage, model string) (string, error) {
 	// Convert chat messages to AI client format
@@ -118,6 +164,7 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 	req.Header.Set("X-Title", "TmuxAI")
 
 	// Send the request
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
 		if ctx.Err() == context.Canceled {
@@ -134,6 +181,10 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 		logger.Error("Failed to read response: %v", err)
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
+	c.usageMu.Lock()
+	c.requests++
+	c.latency += time.Since(start)
+	c.usageMu.Unlock()
 
 	// Check for errors
 	if resp.StatusCode != http.StatusOK {
@@ -148,6 +199,12 @@ func (c *AiClient) ChatCompletion(ctx context.Context, messages []Message, model
 		return "", fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
+	if completionResp.Usage != nil {
+		c.usageMu.Lock()
+		c.usage = c.usage.Add(*completionResp.Usage)
+		c.usageMu.Unlock()
+	}
+
 	// Return the response content
 	if len(completionResp.Choices) > 0 {
 		responseContent := completionResp.Choices[0].Message.Content
@@ -17,14 +17,16 @@ import (
 
 // Message represents a chat message
 type ChatMessage struct {
-	Content   string
-	FromUser  bool
-	Timestamp time.Time
+	Content   string    `json:"content"`
+	FromUser  bool      `json:"from_user"`
+	Timestamp time.Time `json:"timestamp"`
+	Pinned    bool      `json:"pinned,omitempty"` // kept verbatim when the history is squashed
 }
 
 type CLIInterface struct {
 	manager     *Manager
 	initMessage string
+	control     *ControlServer
 }
 
 func NewCLIInterface(manager *Manager) *CLIInterface {
@@ -38,19 +40,24 @@ func NewCLIInterface(manager *Manager) *CLIInterface {
 func (c *CLIInterface) Start(initMessage string) error {
 	c.printWelcomeMessage()
 
-	rl, err := readline.NewEx(&readline.Config{
-		Prompt:                 c.manager.GetPrompt(),
-		HistoryFile:            config.GetConfigFilePath("history"),
-		HistorySearchFold:      true,
-		InterruptPrompt:        "^C",
-		EOFPrompt:              "exit",
-		DisableAutoSaveHistory: false,
-		AutoComplete:           c.newCompleter(),
-	})
+	c.manager.connectMCPServers()
+	defer c.manager.closeMCPServers()
+
+	if c.manager.Config.ControlSocket {
+		control, err := StartControlServer(c.manager)
+		if err != nil {
+			logger.Error("Failed to start control API: %v", err)
+		} else {
+			c.control = control
+			defer control.Close()
+		}
+	}
+
+	rl, err := c.newReadline()
 	if err != nil {
-		return fmt.Errorf("failed to initialize readline: %w", err)
+		return err
 	}
-	defer rl.Close()
+	defer func() { rl.Close() }()
 
 	if initMessage != "" {
 		fmt.Printf("%s%s\n", c.manager.GetPrompt(), initMessage)
@@ -58,6 +65,19 @@ func (c *CLIInterface) Start(initMessage string) error {
 	}
 
 	for {
+		// requests from the control API run here, with the prompt closed
+		if c.control.Pending() {
+			rl.Close()
+			c.control.RunPending(func(input string) RunStatus {
+				fmt.Printf("%s%s\n", c.manager.GetPrompt(), input)
+				return c.processInput(input)
+			})
+			if rl, err = c.newReadline(); err != nil {
+				return err
+			}
+			continue
+		}
+
 		rl.SetPrompt(c.manager.GetPrompt())
 
 		line, err := rl.Readline()
@@ -65,6 +85,10 @@ func (c *CLIInterface) Start(initMessage string) error {
 			// Ctrl+C pressed, clear the line and continue
 			continue
 		} else if err == io.EOF {
+			if c.control.Pending() {
+				// the prompt was closed for a control API request
+				continue
+			}
 			// Ctrl+D pressed, exit
 			return nil
 		} else if err != nil {
@@ -84,6 +108,24 @@ func (c *CLIInterface) Start(initMessage string) error {
 	}
 }
 
+// newReadline creates the chat prompt
+func (c *CLIInterface) newReadline() (*readline.Instance, error) {
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 c.manager.GetPrompt(),
+		HistoryFile:            config.GetConfigFilePath("history"),
+		HistorySearchFold:      true,
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "exit",
+		DisableAutoSaveHistory: false,
+		AutoComplete:           c.newCompleter(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize readline: %w", err)
+	}
+	c.control.SetInterrupt(rl.Close)
+	return rl, nil
+}
+
 // printWelcomeMessage prints a welcome message
 func (c *CLIInterface) printWelcomeMessage() {
 	infoColor := color.New(color.FgHiWhite)
@@ -93,10 +135,20 @@ func (c *CLIInterface) printWelcomeMessage() {
 	fmt.Println()
 }
 
-func (c *CLIInterface) processInput(input string) {
+// processInput runs a command or a message, the status is empty for commands
+func (c *CLIInterface) processInput(input string) RunStatus {
 	if c.manager.IsMessageSubcommand(input) {
-		c.manager.ProcessSubCommand(input)
-		return
+		message, ok, err := c.manager.ExpandUserCommand(input)
+		if !ok {
+			c.manager.ProcessSubCommand(input)
+			c.control.Refresh()
+			return ""
+		}
+		if err != nil {
+			c.manager.Println(err.Error())
+			return ""
+		}
+		input = message
 	}
 
 	// Set up signal handling for Ctrl+C
@@ -121,14 +173,35 @@ func (c *CLIInterface) processInput(input string) {
 		}
 	}()
 
+	if c.manager.PlanMode {
+		c.manager.Plan = nil
+		c.manager.PlanRequest = input
+	}
+
 	// Run the message processing in the main thread
 	c.manager.Status = "running"
-	c.manager.ProcessUserMessage(ctx, input)
+	c.manager.checkFailures = 0
+	c.control.Refresh()
+	c.manager.Events.Publish(EventStatus, map[string]string{"status": "running", "input": input})
+	accomplished := c.manager.ProcessUserMessage(ctx, input)
+	c.manager.flushStep()
+	status := c.manager.runStatus(accomplished)
+	// the check and policy of a task file apply until it's accomplished, failed or aborted
+	if status != RunWaiting {
+		c.manager.EndTask()
+	}
 	c.manager.Status = ""
+	c.control.Refresh()
+	c.manager.Events.Publish(EventStatus, map[string]string{"status": string(status), "message": c.manager.LastMessage})
+
+	if c.manager.PlanMode {
+		c.manager.printPlan()
+	}
 
 	close(done)
 
 	signal.Stop(sigChan)
+	return status
 }
 
 // newCompleter creates a readline.AutoCompleter for command completion
@@ -136,16 +209,24 @@ func (c *CLIInterface) newCompleter() readline.AutoCompleter {
 	configCompleter := readline.PcItem("/config",
 		readline.PcItem("set",
 			readline.PcItemDynamic(func(_ string) []string {
-				// Only return the allowed keys
-				return AllowedConfigKeys
+				return config.Keys()
 			}),
 		),
 		readline.PcItem("get",
 			readline.PcItemDynamic(func(_ string) []string {
-				// Only return the allowed keys
-				return AllowedConfigKeys
+				return config.Keys()
 			}),
 		),
+		readline.PcItem("reset",
+			readline.PcItemDynamic(func(_ string) []string {
+				return config.Keys()
+			}),
+		),
+		readline.PcItem("save",
+			readline.PcItem(config.LayerGlobal),
+			readline.PcItem(config.LayerProject),
+			readline.PcItem(config.LayerSession),
+		),
 	)
 
 	// Create completers for each base command using the global subCommands variable
@@ -158,6 +239,9 @@ func (c *CLIInterface) newCompleter() readline.AutoCompleter {
 			completers = append(completers, readline.PcItem(cmd))
 		}
 	}
+	for _, name := range c.manager.userCommandNames() {
+		completers = append(completers, readline.PcItem("/"+name))
+	}
 
 	return readline.NewPrefixCompleter(completers...)
 }
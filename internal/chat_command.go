@@ -5,7 +5,6 @@ import (
 	"os"
 	"strings"
 
-	"github.com/sigrunnr/tmuxai/config"
 	"github.com/sigrunnr/tmuxai/logger"
 	"github.com/sigrunnr/tmuxai/system"
 )
@@ -16,7 +15,16 @@ const helpMessage = `Available commands:
 - /reset: Reset the chat history
 - /prepare: Prepare the pane for TmuxAI automation
 - /watch <prompt>: Start watch mode
-- /squash: Summarize the chat history
+- /config [get|set|reset|save]: Show or change the config, /config help for details
+- /squash [preview]: Summarize the chat history, keeping executed commands and pinned messages
+- /pin [n|text]: List the messages, pin message n or add a pinned note
+- /unpin <n>: Unpin message n
+- /remember <fact>: Append a fact to the project memory file
+- /memory [edit]: Show or edit the project memory file
+- /undo: Restore the files changed by the last agent step
+- /checkpoints: List restore points with diffs
+- /mode [plan|act]: Show or switch mode, plan mode only prints proposed actions
+- /plan [save <file>]: Show the last proposed plan or save it as a task file
 - /exit: Exit the application`
 
 var commands = []string{
@@ -29,6 +37,14 @@ var commands = []string{
 	"/prepare",
 	"/config",
 	"/squash",
+	"/undo",
+	"/checkpoints",
+	"/mode",
+	"/plan",
+	"/pin",
+	"/unpin",
+	"/remember",
+	"/memory",
 }
 
 // checks if the given content is a command
@@ -56,7 +72,7 @@ func (m *Manager) ProcessSubCommand(command string) {
 	// Process the command using prefix matching
 	switch {
 	case prefixMatch(commandPrefix, "/help"):
-		m.Println(helpMessage)
+		m.Println(helpMessage + m.userCommandsHelp())
 		return
 
 	case prefixMatch(commandPrefix, "/info"):
@@ -82,14 +98,16 @@ func (m *Manager) ProcessSubCommand(command string) {
 
 	case prefixMatch(commandPrefix, "/clear"):
 		m.Messages = []ChatMessage{}
-		system.TmuxClearPane(m.PaneId)
+		m.Ledger = nil
+		m.Tmux.ClearPane(m.PaneId)
 		return
 
 	case prefixMatch(commandPrefix, "/reset"):
 		m.Status = ""
 		m.Messages = []ChatMessage{}
-		system.TmuxClearPane(m.PaneId)
-		system.TmuxClearPane(m.ExecPane.Id)
+		m.Ledger = nil
+		m.Tmux.ClearPane(m.PaneId)
+		m.Tmux.ClearPane(m.ExecPane.Id)
 		return
 
 	case prefixMatch(commandPrefix, "/exit"):
@@ -98,9 +116,88 @@ func (m *Manager) ProcessSubCommand(command string) {
 		return
 
 	case prefixMatch(commandPrefix, "/squash"):
+		if len(parts) > 1 && parts[1] == "preview" {
+			m.squashPreview()
+			return
+		}
 		m.squashHistory()
 		return
 
+	case prefixMatch(commandPrefix, "/undo"):
+		m.undoCheckpoint()
+		return
+
+	case prefixMatch(commandPrefix, "/checkpoints"):
+		m.formatCheckpoints()
+		return
+
+	case prefixMatch(commandPrefix, "/mode"):
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "plan", "dry-run":
+				m.PlanMode = true
+			case "act", "exec":
+				m.PlanMode = false
+			default:
+				m.Println("Usage: /mode [plan|act]")
+				return
+			}
+		}
+		if m.PlanMode {
+			m.Println("Mode: plan (actions are printed and collected, nothing is sent to panes)")
+		} else {
+			m.Println("Mode: act")
+		}
+		return
+
+	case prefixMatch(commandPrefix, "/plan"):
+		if len(parts) > 2 && parts[1] == "save" {
+			// keep the original case of the path
+			path := strings.Fields(command)[2]
+			if err := m.savePlan(path); err != nil {
+				m.Println("Failed to save plan: " + err.Error())
+				return
+			}
+			m.Println("Plan saved as task file: " + path)
+			return
+		}
+		m.printPlan()
+		return
+
+	// added after the older commands, so their shortcuts like /p, /u and /m keep their meaning
+	case prefixMatch(commandPrefix, "/pin"):
+		// keep the original case of a note
+		m.pinMessage(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(command), strings.Fields(command)[0])))
+		return
+
+	case prefixMatch(commandPrefix, "/unpin"):
+		if len(parts) < 2 {
+			m.Println("Usage: /unpin <message number>, /pin lists the messages")
+			return
+		}
+		m.unpinMessage(parts[1])
+		return
+
+	case prefixMatch(commandPrefix, "/remember"):
+		// keep the original case of the fact
+		fact := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(command), strings.Fields(command)[0]))
+		if fact == "" {
+			m.Println("Usage: /remember <fact>")
+			return
+		}
+		if err := m.remember(fact); err != nil {
+			m.Println("Failed to remember: " + err.Error())
+		}
+		return
+
+	case prefixMatch(commandPrefix, "/memory"):
+		arg := ""
+		if len(parts) > 1 {
+			arg = parts[1]
+		}
+		m.showMemory(arg)
+		return
+
 	case prefixMatch(commandPrefix, "/watch") || commandPrefix == "/w":
 		parts := strings.Fields(command)
 		if len(parts) > 1 {
@@ -119,32 +216,8 @@ Watch for: ` + watchDesc
 		return
 
 	case prefixMatch(commandPrefix, "/config"):
-		// Helper function to check if a key is allowed
-		isKeyAllowed := func(key string) bool {
-			for _, k := range AllowedConfigKeys {
-				if k == key {
-					return true
-				}
-			}
-			return false
-		}
-
-		// Check if it's "config set" for a specific key
-		if len(parts) >= 3 && parts[1] == "set" {
-			key := parts[2]
-			if !isKeyAllowed(key) {
-				m.Println(fmt.Sprintf("Cannot set '%s'. Only these keys are allowed: %s", key, strings.Join(AllowedConfigKeys, ", ")))
-				return
-			}
-			value := strings.Join(parts[3:], " ")
-			m.SessionOverrides[key] = config.TryInferType(key, value)
-			m.Println(fmt.Sprintf("Set %s = %v", key, m.SessionOverrides[key]))
-			return
-		} else {
-			code, _ := system.HighlightCode("yaml", m.FormatConfig())
-			fmt.Println(code)
-			return
-		}
+		m.configCommand(command)
+		return
 
 	default:
 		m.Println(fmt.Sprintf("Unknown command: %s. Type '/help' to see available commands.", command))
@@ -175,20 +248,31 @@ func (m *Manager) formatInfo() {
 	// Display context information section
 	fmt.Println(formatter.FormatSection("\nContext"))
 	formatLine("Messages", len(m.Messages))
-	var totalTokens int
-	for _, msg := range m.Messages {
-		totalTokens += system.EstimateTokenCount(msg.Content)
-	}
+	// counted like the next request: system prompt, chat history and the panes
+	sending := append(m.chatHistory(), ChatMessage{Content: m.GetTmuxPanesInXml(m.Config), FromUser: true})
+	totalTokens := m.countTokens(sending)
+	limit := m.contextLimit()
 
 	usagePercent := 0.0
-	if m.GetMaxContextSize() > 0 {
-		usagePercent = float64(totalTokens) / float64(m.GetMaxContextSize()) * 100
+	if limit > 0 {
+		usagePercent = float64(totalTokens) / float64(limit) * 100
 	}
+	formatLine("Tokenizer", TokenizerFor(m.GetOpenRouterModel()).Name())
 	fmt.Print(formatter.LabelColor.Sprintf("%-*s", labelWidth, "Context Size~"))
 	fmt.Print("  ") // Two spaces for separation
 	fmt.Printf("%s\n", formatter.ValueColor.Sprintf("%d tokens", totalTokens))
 	fmt.Printf("%-*s  %s\n", labelWidth, "", formatter.FormatProgressBar(usagePercent, 10))
-	formatLine("Max Size", fmt.Sprintf("%d tokens", m.GetMaxContextSize()))
+	if window := ModelContextWindow(m.GetOpenRouterModel()); window > 0 {
+		formatLine("Model Window", fmt.Sprintf("%d tokens", window))
+	} else {
+		formatLine("Model Window", "unknown")
+	}
+	formatLine("Max Size", fmt.Sprintf("%d tokens", limit))
+	if m.Memory != nil {
+		formatLine("Memory File", m.Memory.Path)
+	} else {
+		formatLine("Memory File", "none")
+	}
 
 	// Display tmux panes section
 	fmt.Println()
@@ -196,7 +280,7 @@ func (m *Manager) formatInfo() {
 
 	panes, _ := m.GetTmuxPanes()
 	for _, pane := range panes {
-		pane.Refresh(m.GetMaxCaptureLines())
+		m.refreshPane(&pane)
 		fmt.Println(pane.FormatInfo(formatter))
 	}
 }
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+func TestCommandShortcutsKeepTheirMeaning(t *testing.T) {
+	m := newManager(config.DefaultConfig(), "")
+	m.Messages = []ChatMessage{{Content: "hello", FromUser: true}}
+
+	m.ProcessSubCommand("/m plan")
+	if !m.PlanMode {
+		t.Error("/m didn't run /mode")
+	}
+	m.ProcessSubCommand("/pi 1")
+	if !m.Messages[0].Pinned {
+		t.Error("/pi didn't run /pin")
+	}
+	m.ProcessSubCommand("/unp 1")
+	if m.Messages[0].Pinned {
+		t.Error("/unp didn't run /unpin")
+	}
+
+	m.Checkpoints = []Checkpoint{{Id: 1, Label: "test"}}
+	m.ProcessSubCommand("/u")
+	if len(m.Checkpoints) != 0 {
+		t.Error("/u didn't run /undo")
+	}
+}
@@ -0,0 +1,416 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// maxSnapshotSize is the largest file that is kept in a checkpoint
+const maxSnapshotSize = 10 * 1024 * 1024
+
+// FileSnapshot is the state of a file before the agent modified it
+type FileSnapshot struct {
+	Path    string
+	Existed bool
+	Mode    fs.FileMode
+	Content []byte
+}
+
+// Checkpoint is a restore point taken before a step that modifies files
+type Checkpoint struct {
+	Id    int
+	Time  time.Time
+	Label string
+	Step  int // step of the request, the actions of a step share one checkpoint
+	Files []FileSnapshot
+	loop  *loopState // the request of the step
+}
+
+// createCheckpoint snapshots the given files before they are modified. The files of
+// further actions of the same step are added to its checkpoint, /undo reverts the step.
+func (m *Manager) createCheckpoint(label string, paths []string) {
+	checkpoint := Checkpoint{
+		Id:    len(m.Checkpoints) + 1,
+		Time:  time.Now(),
+		Label: label,
+		loop:  m.loop,
+	}
+	if m.loop != nil {
+		checkpoint.Step = m.loop.steps
+	}
+	if len(m.Checkpoints) > 0 {
+		checkpoint.Id = m.Checkpoints[len(m.Checkpoints)-1].Id + 1
+	}
+
+	seen := make(map[string]bool)
+	var last *Checkpoint
+	if n := len(m.Checkpoints); n > 0 && m.loop != nil && m.Checkpoints[n-1].loop == m.loop && m.Checkpoints[n-1].Step == checkpoint.Step {
+		// a file changed by an earlier action of the step keeps its snapshot from before the step
+		last = &m.Checkpoints[n-1]
+		for _, file := range last.Files {
+			seen[file.Path] = true
+		}
+	}
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			checkpoint.Files = append(checkpoint.Files, FileSnapshot{Path: path})
+			continue
+		case err != nil:
+			logger.Error("Failed to stat %s for checkpoint: %v", path, err)
+			continue
+		case !info.Mode().IsRegular():
+			continue
+		case info.Size() > maxSnapshotSize:
+			logger.Info("Skipping %s in checkpoint, file is too large (%d bytes)", path, info.Size())
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("Failed to read %s for checkpoint: %v", path, err)
+			continue
+		}
+		checkpoint.Files = append(checkpoint.Files, FileSnapshot{
+			Path:    path,
+			Existed: true,
+			Mode:    info.Mode().Perm(),
+			Content: content,
+		})
+	}
+
+	if len(checkpoint.Files) == 0 {
+		return
+	}
+	if last != nil {
+		last.Label += "; " + label
+		last.Files = append(last.Files, checkpoint.Files...)
+		logger.Debug("Added %d file(s) of %s to checkpoint %d", len(checkpoint.Files), label, last.Id)
+		return
+	}
+	m.Checkpoints = append(m.Checkpoints, checkpoint)
+	logger.Debug("Created checkpoint %d (%s) with %d file(s)", checkpoint.Id, label, len(checkpoint.Files))
+}
+
+// checkpointCommand snapshots the files a confirmed command is likely to modify
+func (m *Manager) checkpointCommand(command string) {
+	cwd, err := m.execPaneDir()
+	if err != nil {
+		logger.Error("Failed to get exec pane directory for checkpoint: %v", err)
+		return
+	}
+	if paths := guessTouchedFiles(command, cwd); len(paths) > 0 {
+		m.createCheckpoint("ExecCommand: "+command, paths)
+	}
+}
+
+// undoCheckpoint restores the files of the last checkpoint and removes it
+func (m *Manager) undoCheckpoint() {
+	if len(m.Checkpoints) == 0 {
+		m.Println("Nothing to undo")
+		return
+	}
+
+	checkpoint := m.Checkpoints[len(m.Checkpoints)-1]
+	var restored []string
+	for _, file := range checkpoint.Files {
+		if err := file.restore(); err != nil {
+			m.Println(fmt.Sprintf("Failed to restore %s: %v", file.Path, err))
+			continue
+		}
+		restored = append(restored, file.Path)
+	}
+	m.Checkpoints = m.Checkpoints[:len(m.Checkpoints)-1]
+
+	m.Println(fmt.Sprintf("Restored checkpoint %d (%s):", checkpoint.Id, checkpoint.Label))
+	for _, path := range restored {
+		fmt.Println("  " + path)
+	}
+
+	// let the AI know its changes are gone
+	if len(restored) > 0 {
+		m.Messages = append(m.Messages, ChatMessage{
+			Content:   "I have undone your changes to these files: " + strings.Join(restored, ", "),
+			FromUser:  true,
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// restore writes the snapshot back, removing files that didn't exist
+func (f FileSnapshot) restore() error {
+	if !f.Existed {
+		if err := os.Remove(f.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(f.Path, f.Content, f.Mode)
+}
+
+// formatCheckpoints lists restore points with the diff each one would revert
+func (m *Manager) formatCheckpoints() {
+	if len(m.Checkpoints) == 0 {
+		m.Println("No checkpoints in this session")
+		return
+	}
+
+	formatter := system.NewInfoFormatter()
+	for i := len(m.Checkpoints) - 1; i >= 0; i-- {
+		checkpoint := m.Checkpoints[i]
+		fmt.Println(formatter.FormatSection(fmt.Sprintf("Checkpoint %d  %s  %s", checkpoint.Id, checkpoint.Time.Format("15:04:05"), checkpoint.Label)))
+		for _, file := range checkpoint.Files {
+			current, err := os.ReadFile(file.Path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				fmt.Println(formatter.ErrorColor.Sprintf("%s: %v", file.Path, err))
+				continue
+			}
+
+			oldName := file.Path
+			if !file.Existed {
+				oldName = "/dev/null"
+			}
+			newName := file.Path
+			if current == nil {
+				newName = "/dev/null"
+			}
+			diff := system.UnifiedDiff(oldName, newName, string(file.Content), string(current))
+			if diff == "" {
+				fmt.Println(formatter.NeutralColor.Sprintf("%s: unchanged", file.Path))
+				continue
+			}
+			code, _ := system.HighlightCode("diff", diff)
+			fmt.Println(code)
+		}
+	}
+}
+
+// guessTouchedFiles returns the files a shell command is likely to create or modify
+func guessTouchedFiles(command, cwd string) []string {
+	var paths []string
+	add := func(path string) {
+		if path == "" || strings.HasPrefix(path, "&") || strings.HasPrefix(path, "/dev/") || strings.ContainsAny(path, "*?$`") {
+			return
+		}
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwd, path)
+		}
+		paths = append(paths, filepath.Clean(path))
+	}
+
+	for _, words := range splitShellCommands(command) {
+		var args []string
+		for i := 0; i < len(words); i++ {
+			word := words[i]
+			switch {
+			case word == ">" || word == ">>" || word == "&>" || word == "1>" || word == "2>":
+				if i+1 < len(words) {
+					add(words[i+1])
+					i++
+				}
+			case strings.HasPrefix(word, ">"):
+				add(strings.TrimLeft(word, ">"))
+			default:
+				args = append(args, word)
+			}
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		name := filepath.Base(args[0])
+		if name == "sudo" && len(args) > 1 {
+			args = args[1:]
+			name = filepath.Base(args[0])
+		}
+		var operands []string
+		for _, arg := range args[1:] {
+			if !strings.HasPrefix(arg, "-") {
+				operands = append(operands, arg)
+			}
+		}
+
+		switch name {
+		case "tee", "touch", "rm", "truncate", "vim", "vi", "nvim", "nano", "emacs":
+			for _, operand := range operands {
+				add(operand)
+			}
+		case "sed", "perl":
+			if !hasInPlaceFlag(args[1:]) {
+				continue
+			}
+			for _, file := range scriptFiles(name, args[1:]) {
+				add(file)
+			}
+		case "mv", "cp":
+			if len(operands) < 2 {
+				continue
+			}
+			target := operands[len(operands)-1]
+			sources := operands[:len(operands)-1]
+			targetPath := target
+			if !filepath.IsAbs(targetPath) {
+				targetPath = filepath.Join(cwd, targetPath)
+			}
+			info, err := os.Stat(targetPath)
+			for _, source := range sources {
+				if name == "mv" {
+					add(source)
+				}
+				if err == nil && info.IsDir() {
+					add(filepath.Join(target, filepath.Base(source)))
+				}
+			}
+			if err != nil || !info.IsDir() {
+				add(target)
+			}
+		}
+	}
+	return paths
+}
+
+func hasInPlaceFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--in-place" || strings.HasPrefix(arg, "--in-place=") ||
+			(strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "i")) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptFiles returns the file operands of sed or perl. The script is the argument of -e
+// (or -f for sed), attached like -es/a/b/ or the next argument, otherwise the first operand.
+func scriptFiles(name string, args []string) []string {
+	var operands []string
+	hasScript := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--expression" || arg == "--file":
+			hasScript = true
+			i++
+		case strings.HasPrefix(arg, "--expression=") || strings.HasPrefix(arg, "--file="):
+			hasScript = true
+		case strings.HasPrefix(arg, "--"):
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			flags := arg[1:]
+			// the rest of -i.bak is the backup suffix
+			if j := strings.IndexByte(flags, 'i'); j >= 0 {
+				flags = flags[:j+1]
+			}
+			scriptFlags := "e"
+			if name == "sed" {
+				scriptFlags = "ef"
+			}
+			j := strings.IndexAny(flags, scriptFlags)
+			if j < 0 {
+				continue
+			}
+			hasScript = true
+			if j == len(flags)-1 && flags == arg[1:] {
+				i++
+			}
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	if !hasScript && len(operands) > 0 {
+		operands = operands[1:]
+	}
+	return operands
+}
+
+// splitShellCommands splits a command line into the words of its simple commands.
+// It understands quotes, escapes and the ; && || | & separators, redirections are kept as words.
+func splitShellCommands(command string) [][]string {
+	var commands [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	flushWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	flushCommand := func() {
+		flushWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = nil
+		}
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			word.WriteRune(runes[i+1])
+			inWord = true
+			i++
+		case r == '\'' || r == '"':
+			inWord = true
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if r == '"' && runes[end] == '\\' && end+1 < len(runes) {
+					end++
+				}
+				word.WriteRune(runes[end])
+				end++
+			}
+			i = end
+		case r == ' ' || r == '\t' || r == '\n':
+			flushWord()
+		case r == ';' || r == '|' || (r == '&' && (i == 0 || runes[i-1] != '>') && (i+1 >= len(runes) || runes[i+1] != '>')):
+			flushCommand()
+			if i+1 < len(runes) && runes[i+1] == r {
+				i++
+			}
+		case r == '>':
+			// keep "2>" and "&>" together with the operator
+			prefix := ""
+			if inWord && (word.String() == "1" || word.String() == "2" || word.String() == "&") {
+				prefix = word.String()
+				word.Reset()
+				inWord = false
+			}
+			flushWord()
+			op := prefix + ">"
+			if i+1 < len(runes) && runes[i+1] == '>' {
+				op = ">>"
+				i++
+			}
+			words = append(words, op)
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	flushCommand()
+	return commands
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGuessTouchedFiles(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.Mkdir(filepath.Join(cwd, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	abs := func(p string) string { return filepath.Join(cwd, p) }
+
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"ls -la", nil},
+		{"echo hi > out.txt", []string{abs("out.txt")}},
+		{"make build 2>&1 | tee build.log", []string{abs("build.log")}},
+		{"cat a >> 'b c.txt' && rm -f x.txt", []string{abs("b c.txt"), abs("x.txt")}},
+		{"sed -i 's/a/b/' main.go", []string{abs("main.go")}},
+		{"sed 's/a/b/' main.go", nil},
+		{"sed -i -e 's/a/b/' -e 's/c/d/' main.go", []string{abs("main.go")}},
+		{"sed -i -f fix.sed a.go b.go", []string{abs("a.go"), abs("b.go")}},
+		{"sed -i.bak --expression='s/a/b/' main.go", []string{abs("main.go")}},
+		{"perl -pi -e 's/a/b/' main.go", []string{abs("main.go")}},
+		{"mv old.txt new.txt", []string{abs("old.txt"), abs("new.txt")}},
+		{"cp a.txt dir", []string{abs("dir/a.txt")}},
+		{"go test ./... > /dev/null", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got := guessTouchedFiles(tt.command, cwd)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointUndo(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.txt")
+	created := filepath.Join(dir, "created.txt")
+	if err := os.WriteFile(existing, []byte("before"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{}
+	m.createCheckpoint("test", []string{existing, created})
+	os.WriteFile(existing, []byte("after"), 0o600)
+	os.WriteFile(created, []byte("new"), 0o600)
+
+	m.undoCheckpoint()
+
+	content, _ := os.ReadFile(existing)
+	if string(content) != "before" {
+		t.Errorf("expected existing file to be restored, got %q", content)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("expected created file to be removed")
+	}
+	if len(m.Checkpoints) != 0 {
+		t.Errorf("expected checkpoint to be removed")
+	}
+}
+
+func TestCheckpointGroupsStep(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("a0"), 0o600)
+
+	m := &Manager{loop: &loopState{steps: 1}}
+	m.createCheckpoint("write a", []string{a})
+	os.WriteFile(a, []byte("a1"), 0o600)
+	m.createCheckpoint("write a and b", []string{a, b})
+	os.WriteFile(a, []byte("a2"), 0o600)
+	os.WriteFile(b, []byte("b1"), 0o600)
+	if len(m.Checkpoints) != 1 || len(m.Checkpoints[0].Files) != 2 {
+		t.Fatalf("checkpoints of one step = %+v", m.Checkpoints)
+	}
+
+	m.loop.steps = 2
+	m.createCheckpoint("write b", []string{b})
+	os.WriteFile(b, []byte("b2"), 0o600)
+	if len(m.Checkpoints) != 2 {
+		t.Fatalf("expected a checkpoint per step, got %d", len(m.Checkpoints))
+	}
+	// step 2 of the next request has a checkpoint of its own
+	m.loop = &loopState{steps: 2}
+	m.createCheckpoint("write b again", []string{b})
+	if len(m.Checkpoints) != 3 {
+		t.Fatalf("expected a checkpoint per request, got %d", len(m.Checkpoints))
+	}
+	m.undoCheckpoint()
+
+	m.undoCheckpoint()
+	if content, _ := os.ReadFile(b); string(content) != "b1" {
+		t.Errorf("b after undoing step 2 = %q", content)
+	}
+	m.undoCheckpoint()
+	if content, _ := os.ReadFile(a); string(content) != "a0" {
+		t.Errorf("a after undoing step 1 = %q", content)
+	}
+	if _, err := os.Stat(b); !os.IsNotExist(err) {
+		t.Error("b created in step 1 wasn't removed")
+	}
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/system"
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `Usage:
+  /config                          show the config and where each value comes from
+  /config get <key>                show a value
+  /config set <key> <value>        override a value for this session
+  /config set <key> += <value>     append to a list
+  /config set <key> -= <value>     remove from a list
+  /config reset [key]              drop the overrides of a key, or all of them
+  /config save [global|project|session]  write the overrides to a config file`
+
+// configOriginal is the value of a key before the session overrode it
+type configOriginal struct {
+	value any
+	set   bool // false for a map entry that didn't exist
+}
+
+// configCommand runs /config and its subcommands, values keep their case
+func (m *Manager) configCommand(command string) {
+	args := strings.Fields(command)[1:]
+	if len(args) == 0 {
+		code, _ := system.HighlightCode("yaml", m.FormatConfig())
+		fmt.Println(code)
+		return
+	}
+	key := ""
+	if len(args) > 1 {
+		key = strings.ToLower(args[1])
+	}
+
+	var err error
+	switch strings.ToLower(args[0]) {
+	case "get":
+		if key == "" {
+			m.Println("Usage: /config get <key>")
+			return
+		}
+		err = m.printConfigValue(key)
+	case "set":
+		if len(args) < 3 {
+			m.Println("Usage: /config set <key> <value>")
+			return
+		}
+		err = m.setConfig(key, commandRest(command, 3))
+	case "reset":
+		err = m.resetConfig(key)
+	case "save":
+		err = m.saveConfig(key)
+	default:
+		m.Println(configUsage)
+		return
+	}
+	if err != nil {
+		m.Println(err.Error())
+	}
+}
+
+// commandRest returns the text of a command after its first n words, spaces within it are kept
+func commandRest(command string, n int) string {
+	rest := strings.TrimSpace(command)
+	for i := 0; i < n; i++ {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		rest = strings.TrimLeftFunc(rest[end:], unicode.IsSpace)
+	}
+	return strings.TrimRightFunc(rest, unicode.IsSpace)
+}
+
+// printConfigValue prints the effective value of a key and the layer it comes from
+func (m *Manager) printConfigValue(key string) error {
+	value, err := config.Get(m.Config, key)
+	if err != nil {
+		return err
+	}
+	if override, ok := m.SessionOverrides[key]; ok {
+		value = override
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Struct {
+		var sb strings.Builder
+		sb.WriteString(key + ":\n")
+		formatConfigValue(&sb, key, v, m.SessionOverrides, m.Config.Layers, 2)
+		code, _ := system.HighlightCode("yaml", sb.String())
+		fmt.Println(code)
+		return nil
+	}
+
+	source := m.Config.Layers.Source(key)
+	if _, ok := m.SessionOverrides[key]; ok {
+		source = "/config set"
+	}
+	if strings.HasSuffix(key, "api_key") {
+		value = maskAPIKey(fmt.Sprint(value))
+	}
+	fmt.Printf("%s: %v # %s\n", key, value, source)
+	return nil
+}
+
+// setConfig overrides a key for the session. raw is parsed as YAML unless the key is a
+// string, "+= item" and "-= item" change a list.
+func (m *Manager) setConfig(key string, raw string) error {
+	current, err := config.Get(m.Config, key)
+	exists := err == nil
+
+	var value any
+	switch {
+	case strings.HasPrefix(raw, "+=") || strings.HasPrefix(raw, "-="):
+		list, ok := current.([]string)
+		if !exists || !ok {
+			return fmt.Errorf("%s is not a list", key)
+		}
+		items := parseListItems(strings.TrimSpace(raw[2:]))
+		if raw[0] == '+' {
+			value = append(slices.Clone(list), items...)
+		} else {
+			remaining := slices.DeleteFunc(slices.Clone(list), func(item string) bool { return slices.Contains(items, item) })
+			if len(remaining) == len(list) {
+				return fmt.Errorf("%s doesn't contain %s", key, strings.Join(items, ", "))
+			}
+			value = remaining
+		}
+	case exists && reflect.TypeOf(current).Kind() == reflect.String:
+		value = raw
+	default:
+		value = parseConfigValue(raw)
+	}
+
+	original, overridden := m.configOriginals[key]
+	if !overridden {
+		original = configOriginal{value: current, set: exists}
+	}
+	if err := config.Set(m.Config, key, value); err != nil {
+		return err
+	}
+	if m.configOriginals == nil {
+		m.configOriginals = make(map[string]configOriginal)
+	}
+	m.configOriginals[key] = original
+	m.SessionOverrides[key], _ = config.Get(m.Config, key)
+
+	shown := m.SessionOverrides[key]
+	if strings.HasSuffix(key, "api_key") {
+		shown = maskAPIKey(fmt.Sprint(shown))
+	}
+	m.Println(fmt.Sprintf("Set %s = %v", key, shown))
+	return nil
+}
+
+// parseConfigValue parses a value like in a config file, text that isn't YAML stays a string
+func parseConfigValue(raw string) any {
+	var value any
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil || value == nil {
+		return raw
+	}
+	return value
+}
+
+// parseListItems returns the items of a YAML list like [a, b], or the text as one item
+func parseListItems(raw string) []string {
+	if strings.HasPrefix(raw, "[") {
+		var items []string
+		if err := yaml.Unmarshal([]byte(raw), &items); err == nil {
+			return items
+		}
+	}
+	return []string{raw}
+}
+
+// resetConfig drops the overrides of a key and of the keys below it, all of them if key is empty
+func (m *Manager) resetConfig(key string) error {
+	var keys []string
+	for k := range m.SessionOverrides {
+		if key == "" || k == key || strings.HasPrefix(k, key+".") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		if key == "" {
+			return fmt.Errorf("no overrides to reset")
+		}
+		return fmt.Errorf("%s is not overridden", key)
+	}
+	// keys below others first, a reset section doesn't bring back its entries
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, k := range keys {
+		if original, ok := m.configOriginals[k]; ok {
+			if original.set {
+				config.Set(m.Config, k, original.value)
+			} else {
+				config.Delete(m.Config, k)
+			}
+			delete(m.configOriginals, k)
+		}
+		delete(m.SessionOverrides, k)
+	}
+	sort.Strings(keys)
+	m.Println("Reset " + strings.Join(keys, ", "))
+	return nil
+}
+
+// saveConfig writes the values changed with /config set to the config file of a layer,
+// the global one by default. Overrides of a task or an eval run aren't saved.
+func (m *Manager) saveConfig(layer string) error {
+	values := make(map[string]any)
+	var skipped []string
+	for key := range m.configOriginals {
+		// a project file is usually committed and these keys are ignored there
+		if layer == config.LayerProject && config.ProjectBlocked(key) {
+			skipped = append(skipped, key)
+			continue
+		}
+		value, ok := m.SessionOverrides[key]
+		if m.task != nil {
+			// the task overrode the key again, save the value it replaced
+			if previous, overridden := m.task.overrides[key]; overridden {
+				value, ok = previous.value, previous.set
+			}
+		}
+		if ok {
+			values[key] = value
+		}
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		m.Println(fmt.Sprintf("Not saved, a project file can't set %s: save them to the global or session layer", strings.Join(skipped, ", ")))
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("no overrides to save, change values with /config set")
+	}
+	path, err := m.configLayerFile(layer)
+	if err != nil {
+		return err
+	}
+	if err := config.SaveValues(path, values); err != nil {
+		return fmt.Errorf("failed to save the config: %w", err)
+	}
+	m.Println(fmt.Sprintf("Saved %d values to %s", len(values), path))
+	return nil
+}
+
+// configLayerFile returns the file of a config layer, where it would be created if there is none
+func (m *Manager) configLayerFile(layer string) (string, error) {
+	if layer == "" {
+		layer = config.LayerGlobal
+	}
+	if m.Config.Layers != nil {
+		for _, file := range m.Config.Layers.Files {
+			if file.Layer == layer && layer != config.LayerSession {
+				return file.Path, nil
+			}
+		}
+	}
+
+	switch layer {
+	case config.LayerGlobal:
+		return config.GetConfigFilePath("config.yaml"), nil
+	case config.LayerProject:
+		dir, err := m.execPaneDir()
+		if err != nil || dir == "" {
+			return "", fmt.Errorf("the exec pane's directory is unknown")
+		}
+		if root := gitRoot(dir); root != "" {
+			dir = root
+		}
+		return filepath.Join(dir, config.ProjectConfigFile), nil
+	case config.LayerSession:
+		session := ""
+		if m.Config.Layers != nil {
+			session = m.Config.Layers.Session
+		}
+		if session == "" && m.ExecPane != nil && m.ExecPane.Id != "" {
+			session, _ = m.Tmux.SessionName(m.ExecPane.Id)
+		}
+		if session == "" {
+			return "", fmt.Errorf("the tmux session is unknown")
+		}
+		return config.GetConfigFilePath(filepath.Join("sessions", session+".yaml")), nil
+	}
+	return "", fmt.Errorf("unknown layer %s, use global, project or session", layer)
+}
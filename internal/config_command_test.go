@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+func TestConfigSetAndReset(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WhitelistPatterns = []string{"^ls"}
+	m := newManager(cfg, "")
+
+	m.configCommand("/config set whitelist_patterns += ^git status")
+	m.configCommand("/config set whitelist_patterns += [^make, ^go test]")
+	m.configCommand("/config set whitelist_patterns -= ^ls")
+	if want := []string{"^git status", "^make", "^go test"}; !slices.Equal(cfg.WhitelistPatterns, want) {
+		t.Errorf("whitelist = %q, want %q", cfg.WhitelistPatterns, want)
+	}
+	m.configCommand("/config set openrouter.model Vendor/Model-X")
+	m.configCommand("/config set limits.max_steps 5")
+	m.configCommand("/config set capture.panes.%3 ansi")
+	if m.GetOpenRouterModel() != "Vendor/Model-X" || m.GetMaxSteps() != 5 || cfg.Capture.Panes["%3"] != "ansi" {
+		t.Errorf("model %q, max steps %d, panes %v", m.GetOpenRouterModel(), m.GetMaxSteps(), cfg.Capture.Panes)
+	}
+	if err := m.setConfig("limits.max_steps", "many"); err == nil {
+		t.Error("set an int to text")
+	}
+
+	m.configCommand("/config reset limits")
+	if cfg.Limits.MaxSteps != 30 || m.GetMaxSteps() != 30 {
+		t.Errorf("max steps after reset = %d", m.GetMaxSteps())
+	}
+	m.configCommand("/config reset")
+	if !slices.Equal(cfg.WhitelistPatterns, []string{"^ls"}) || len(cfg.Capture.Panes) != 0 || len(m.SessionOverrides) != 0 {
+		t.Errorf("after reset: whitelist %q, panes %v, overrides %v", cfg.WhitelistPatterns, cfg.Capture.Panes, m.SessionOverrides)
+	}
+}
+
+func TestApplyConfigLayersUsesTmuxBackend(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	sessions := filepath.Join(home, ".config", "tmuxai", "sessions")
+	os.MkdirAll(sessions, 0755)
+	os.WriteFile(filepath.Join(sessions, "ops.yaml"), []byte("wait_interval: 9\n"), 0644)
+
+	dir := t.TempDir()
+	cfg, err := config.LoadFor(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := system.NewFakeTmux()
+	fake.AddPane("bash").Cwd = dir
+	m, err := newHeadlessManager(cfg, fake, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake has no session, the session of the real tmux server doesn't matter
+	m.applyConfigLayers()
+	if m.Config.WaitInterval != 5 {
+		t.Errorf("wait interval without a session = %d", m.Config.WaitInterval)
+	}
+	fake.Session = "ops"
+	m.applyConfigLayers()
+	if m.Config.WaitInterval != 9 || m.Config.Layers.Session != "ops" {
+		t.Errorf("wait interval in session ops = %d", m.Config.WaitInterval)
+	}
+}
+
+func TestApplyConfigLayersKeepsOverrides(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+	os.WriteFile(filepath.Join(project, config.ProjectConfigFile), []byte("wait_interval: 3\nmax_capture_lines: 100\n"), 0644)
+
+	cfg, err := config.LoadFor(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	m, err := newHeadlessManager(cfg, fake, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.configCommand("/config set max_capture_lines 50")
+
+	// the exec pane changed directory since the last request
+	pane.Cwd = project
+	m.applyConfigLayers()
+	if m.Config.WaitInterval != 3 || m.Config.MaxCaptureLines != 50 {
+		t.Errorf("wait interval %d, max capture lines %d", m.Config.WaitInterval, m.Config.MaxCaptureLines)
+	}
+	m.configCommand("/config reset max_capture_lines")
+	if m.Config.MaxCaptureLines != 100 {
+		t.Errorf("max capture lines after reset = %d, want the project's 100", m.Config.MaxCaptureLines)
+	}
+}
+
+func TestConfigSaveOnlyWritesSetValues(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	m := newManager(config.DefaultConfig(), "")
+	m.SessionOverrides["openrouter.model"] = "eval/model"
+
+	m.configCommand("/config set limits.max_steps 5")
+	if err := m.saveConfig("global"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".config", "tmuxai", "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "limits:\n  max_steps: 5\n" {
+		t.Errorf("saved config:\n%s", got)
+	}
+	if info, err := os.Stat(filepath.Join(home, ".config", "tmuxai", "config.yaml")); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("config mode = %v", info.Mode())
+	}
+}
+
+func TestConfigSaveProjectSkipsSecurityKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Cwd = t.TempDir()
+	m := newFakeManager(t, fake, "")
+
+	m.configCommand("/config set openrouter.api_key sk-secret")
+	m.configCommand("/config set whitelist_patterns .*")
+	if err := m.saveConfig("project"); err == nil {
+		t.Error("saved only security keys to the project file")
+	}
+	m.configCommand("/config set limits.max_steps 5")
+	if err := m.saveConfig("project"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(pane.Cwd, config.ProjectConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "limits:\n  max_steps: 5\n" {
+		t.Errorf("saved project config:\n%s", got)
+	}
+}
+
+func TestCaptureModeSessionOverrideWins(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Capture.Panes["cargo"] = "ansi"
+	m := newManager(cfg, "")
+	pane := system.TmuxPaneDetails{Id: "%3", CurrentCommand: "cargo"}
+
+	if mode := m.GetCaptureMode(pane); mode != "ansi" {
+		t.Errorf("per pane mode of the config = %s", mode)
+	}
+	m.configCommand("/config set capture.mode plain")
+	if mode := m.GetCaptureMode(pane); mode != "plain" {
+		t.Errorf("mode with a session override = %s", mode)
+	}
+	m.configCommand("/config set capture.panes.%3 ansi")
+	if mode := m.GetCaptureMode(pane); mode != "ansi" {
+		t.Errorf("mode with a per pane session override = %s", mode)
+	}
+}
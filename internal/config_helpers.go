@@ -4,18 +4,11 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
-)
 
-// AllowedConfigKeys defines the list of configuration keys that users are allowed to modify
-var AllowedConfigKeys = []string{
-	"max_capture_lines",
-	"max_context_size",
-	"wait_interval",
-	"send_keys_confirm",
-	"paste_multiline_confirm",
-	"exec_confirm",
-	"openrouter.model",
-}
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
 
 // GetMaxCaptureLines returns the max capture lines value with session override if present
 func (m *Manager) GetMaxCaptureLines() int {
@@ -47,6 +40,56 @@ func (m *Manager) GetWaitInterval() int {
 	return m.Config.WaitInterval
 }
 
+// GetVerifyAttempts returns how many failed success checks end a request
+func (m *Manager) GetVerifyAttempts() int {
+	if override, exists := m.SessionOverrides["verify_attempts"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	return m.Config.VerifyAttempts
+}
+
+// GetMaxSteps returns the maximum number of AI responses per request
+func (m *Manager) GetMaxSteps() int {
+	if override, exists := m.SessionOverrides["limits.max_steps"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	return m.Config.Limits.MaxSteps
+}
+
+// GetMaxGuidelineRetries returns the maximum number of consecutive responses not following the guidelines
+func (m *Manager) GetMaxGuidelineRetries() int {
+	if override, exists := m.SessionOverrides["limits.max_guideline_retries"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	return m.Config.Limits.MaxGuidelineRetries
+}
+
+// GetMaxDuration returns the maximum running time of a request in seconds
+func (m *Manager) GetMaxDuration() int {
+	if override, exists := m.SessionOverrides["limits.max_duration"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	return m.Config.Limits.MaxDuration
+}
+
+// GetMaxTokens returns the maximum number of tokens per request
+func (m *Manager) GetMaxTokens() int {
+	if override, exists := m.SessionOverrides["limits.max_tokens"]; exists {
+		if val, ok := override.(int); ok {
+			return val
+		}
+	}
+	return m.Config.Limits.MaxTokens
+}
+
 func (m *Manager) GetSendKeysConfirm() bool {
 	if override, exists := m.SessionOverrides["send_keys_confirm"]; exists {
 		if val, ok := override.(bool); ok {
@@ -74,6 +117,36 @@ func (m *Manager) GetExecConfirm() bool {
 	return m.Config.ExecConfirm
 }
 
+// GetRedactPanes returns whether captured pane content is redacted, with session override if present
+func (m *Manager) GetRedactPanes() bool {
+	if override, exists := m.SessionOverrides["redact_panes"]; exists {
+		if val, ok := override.(bool); ok {
+			return val
+		}
+	}
+	return m.Config.RedactPanes
+}
+
+// GetCaptureMode returns the capture mode for the given pane. Session overrides win over
+// the config files, and per pane settings (by pane id or current command) over the global mode.
+func (m *Manager) GetCaptureMode(pane system.TmuxPaneDetails) string {
+	keys := []string{"capture.panes." + pane.Id, "capture.panes." + strings.ToLower(pane.CurrentCommand), "capture.mode"}
+	for _, key := range keys {
+		if override, exists := m.SessionOverrides[key]; exists {
+			if val, ok := override.(string); ok {
+				return val
+			}
+		}
+	}
+	if mode, ok := m.Config.Capture.Panes[pane.Id]; ok {
+		return mode
+	}
+	if mode, ok := m.Config.Capture.Panes[strings.ToLower(pane.CurrentCommand)]; ok {
+		return mode
+	}
+	return m.Config.Capture.Mode
+}
+
 func (m *Manager) GetOpenRouterModel() string {
 	if override, exists := m.SessionOverrides["openrouter.model"]; exists {
 		if val, ok := override.(string); ok {
@@ -83,15 +156,40 @@ func (m *Manager) GetOpenRouterModel() string {
 	return m.Config.OpenRouter.Model
 }
 
-// FormatConfig returns a nicely formatted string of all config values with session overrides applied
+// GetSquashModel returns the model that summarizes the chat history
+func (m *Manager) GetSquashModel() string {
+	if override, exists := m.SessionOverrides["squash.model"]; exists {
+		if val, ok := override.(string); ok && val != "" {
+			return val
+		}
+	}
+	if m.Config.Squash.Model != "" {
+		return m.Config.Squash.Model
+	}
+	return m.GetOpenRouterModel()
+}
+
+// FormatConfig returns a nicely formatted string of all config values with session overrides applied.
+// Values not set by the defaults are followed by the layer they come from.
 func (m *Manager) FormatConfig() string {
 	var result strings.Builder
-	formatConfigValue(&result, "", reflect.ValueOf(m.Config).Elem(), m.SessionOverrides, 1)
+	if layers := m.Config.Layers; layers != nil {
+		for _, file := range layers.Files {
+			result.WriteString(fmt.Sprintf("# %s: %s\n", file.Layer, file.Path))
+		}
+		if layers.Session != "" {
+			result.WriteString(fmt.Sprintf("# tmux session: %s\n", layers.Session))
+		}
+		if len(layers.Ignored) > 0 {
+			result.WriteString(fmt.Sprintf("# ignored in the project file: %s\n", strings.Join(layers.Ignored, ", ")))
+		}
+	}
+	formatConfigValue(&result, "", reflect.ValueOf(m.Config).Elem(), m.SessionOverrides, m.Config.Layers, 1)
 	return result.String()
 }
 
 // formatConfigValue recursively formats config values using reflection
-func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, overrides map[string]interface{}, indent int) {
+func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, overrides map[string]interface{}, layers *config.Layers, indent int) {
 	typ := val.Type()
 
 	indentStr := ""
@@ -105,6 +203,9 @@ func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, ov
 
 		// Get the field name from mapstructure tag or use field name
 		tag := fieldType.Tag.Get("mapstructure")
+		if tag == "-" {
+			continue
+		}
 		if tag == "" {
 			tag = strings.ToLower(fieldType.Name)
 		}
@@ -118,7 +219,7 @@ func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, ov
 		// Handle nested structs
 		if field.Kind() == reflect.Struct {
 			sb.WriteString(fmt.Sprintf("%s%s:\n", indentStr, tag))
-			formatConfigValue(sb, key, field, overrides, indent+1)
+			formatConfigValue(sb, key, field, overrides, layers, indent+1)
 			continue
 		}
 
@@ -143,16 +244,61 @@ func formatConfigValue(sb *strings.Builder, prefix string, val reflect.Value, ov
 		}
 
 		// Check if there's a session override for this key
+		source := layers.Source(key)
 		if override, exists := overrides[key]; exists {
 			sb.WriteString(fmt.Sprintf("%s%s: %v", indentStr, tag, override))
+			source = "/config set"
 		} else {
 			sb.WriteString(fmt.Sprintf("%s%s: %s", indentStr, tag, valueStr))
 		}
+		if source != config.LayerDefault {
+			sb.WriteString(" # " + source)
+		}
 
 		sb.WriteString("\n")
 	}
 }
 
+// applyConfigLayers loads the config again when the exec pane moved to another directory or
+// tmux session, so the project and session layers match the exec pane. It runs before each
+// request, the session overrides stay on top of the new layers.
+func (m *Manager) applyConfigLayers() {
+	layers := m.Config.Layers
+	if layers == nil || m.ExecPane == nil || m.ExecPane.Id == "" {
+		return
+	}
+	dir, err := m.execPaneDir()
+	if err != nil {
+		dir = layers.Dir
+	}
+	session, err := m.Tmux.SessionName(m.ExecPane.Id)
+	if err != nil {
+		session = layers.Session
+	}
+	if dir == layers.Dir && session == layers.Session {
+		return
+	}
+	cfg, err := config.LoadFor(dir, session)
+	if err != nil {
+		logger.Error("Failed to load the config of the exec pane: %v", err)
+		return
+	}
+	for key, value := range m.SessionOverrides {
+		if _, ok := m.configOriginals[key]; ok {
+			// /config reset goes back to the value of the new layers
+			current, err := config.Get(cfg, key)
+			m.configOriginals[key] = configOriginal{value: current, set: err == nil}
+		}
+		if err := config.Set(cfg, key, value); err != nil {
+			logger.Debug("Session override %s not applied to the loaded config: %v", key, err)
+		}
+	}
+	logger.Info("Loaded the config for %s in tmux session %s", dir, session)
+	// in place, the AI client keeps a pointer to the OpenRouter settings
+	*m.Config = *cfg
+	m.UserCommands = LoadUserCommands(m.Config)
+}
+
 // maskAPIKey hides most of the API key for security
 func maskAPIKey(key string) string {
 	if len(key) <= 8 {
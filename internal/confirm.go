@@ -15,6 +15,29 @@ func (m *Manager) confirmedToExec(command string, prompt string, edit bool) (boo
 		return true, command
 	}
 
+	return m.askConfirmation(command, prompt, edit)
+}
+
+// askConfirmation asks the user to confirm (and optionally edit) an action.
+// The answer is recorded, and taken from the recording during a replay.
+func (m *Manager) askConfirmation(command string, prompt string, edit bool) (bool, string) {
+	if m.replay != nil {
+		return m.replay.confirmation(prompt, command)
+	}
+	ok, result := m.promptConfirmation(command, prompt, edit)
+	if m.recorder != nil {
+		m.recorder.write(recordEvent{Type: eventConfirm, Confirm: &recordConfirm{Prompt: prompt, Command: command, Approved: ok, Result: result}})
+	}
+	return ok, result
+}
+
+// promptConfirmation reads the answer to a confirmation from the user
+func (m *Manager) promptConfirmation(command string, prompt string, edit bool) (bool, string) {
+	if !m.Interactive {
+		m.Println(fmt.Sprintf("%s Declined, confirmation is not possible in non-interactive mode: %s", prompt, command))
+		return false, ""
+	}
+
 	promptColor := color.New(color.FgHiCyan)
 
 	var promptText string
@@ -94,7 +117,7 @@ func (m *Manager) confirmedToExec(command string, prompt string, edit bool) (boo
 		}
 	default:
 		// any other input is retry confirmation
-		return m.confirmedToExec(command, prompt, edit)
+		return m.promptConfirmation(command, prompt, edit)
 	}
 }
 
@@ -0,0 +1,412 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// maxControlRequestSize is the largest request line accepted on the control socket
+const maxControlRequestSize = 1024 * 1024
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"` // notifications only
+	Result  any             `json:"result,omitempty"`
+	Params  any             `json:"params,omitempty"` // notifications only
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// ControlStatus is the result of the status method
+type ControlStatus struct {
+	Status     string `json:"status"`
+	WatchMode  bool   `json:"watch_mode"`
+	PlanMode   bool   `json:"plan_mode"`
+	PaneId     string `json:"pane_id"`
+	ExecPaneId string `json:"exec_pane_id"`
+	Messages   int    `json:"messages"`
+	Queued     int    `json:"queued"`
+}
+
+// ControlResult is the result of the send_message and command methods
+type ControlResult struct {
+	Status  RunStatus `json:"status,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Queued  bool      `json:"queued,omitempty"`
+}
+
+// controlJob is user input received on the socket, run by the chat loop
+type controlJob struct {
+	input string
+	done  chan ControlResult
+}
+
+// ControlServer serves the JSON-RPC control API of a running instance on a Unix socket.
+// Requests that run the agent are queued and executed by the chat loop, so the manager
+// is only used from one goroutine. Queries are answered from a snapshot taken by the chat loop.
+type ControlServer struct {
+	manager  *Manager
+	path     string
+	listener net.Listener
+	jobs     chan controlJob
+
+	mu          sync.Mutex
+	interrupt   func() error // closes the chat prompt so queued jobs can run
+	status      ControlStatus
+	messages    []ChatMessage
+	execHistory []CommandExecHistory
+}
+
+// ControlSocketPath returns the control socket path for the window of a pane
+func ControlSocketPath(paneId string) (string, error) {
+	key, err := system.TmuxWindowKey(paneId)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("tmuxai-%d", os.Getuid()))
+	if err := ensureSocketDir(dir); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "control-"+key+".sock"), nil
+}
+
+// ensureSocketDir creates the socket directory, an existing one must be a private directory
+// of the current user so another user can't have created it in the shared temp directory
+func ensureSocketDir(dir string) error {
+	if err := os.Mkdir(dir, 0o700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("socket directory %s is not owned by the current user", dir)
+	}
+	if info.Mode().Perm() != 0o700 {
+		return fmt.Errorf("socket directory %s has mode %o, expected 700", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// StartControlServer listens on the control socket of the manager's window
+func StartControlServer(m *Manager) (*ControlServer, error) {
+	path, err := ControlSocketPath(m.PaneId)
+	if err != nil {
+		return nil, err
+	}
+	return listenControl(m, path)
+}
+
+func listenControl(m *Manager, path string) (*ControlServer, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another tmuxai instance is listening on %s", path)
+	}
+	// a stale socket of an instance that didn't shut down cleanly
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	s := &ControlServer{
+		manager:  m,
+		path:     path,
+		listener: listener,
+		jobs:     make(chan controlJob, 16),
+	}
+	if m.Events == nil {
+		m.Events = NewEventBus()
+	}
+	m.StepHandler = func(step StepRecord) { m.Events.Publish(EventStep, step) }
+	s.Refresh()
+
+	go s.serve()
+	logger.Info("Control API listening on %s", path)
+	return s, nil
+}
+
+// Path returns the socket path
+func (s *ControlServer) Path() string {
+	return s.path
+}
+
+// Close stops the server and removes the socket
+func (s *ControlServer) Close() {
+	if s == nil {
+		return
+	}
+	s.listener.Close()
+	os.Remove(s.path)
+}
+
+// SetInterrupt sets the function closing the current chat prompt
+func (s *ControlServer) SetInterrupt(interrupt func() error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.interrupt = interrupt
+	s.mu.Unlock()
+}
+
+// Pending reports whether jobs are waiting for the chat loop
+func (s *ControlServer) Pending() bool {
+	return s != nil && len(s.jobs) > 0
+}
+
+// RunPending runs the queued jobs with the given input handler, it must be called by the chat loop
+func (s *ControlServer) RunPending(run func(input string) RunStatus) {
+	for {
+		select {
+		case job := <-s.jobs:
+			s.manager.LastMessage = ""
+			status := run(job.input)
+			s.Refresh()
+			job.done <- ControlResult{Status: status, Message: s.manager.LastMessage}
+		default:
+			return
+		}
+	}
+}
+
+// Refresh updates the snapshot used to answer queries, it must be called by the chat loop
+func (s *ControlServer) Refresh() {
+	if s == nil {
+		return
+	}
+	m := s.manager
+	status := ControlStatus{
+		Status:    m.Status,
+		WatchMode: m.WatchMode,
+		PlanMode:  m.PlanMode,
+		PaneId:    m.PaneId,
+		Messages:  len(m.Messages),
+	}
+	if m.ExecPane != nil {
+		status.ExecPaneId = m.ExecPane.Id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.messages = append([]ChatMessage{}, m.Messages...)
+	s.execHistory = append([]CommandExecHistory{}, m.ExecHistory...)
+}
+
+func (s *ControlServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("Control API accept failed: %v", err)
+			}
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn answers newline delimited JSON-RPC requests
+func (s *ControlServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	encoder := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxControlRequestSize)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			encoder.Encode(rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcParseError, "parse error: " + err.Error()}})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			encoder.Encode(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{rpcInvalidRequest, "invalid request"}})
+			continue
+		}
+
+		if req.Method == "subscribe" {
+			s.subscribe(conn, encoder, req.ID)
+			return
+		}
+
+		logger.Debug("Control API request: %s", req.Method)
+		result, err := s.call(req.Method, req.Params)
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+		if err != nil {
+			var rpcErr *rpcError
+			if !errors.As(err, &rpcErr) {
+				rpcErr = &rpcError{rpcInternalError, err.Error()}
+			}
+			resp.Result = nil
+			resp.Error = rpcErr
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// call runs a method and returns its result
+func (s *ControlServer) call(method string, rawParams json.RawMessage) (any, error) {
+	var params struct {
+		Message     string `json:"message"`
+		Command     string `json:"command"`
+		Description string `json:"description"`
+		Wait        *bool  `json:"wait"`
+		Limit       int    `json:"limit"`
+	}
+	if len(rawParams) > 0 {
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "invalid params: " + err.Error()}
+		}
+	}
+	wait := params.Wait == nil || *params.Wait
+
+	switch method {
+	case "send_message":
+		if strings.TrimSpace(params.Message) == "" {
+			return nil, &rpcError{rpcInvalidParams, "message is required"}
+		}
+		return s.enqueue(params.Message, wait), nil
+
+	case "command":
+		if !strings.HasPrefix(strings.TrimSpace(params.Command), "/") {
+			return nil, &rpcError{rpcInvalidParams, "command must start with /"}
+		}
+		return s.enqueue(params.Command, wait), nil
+
+	case "watch_start":
+		if strings.TrimSpace(params.Description) == "" {
+			return nil, &rpcError{rpcInvalidParams, "description is required"}
+		}
+		// watch mode runs until it is stopped, don't wait for it
+		return s.enqueue("/watch "+params.Description, false), nil
+
+	case "watch_stop":
+		// same as Ctrl+C in the chat pane, the watch loop stops itself
+		s.manager.watchStop.Store(true)
+		return ControlResult{}, nil
+
+	case "status":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status := s.status
+		status.Queued = len(s.jobs)
+		return status, nil
+
+	case "messages":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		messages := s.messages
+		if params.Limit > 0 && len(messages) > params.Limit {
+			messages = messages[len(messages)-params.Limit:]
+		}
+		return messages, nil
+
+	case "exec_history":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.execHistory, nil
+
+	default:
+		return nil, &rpcError{rpcMethodNotFound, "method not found: " + method}
+	}
+}
+
+// enqueue queues input for the chat loop and waits for its result when wait is set
+func (s *ControlServer) enqueue(input string, wait bool) ControlResult {
+	job := controlJob{input: input, done: make(chan ControlResult, 1)}
+	s.jobs <- job
+
+	s.mu.Lock()
+	interrupt := s.interrupt
+	s.mu.Unlock()
+	if interrupt != nil {
+		interrupt()
+	}
+
+	if !wait {
+		return ControlResult{Queued: true}
+	}
+	return <-job.done
+}
+
+// subscribe streams events as JSON-RPC notifications until the client disconnects
+func (s *ControlServer) subscribe(conn net.Conn, encoder *json.Encoder, id json.RawMessage) {
+	events, unsubscribe := s.manager.Events.Subscribe()
+	defer unsubscribe()
+
+	if err := encoder.Encode(rpcResponse{JSONRPC: "2.0", ID: id, Result: "subscribed"}); err != nil {
+		return
+	}
+
+	// a read returns when the client disconnects
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if err := encoder.Encode(rpcResponse{JSONRPC: "2.0", Method: "event", Params: event}); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
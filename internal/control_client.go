@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// ControlCall calls a method of the control API listening on path and returns its raw result
+func ControlCall(path, method string, params any) (json.RawMessage, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("no tmuxai instance listening on %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	if err := writeRequest(conn, method, params); err != nil {
+		return nil, err
+	}
+	return readResponse(bufio.NewReader(conn))
+}
+
+// ControlSubscribe streams events of the control API listening on path until the connection closes
+func ControlSubscribe(path string, handle func(Event)) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("no tmuxai instance listening on %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	if err := writeRequest(conn, "subscribe", nil); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	if _, err := readResponse(reader); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var notification struct {
+			Method string `json:"method"`
+			Params Event  `json:"params"`
+		}
+		if err := decoder.Decode(&notification); err != nil {
+			return nil
+		}
+		if notification.Method == "event" {
+			handle(notification.Params)
+		}
+	}
+}
+
+func writeRequest(conn net.Conn, method string, params any) error {
+	req := map[string]any{"jsonrpc": "2.0", "id": 1, "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
+
+func readResponse(reader *bufio.Reader) (json.RawMessage, error) {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s (code %d)", resp.Error.Message, resp.Error.Code)
+	}
+	return resp.Result, nil
+}
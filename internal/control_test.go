@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+func newTestControlServer(t *testing.T) (*ControlServer, *Manager) {
+	t.Helper()
+	m := &Manager{Config: config.DefaultConfig(), Status: "", Messages: []ChatMessage{{Content: "hello", FromUser: true}}}
+	s, err := listenControl(m, filepath.Join(t.TempDir(), "control.sock"))
+	if err != nil {
+		t.Fatalf("listenControl failed: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s, m
+}
+
+func TestControlQueries(t *testing.T) {
+	s, _ := newTestControlServer(t)
+
+	result, err := ControlCall(s.Path(), "messages", map[string]any{"limit": 1})
+	if err != nil {
+		t.Fatalf("messages failed: %v", err)
+	}
+	var messages []ChatMessage
+	if err := json.Unmarshal(result, &messages); err != nil || len(messages) != 1 || messages[0].Content != "hello" {
+		t.Errorf("messages = %s, %v", result, err)
+	}
+
+	if _, err := ControlCall(s.Path(), "no_such_method", nil); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+	if _, err := ControlCall(s.Path(), "send_message", map[string]any{"message": " "}); err == nil {
+		t.Error("expected an error for an empty message")
+	}
+}
+
+func TestControlSendMessageRunsInChatLoop(t *testing.T) {
+	s, m := newTestControlServer(t)
+
+	interrupted := make(chan struct{}, 1)
+	s.SetInterrupt(func() error {
+		interrupted <- struct{}{}
+		return nil
+	})
+
+	events := make(chan Event, 1)
+	go ControlSubscribe(s.Path(), func(event Event) { events <- event })
+	for i := 0; i < 100 && m.Events.subscriberCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the chat loop: run queued jobs once the prompt is interrupted
+	go func() {
+		<-interrupted
+		s.RunPending(func(input string) RunStatus {
+			m.LastMessage = "answer to " + input
+			m.Events.Publish(EventStatus, map[string]string{"status": string(RunAccomplished)})
+			return RunAccomplished
+		})
+	}()
+
+	result, err := ControlCall(s.Path(), "send_message", map[string]any{"message": "hi"})
+	if err != nil {
+		t.Fatalf("send_message failed: %v", err)
+	}
+	var res ControlResult
+	json.Unmarshal(result, &res)
+	if res.Status != RunAccomplished || res.Message != "answer to hi" {
+		t.Errorf("result = %+v", res)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventStatus {
+			t.Errorf("event type = %s", event.Type)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("no event received")
+	}
+}
+
+func TestControlWatchStopLeavesStateToWatchLoop(t *testing.T) {
+	s, m := newTestControlServer(t)
+	m.WatchMode, m.Status = true, "running"
+
+	if _, err := ControlCall(s.Path(), "watch_stop", nil); err != nil {
+		t.Fatalf("watch_stop failed: %v", err)
+	}
+	if !m.watchStop.Load() {
+		t.Error("watch_stop didn't request a stop")
+	}
+	// only the chat loop changes the manager
+	if !m.WatchMode || m.Status != "running" {
+		t.Errorf("WatchMode = %v, Status = %q", m.WatchMode, m.Status)
+	}
+}
+
+func TestEnsureSocketDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tmuxai")
+	if err := ensureSocketDir(dir); err != nil {
+		t.Fatalf("ensureSocketDir failed: %v", err)
+	}
+	// an existing private directory is reused
+	if err := ensureSocketDir(dir); err != nil {
+		t.Errorf("ensureSocketDir of an existing directory failed: %v", err)
+	}
+
+	os.Chmod(dir, 0o755)
+	if err := ensureSocketDir(dir); err == nil {
+		t.Error("expected an error for a directory readable by others")
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	os.Symlink(dir, link)
+	if err := ensureSocketDir(link); err == nil {
+		t.Error("expected an error for a symlink")
+	}
+}
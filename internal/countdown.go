@@ -10,6 +10,15 @@ import (
 )
 
 func (m *Manager) Countdown(seconds int) {
+	if m.replay != nil {
+		// the recorded panes already show what happened while waiting
+		return
+	}
+	if !m.Interactive {
+		time.Sleep(time.Duration(seconds) * time.Second)
+		return
+	}
+
 	highlightColor := color.New(color.FgHiYellow).SprintFunc()
 	dimColor := color.New(color.FgHiBlack).SprintFunc()
 	pauseColor := color.New(color.FgHiRed).SprintFunc()
@@ -59,6 +68,9 @@ func (m *Manager) Countdown(seconds int) {
 				return
 			}
 		case <-ticker.C:
+			if m.watchStop.Load() {
+				return
+			}
 			if !paused {
 				remaining--
 				renderCountdown(remaining, seconds, paused, highlightColor, dimColor, pauseColor)
@@ -0,0 +1,337 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// Backends an evaluation runs tasks in
+const (
+	EvalTmux = "tmux" // a disposable tmux session per run
+	EvalFake = "fake" // system.FakeTmux, commands run with sh in a temporary directory
+)
+
+// EvalOptions configures an evaluation of models over tasks
+type EvalOptions struct {
+	Tasks   []*Task
+	Params  map[string]string // task parameters, used by the tasks that declare them
+	Models  []string
+	Backend string
+	Timeout time.Duration // per run, no limit if 0
+	Keep    bool          // keep the directories and tmux sessions of the runs
+	// Progress receives each run when it's done
+	Progress func(EvalRun)
+}
+
+// EvalRun is the result of a task run with a model
+type EvalRun struct {
+	Type                string     `json:"type"` // always "eval_run"
+	Task                string     `json:"task"`
+	Model               string     `json:"model"`
+	Status              RunStatus  `json:"status"`
+	Success             bool       `json:"success"` // the check of the task passed, or accomplished without a check
+	Check               string     `json:"check"`   // passed, failed or none
+	Steps               int        `json:"steps"`
+	GuidelineViolations int        `json:"guideline_violations"`
+	Usage               TokenUsage `json:"usage"`
+	Requests            int        `json:"requests"`
+	LatencyMs           int64      `json:"latency_ms"`  // average per request to the model
+	DurationMs          int64      `json:"duration_ms"` // of the whole run
+	Dir                 string     `json:"dir,omitempty"`
+	Error               string     `json:"error,omitempty"`
+}
+
+// EvalModelSummary sums up the runs of a model
+type EvalModelSummary struct {
+	Model               string     `json:"model"`
+	Runs                int        `json:"runs"`
+	Successes           int        `json:"successes"`
+	Steps               float64    `json:"steps"` // average per run
+	GuidelineViolations int        `json:"guideline_violations"`
+	Usage               TokenUsage `json:"usage"`
+	LatencyMs           int64      `json:"latency_ms"` // average per request to the model
+}
+
+// EvalReport is the result of an evaluation
+type EvalReport struct {
+	Type          string             `json:"type"` // always "eval"
+	SchemaVersion int                `json:"schema_version"`
+	Runs          []EvalRun          `json:"runs"`
+	Models        []EvalModelSummary `json:"models"`
+}
+
+// RunEval runs every task with every model and compares the results. Each run gets a new
+// directory and, with the tmux backend, a new tmux session whose pane is the exec pane.
+// Commands are whitelisted, the blacklist of the config and of the task still applies.
+func RunEval(cfg *config.Config, opts EvalOptions) EvalReport {
+	report := EvalReport{Type: "eval", SchemaVersion: OutputSchemaVersion, Runs: []EvalRun{}}
+	for _, task := range opts.Tasks {
+		for _, model := range opts.Models {
+			run := runEvalTask(cfg, task, model, opts)
+			report.Runs = append(report.Runs, run)
+			if opts.Progress != nil {
+				opts.Progress(run)
+			}
+		}
+	}
+	for _, model := range opts.Models {
+		report.Models = append(report.Models, summarizeEval(model, report.Runs))
+	}
+	return report
+}
+
+// runEvalTask runs a task with a model in a new directory
+func runEvalTask(cfg *config.Config, task *Task, model string, opts EvalOptions) EvalRun {
+	run := EvalRun{Type: "eval_run", Task: task.Name, Model: model, Status: RunFailed, Check: "none"}
+	start := time.Now()
+	defer func() { run.DurationMs = time.Since(start).Milliseconds() }()
+
+	message, err := task.Render(taskParams(task, opts.Params))
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	dir, err := os.MkdirTemp("", "tmuxai-eval-")
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	if opts.Keep {
+		run.Dir = dir
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	// settings of a task change the config, every run gets its own. Its layers aren't
+	// loaded again for the run's directory, that would drop the settings below.
+	runCfg := *cfg
+	runCfg.Layers = nil
+	runCfg.WhitelistPatterns = nil
+	runCfg.BlacklistPatterns = slices.Clone(cfg.BlacklistPatterns)
+	runCfg.Files.Roots = nil
+	runCfg.Files.ReadConfirm = false
+	runCfg.Files.WriteConfirm = false
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	m, cleanup, err := newEvalManager(ctx, &runCfg, opts.Backend, dir, opts.Keep)
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	defer cleanup()
+	if err := m.ApplyTask(task); err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	m.SessionOverrides["openrouter.model"] = model
+	m.Config.WhitelistPatterns = []string{".*"}
+	if !m.ReadOnly {
+		m.PrepareExecPane()
+	}
+
+	var steps []StepRecord
+	m.StepHandler = func(step StepRecord) { steps = append(steps, step) }
+	// stops waiting for a command in the exec pane, like Ctrl+C
+	stop := context.AfterFunc(ctx, func() { m.Status = "" })
+	run.Status = m.RunOnce(ctx, message)
+	stop()
+	run.Error = m.LastError
+	if ctx.Err() == context.DeadlineExceeded {
+		run.Error = fmt.Sprintf("timed out after %s", opts.Timeout)
+	}
+
+	run.Steps = len(steps)
+	for _, step := range steps {
+		if step.GuidelineError != "" {
+			run.GuidelineViolations++
+		}
+	}
+	run.Usage = m.AiClient.Usage()
+	requests, latency := m.AiClient.Latency()
+	run.Requests = requests
+	if requests > 0 {
+		run.LatencyMs = latency.Milliseconds() / int64(requests)
+	}
+
+	run.Success = run.Status == RunAccomplished
+	if m.Check != nil && ctx.Err() == nil {
+		// the check runs again, the AI may have stopped without claiming success
+		m.StepHandler = nil
+		m.Status = "running"
+		passed, _ := m.verifyAccomplished(ctx)
+		m.Status = ""
+		run.Success = passed
+		run.Check = "failed"
+		if passed {
+			run.Check = "passed"
+		}
+	}
+	return run
+}
+
+// taskParams returns the parameters a task declares
+func taskParams(task *Task, params map[string]string) map[string]string {
+	values := make(map[string]string)
+	for _, p := range task.Params {
+		if value, ok := params[p.Name]; ok {
+			values[p.Name] = value
+		}
+	}
+	return values
+}
+
+// newEvalManager creates a manager whose exec pane is a new pane in dir, cleanup removes the pane.
+// With the fake backend the commands run until ctx is done.
+func newEvalManager(ctx context.Context, cfg *config.Config, backend string, dir string, keep bool) (*Manager, func(), error) {
+	switch backend {
+	case EvalFake:
+		fake := system.NewFakeTmux()
+		pane := fake.AddPane("bash")
+		pane.Cwd = dir
+		fake.Run = func(pane *system.FakePane, command string) system.FakeCommand {
+			return runShellCommand(ctx, pane, command)
+		}
+		m, err := newHeadlessManager(cfg, fake, pane.Id, false)
+		return m, func() {}, err
+	case EvalTmux, "":
+		session := fmt.Sprintf("tmuxai-eval-%d-%d", os.Getpid(), time.Now().UnixNano())
+		paneId, err := system.TmuxNewSession(session, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanup := func() {
+			if !keep {
+				system.TmuxKillSession(session)
+			}
+		}
+		tmux := newTmuxBackend(cfg, paneId)
+		waitForShell(tmux, paneId)
+		m, err := newHeadlessManager(cfg, tmux, paneId, false)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		if closer, ok := tmux.(io.Closer); ok {
+			cleanup = func() {
+				closer.Close()
+				if !keep {
+					system.TmuxKillSession(session)
+				}
+			}
+		}
+		return m, cleanup, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown backend %q, use tmux or fake", backend)
+	}
+}
+
+// waitForShell waits until the shell of a new pane runs
+func waitForShell(tmux system.TmuxBackend, paneId string) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if panes, err := tmux.ListPanes(paneId); err == nil && len(panes) > 0 && system.IsShellCommand(panes[0].CurrentCommand) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	logger.Info("No shell found in pane %s", paneId)
+}
+
+// runShellCommand runs a command of a FakeTmux pane with sh in the pane's directory
+func runShellCommand(ctx context.Context, pane *system.FakePane, command string) system.FakeCommand {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = pane.Cwd
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	result := system.FakeCommand{Output: output.String()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.Code = exitErr.ExitCode()
+	} else if err != nil {
+		result.Output += err.Error()
+		result.Code = 127
+	}
+	return result
+}
+
+// summarizeEval sums up the runs of a model
+func summarizeEval(model string, runs []EvalRun) EvalModelSummary {
+	summary := EvalModelSummary{Model: model}
+	var steps, requests int
+	var latency int64
+	for _, run := range runs {
+		if run.Model != model {
+			continue
+		}
+		summary.Runs++
+		if run.Success {
+			summary.Successes++
+		}
+		steps += run.Steps
+		summary.GuidelineViolations += run.GuidelineViolations
+		summary.Usage = summary.Usage.Add(run.Usage)
+		requests += run.Requests
+		latency += run.LatencyMs * int64(run.Requests)
+	}
+	if summary.Runs > 0 {
+		summary.Steps = float64(steps) / float64(summary.Runs)
+	}
+	if requests > 0 {
+		summary.LatencyMs = latency / int64(requests)
+	}
+	return summary
+}
+
+// WriteTable writes the runs and the summary of each model as text tables
+func (r EvalReport) WriteTable(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tMODEL\tRESULT\tSTEPS\tGUIDELINE\tTOKENS\tLATENCY\tTIME")
+	for _, run := range r.Runs {
+		result := "failed"
+		if run.Success {
+			result = "passed"
+		}
+		if run.Error != "" && run.Steps == 0 {
+			result = "error"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", run.Task, run.Model, result, run.Steps,
+			run.GuidelineViolations, run.Usage.TotalTokens, formatMs(run.LatencyMs), formatMs(run.DurationMs))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "MODEL\tPASSED\tSTEPS\tGUIDELINE\tTOKENS\tLATENCY")
+	for _, s := range r.Models {
+		fmt.Fprintf(w, "%s\t%d/%d\t%.1f\t%d\t%d\t%s\n", s.Model, s.Successes, s.Runs, s.Steps,
+			s.GuidelineViolations, s.Usage.TotalTokens, formatMs(s.LatencyMs))
+	}
+	w.Flush()
+
+	for _, run := range r.Runs {
+		if run.Error != "" {
+			fmt.Fprintf(out, "\n%s with %s: %s\n", run.Task, run.Model, strings.TrimSpace(run.Error))
+		}
+	}
+}
+
+func formatMs(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(100 * time.Millisecond).String()
+}
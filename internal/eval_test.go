@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+func TestRunEvalWithFakeBackend(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	task, err := ParseTask("touch-done", `---
+check:
+  command: test -f done.txt
+---
+Create the file done.txt.`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, llm := scriptedAI(t,
+		"<RequestAccomplished>1</RequestAccomplished><WaitingForUserResponse>1</WaitingForUserResponse>",
+		"<ExecCommand>touch done.txt</ExecCommand>",
+		"Created it.\n<RequestAccomplished>1</RequestAccomplished>",
+	)
+	cfg := config.DefaultConfig()
+	cfg.OpenRouter.APIKey = "test"
+	cfg.OpenRouter.BaseURL = srv.URL
+
+	report := RunEval(cfg, EvalOptions{Tasks: []*Task{task}, Models: []string{"test/model"}, Backend: EvalFake})
+	if len(report.Runs) != 1 {
+		t.Fatalf("runs = %+v", report.Runs)
+	}
+	run := report.Runs[0]
+	if !run.Success || run.Check != "passed" || run.Status != RunAccomplished {
+		t.Errorf("run = %+v", run)
+	}
+	if run.Steps != 3 || run.GuidelineViolations != 1 || run.Requests != 3 || run.Usage.TotalTokens == 0 {
+		t.Errorf("steps %d, guideline violations %d, requests %d, usage %+v", run.Steps, run.GuidelineViolations, run.Requests, run.Usage)
+	}
+	if requests := llm.Requests(); len(requests) == 0 || requests[0].Model != "test/model" {
+		t.Errorf("requests = %+v", requests)
+	}
+	if s := report.Models[0]; s.Runs != 1 || s.Successes != 1 || s.Steps != 3 {
+		t.Errorf("summary = %+v", s)
+	}
+
+	var table strings.Builder
+	report.WriteTable(&table)
+	if !strings.Contains(table.String(), "touch-done  test/model  passed  3") {
+		t.Errorf("table:\n%s", table.String())
+	}
+}
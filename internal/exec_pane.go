@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -28,14 +29,14 @@ func (m *Manager) GetAvailablePane() system.TmuxPaneDetails {
 func (m *Manager) InitExecPane() {
 	availablePane := m.GetAvailablePane()
 	if availablePane.Id == "" {
-		system.TmuxCreateNewPane(m.PaneId)
+		m.Tmux.SplitPane(m.PaneId)
 		availablePane = m.GetAvailablePane()
 	}
 	m.ExecPane = &availablePane
 }
 
 func (m *Manager) PrepareExecPane() {
-	m.ExecPane.Refresh(m.GetMaxCaptureLines())
+	m.refreshPane(m.ExecPane)
 	if m.ExecPane.IsPrepared && m.ExecPane.Shell != "" {
 		return
 	}
@@ -55,34 +56,53 @@ func (m *Manager) PrepareExecPane() {
 		return
 	}
 
-	system.TmuxSendCommandToPane(m.ExecPane.Id, ps1Command, true)
-	system.TmuxSendCommandToPane(m.ExecPane.Id, "C-l", false)
+	m.Tmux.SendKeys(m.ExecPane.Id, ps1Command, true)
+	m.Tmux.SendKeys(m.ExecPane.Id, "C-l", false)
 }
 
+// errExecTimeout is returned when a command is still running after the timeout of execWaitCaptureTimeout
+var errExecTimeout = errors.New("the command is still running")
+
 func (m *Manager) ExecWaitCapture(command string) (CommandExecHistory, error) {
-	system.TmuxSendCommandToPane(m.ExecPane.Id, command, true)
-	m.ExecPane.Refresh(m.GetMaxCaptureLines())
+	return m.execWaitCaptureTimeout(command, 0)
+}
+
+// execWaitCaptureTimeout runs a command in the prepared exec pane and waits at most timeout
+// for it, 0 means no limit
+func (m *Manager) execWaitCaptureTimeout(command string, timeout time.Duration) (CommandExecHistory, error) {
+	m.Tmux.SendKeys(m.ExecPane.Id, command, true)
+	m.refreshPane(m.ExecPane)
 
 	m.Println("")
 
+	started := time.Now()
 	animChars := []string{"⋯", "⋱", "⋮", "⋰"}
 	animIndex := 0
 	for !strings.HasSuffix(m.ExecPane.LastLine, "]»") && m.Status != "" {
+		if timeout > 0 && time.Since(started) >= timeout {
+			fmt.Print("\r\033[K")
+			return CommandExecHistory{}, errExecTimeout
+		}
 		fmt.Printf("\r%s%s ", m.GetPrompt(), animChars[animIndex])
 		animIndex = (animIndex + 1) % len(animChars)
-		time.Sleep(500 * time.Millisecond)
-		m.ExecPane.Refresh(m.GetMaxCaptureLines())
+		m.waitForPane(m.ExecPane.Id, 100*time.Millisecond, 500*time.Millisecond)
+		m.refreshPane(m.ExecPane)
 	}
 	fmt.Print("\r\033[K")
 
 	m.parseExecPaneCommandHistory()
+	if len(m.ExecHistory) == 0 {
+		return CommandExecHistory{}, fmt.Errorf("no command found in the exec pane")
+	}
 	cmd := m.ExecHistory[len(m.ExecHistory)-1]
 	logger.Debug("Command: %s\nOutput: %s\nCode: %d\n", cmd.Command, cmd.Output, cmd.Code)
+	m.recordCommand(cmd)
+	m.Ledger = append(m.Ledger, cmd)
 	return cmd, nil
 }
 
 func (m *Manager) parseExecPaneCommandHistory() {
-	m.ExecPane.Refresh(m.GetMaxCaptureLines())
+	m.refreshPane(m.ExecPane)
 
 	var history []CommandExecHistory
 
@@ -0,0 +1,187 @@
+// Package fakellm is an OpenAI compatible chat completions server replaying scripted
+// responses, to test prompts and response parsing without a real model.
+package fakellm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Script lists the responses of the server. For each request the first response whose
+// Turn equals the request number (from 1) and whose Match matches the last user message
+// is sent. Responses with neither are sent once each, in order, when no other one applies.
+type Script struct {
+	Responses []Response `yaml:"responses"`
+}
+
+// Response is a scripted response
+type Response struct {
+	Turn    int    `yaml:"turn"`    // request number, any if 0
+	Match   string `yaml:"match"`   // regular expression on the last user message, any if empty
+	Content string `yaml:"content"` // message content of the response
+	Status  int    `yaml:"status"`  // HTTP status of an error response, 200 if 0
+	match   *regexp.Regexp
+}
+
+// Request is a chat completions request received by the server
+type Request struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+}
+
+// Message is a chat message of a request
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LastUserMessage returns the content of the last message of the user
+func (r Request) LastUserMessage() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			return r.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+// LoadScript reads a YAML script file
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	script, err := ParseScript(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return script, nil
+}
+
+// ParseScript parses a YAML script
+func ParseScript(data []byte) (*Script, error) {
+	var script Script
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, err
+	}
+	if err := script.compile(); err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+func (s *Script) compile() error {
+	for i := range s.Responses {
+		r := &s.Responses[i]
+		if r.Match == "" {
+			continue
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("response %d: invalid match: %w", i+1, err)
+		}
+		r.match = re
+	}
+	return nil
+}
+
+// Server serves the chat completions of a script
+type Server struct {
+	mu       sync.Mutex
+	script   *Script
+	used     []bool
+	requests []Request
+}
+
+// NewServer creates a server replaying a script, use it as http.Handler
+func NewServer(script *Script) (*Server, error) {
+	if err := script.compile(); err != nil {
+		return nil, err
+	}
+	return &Server{script: script, used: make([]bool, len(script.Responses))}, nil
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		http.NotFound(w, r)
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	turn := len(s.requests)
+	response, ok := s.next(turn, req.LastUserMessage())
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf(`{"error":{"message":"no scripted response for turn %d"}}`, turn), http.StatusInternalServerError)
+		return
+	}
+	if response.Status != 0 && response.Status != http.StatusOK {
+		http.Error(w, fmt.Sprintf(`{"error":{"message":%q}}`, response.Content), response.Status)
+		return
+	}
+
+	prompt := 0
+	for _, m := range req.Messages {
+		prompt += len(m.Content)
+	}
+	completion := len(response.Content)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":     fmt.Sprintf("fake-%d", turn),
+		"object": "chat.completion",
+		"model":  req.Model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       Message{Role: "assistant", Content: response.Content},
+			"finish_reason": "stop",
+		}},
+		// roughly 4 characters per token
+		"usage": map[string]int{
+			"prompt_tokens":     prompt / 4,
+			"completion_tokens": completion / 4,
+			"total_tokens":      (prompt + completion) / 4,
+		},
+	})
+}
+
+// next picks the response of a request, s.mu must be held
+func (s *Server) next(turn int, message string) (Response, bool) {
+	for _, r := range s.script.Responses {
+		if r.Turn == turn && (r.match == nil || r.match.MatchString(message)) {
+			return r, true
+		}
+	}
+	for _, r := range s.script.Responses {
+		if r.Turn == 0 && r.match != nil && r.match.MatchString(message) {
+			return r, true
+		}
+	}
+	for i, r := range s.script.Responses {
+		if r.Turn == 0 && r.match == nil && !s.used[i] {
+			s.used[i] = true
+			return r, true
+		}
+	}
+	return Response{}, false
+}
@@ -0,0 +1,66 @@
+package fakellm
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerPicksResponses(t *testing.T) {
+	script, err := ParseScript([]byte(`
+responses:
+  - content: first
+  - match: 'disk'
+    content: disk usage
+  - turn: 3
+    content: third turn
+  - content: second
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm, err := NewServer(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(llm)
+	defer srv.Close()
+
+	ask := func(message string) (int, string) {
+		body, _ := json.Marshal(Request{Model: "fake", Messages: []Message{{Role: "system", Content: "disk"}, {Role: "user", Content: message}}})
+		resp, err := http.Post(srv.URL+"/v1/chat/completions", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var completion struct {
+			Choices []struct {
+				Message Message `json:"message"`
+			} `json:"choices"`
+		}
+		json.NewDecoder(resp.Body).Decode(&completion)
+		if len(completion.Choices) == 0 {
+			return resp.StatusCode, ""
+		}
+		return resp.StatusCode, completion.Choices[0].Message.Content
+	}
+
+	for i, want := range []string{"first", "disk usage", "third turn", "second", ""} {
+		message := "hello"
+		if i == 1 {
+			message = "check the disk"
+		}
+		status, got := ask(message)
+		if got != want {
+			t.Errorf("turn %d: got %q (status %d), want %q", i+1, got, status, want)
+		}
+		if want == "" && status != http.StatusInternalServerError {
+			t.Errorf("turn %d: status %d without a response", i+1, status)
+		}
+	}
+	if n := len(llm.Requests()); n != 5 {
+		t.Errorf("%d requests recorded", n)
+	}
+}
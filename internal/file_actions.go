@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// FileEdit is the payload of a WriteFile (full content) or ApplyPatch (unified diff) action
+type FileEdit struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// execPaneDir returns the current working directory of the exec pane
+func (m *Manager) execPaneDir() (string, error) {
+	return m.Tmux.PaneCurrentPath(m.ExecPane.Id)
+}
+
+// fileRoots returns the directories file actions are restricted to
+func (m *Manager) fileRoots(cwd string) []string {
+	if len(m.Config.Files.Roots) == 0 {
+		return []string{cwd}
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	var roots []string
+	for _, root := range m.Config.Files.Roots {
+		switch {
+		case root == "~":
+			root = homeDir
+		case strings.HasPrefix(root, "~/"):
+			root = filepath.Join(homeDir, root[2:])
+		case !filepath.IsAbs(root):
+			root = filepath.Join(cwd, root)
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// resolveFilePath resolves a path relative to the exec pane's directory
+// and checks that it is inside one of the allowed roots
+func (m *Manager) resolveFilePath(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	cwd, err := m.execPaneDir()
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	path = filepath.Clean(path)
+
+	resolved := resolveSymlinks(path)
+	for _, root := range m.fileRoots(cwd) {
+		if isWithinDir(resolveSymlinks(filepath.Clean(root)), resolved) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside of the allowed directories", path)
+}
+
+// resolveSymlinks resolves symlinks of the longest existing ancestor of path
+func resolveSymlinks(path string) string {
+	var rest []string
+	current := path
+	for {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path
+		}
+		rest = append([]string{filepath.Base(current)}, rest...)
+		current = parent
+	}
+}
+
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// readFileAction executes a ReadFile action.
+// Returns the result for the AI and false if the user declined the action.
+func (m *Manager) readFileAction(path string) (string, bool) {
+	resolved, err := m.resolveFilePath(path)
+	if err != nil {
+		return fileActionError("read_file_result", path, err), true
+	}
+
+	if m.Config.Files.ReadConfirm {
+		if ok, _ := m.askConfirmation(resolved, "Read this file?", false); !ok {
+			return "", false
+		}
+	}
+
+	m.Println("Reading file: " + resolved)
+	content, err := os.ReadFile(resolved)
+	if err != nil {
+		return fileActionError("read_file_result", path, err), true
+	}
+
+	note := ""
+	if maxSize := m.Config.Files.MaxReadSize; maxSize > 0 && len(content) > maxSize {
+		note = fmt.Sprintf(" truncated=\"showing first %d of %d bytes\"", maxSize, len(content))
+		content = content[:maxSize]
+	}
+
+	return fmt.Sprintf("<read_file_result path=%q%s>\n%s\n</read_file_result>", resolved, note, strings.TrimSuffix(m.redact(string(content)), "\n")), true
+}
+
+// writeFileAction executes a WriteFile action, or an ApplyPatch action when patch is set.
+// A diff is shown before confirmation. Returns the result for the AI and false if the user declined.
+func (m *Manager) writeFileAction(edit FileEdit, patch bool) (string, bool) {
+	resultTag := "write_file_result"
+	if patch {
+		resultTag = "apply_patch_result"
+	}
+
+	resolved, err := m.resolveFilePath(edit.Path)
+	if err != nil {
+		return fileActionError(resultTag, edit.Path, err), true
+	}
+
+	var oldContent string
+	mode := fs.FileMode(0o644)
+	existing, err := os.ReadFile(resolved)
+	switch {
+	case err == nil:
+		oldContent = string(existing)
+		if info, err := os.Stat(resolved); err == nil {
+			mode = info.Mode().Perm()
+		}
+	case errors.Is(err, fs.ErrNotExist) && !patch:
+	default:
+		return fileActionError(resultTag, edit.Path, err), true
+	}
+
+	newContent := edit.Content
+	if patch {
+		newContent, err = system.ApplyUnifiedPatch(oldContent, edit.Content)
+		if err != nil {
+			return fileActionError(resultTag, edit.Path, err), true
+		}
+	} else if newContent != "" && !strings.HasSuffix(newContent, "\n") {
+		newContent += "\n"
+	}
+
+	oldName := "a/" + edit.Path
+	if existing == nil {
+		oldName = "/dev/null"
+	}
+	diff := system.UnifiedDiff(oldName, "b/"+edit.Path, oldContent, newContent)
+	if diff == "" {
+		m.Println("No changes to " + resolved)
+		return fmt.Sprintf("<%s path=%q>\nNo changes, the file already has this content\n</%s>", resultTag, resolved, resultTag), true
+	}
+
+	code, _ := system.HighlightCode("diff", diff)
+	fmt.Println(code)
+
+	if m.Config.Files.WriteConfirm {
+		if ok, _ := m.askConfirmation(resolved, "Write these changes?", false); !ok {
+			return "", false
+		}
+	}
+
+	label := "WriteFile: "
+	if patch {
+		label = "ApplyPatch: "
+	}
+	m.createCheckpoint(label+resolved, []string{resolved})
+
+	if err := os.MkdirAll(filepath.Dir(resolved), 0o755); err != nil {
+		return fileActionError(resultTag, edit.Path, err), true
+	}
+	if err := os.WriteFile(resolved, []byte(newContent), mode); err != nil {
+		return fileActionError(resultTag, edit.Path, err), true
+	}
+
+	m.Println("Wrote file: " + resolved)
+	logger.Info("Wrote file %s (%d bytes)", resolved, len(newContent))
+	return fmt.Sprintf("<%s path=%q>\nFile written successfully\n</%s>", resultTag, resolved, resultTag), true
+}
+
+// fileActionError formats a failed file action for the AI
+func fileActionError(tag, path string, err error) string {
+	logger.Error("File action %s on %s failed: %v", tag, path, err)
+	return fmt.Sprintf("<%s path=%q>\nError: %v\n</%s>", tag, path, err, tag)
+}
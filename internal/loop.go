@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+	"github.com/sigrunnr/tmuxai/logger"
+)
+
+// loopState tracks the steps of a request against the loop limits.
+// A limit of 0 means no limit.
+type loopState struct {
+	steps            int
+	guidelineRetries int // consecutive responses not following the guidelines
+	started          time.Time
+	usage            TokenUsage // usage of the AI client when the request started
+	promptTokens     int        // tokens of the last request to the AI, the next one is at least as large
+
+	maxSteps    int
+	maxRetries  int
+	maxDuration time.Duration // running time until the deadline, since the start or the last extension
+	deadline    time.Time
+	maxTokens   int
+}
+
+func (m *Manager) newLoopState() *loopState {
+	l := &loopState{
+		started:    time.Now(),
+		usage:      m.AiClient.Usage(),
+		maxSteps:   m.GetMaxSteps(),
+		maxRetries: m.GetMaxGuidelineRetries(),
+		maxTokens:  m.GetMaxTokens(),
+	}
+	if d := m.GetMaxDuration(); d > 0 {
+		l.maxDuration = time.Duration(d) * time.Second
+		l.deadline = l.started.Add(l.maxDuration)
+	}
+	return l
+}
+
+// loopLimitReached describes the limit the current request reached, or returns "" if none
+func (m *Manager) loopLimitReached() string {
+	l := m.loop
+	switch {
+	case l.maxSteps > 0 && l.steps >= l.maxSteps:
+		return fmt.Sprintf("%d steps", l.maxSteps)
+	case l.maxRetries > 0 && l.guidelineRetries > l.maxRetries:
+		return fmt.Sprintf("%d retries of responses not following the guidelines", l.maxRetries)
+	case !l.deadline.IsZero() && time.Now().After(l.deadline):
+		return fmt.Sprintf("%s of running time", l.maxDuration)
+	case l.maxTokens > 0 && m.AiClient.Usage().Sub(l.usage).TotalTokens+l.promptTokens >= l.maxTokens:
+		return fmt.Sprintf("%d tokens", l.maxTokens)
+	}
+	return ""
+}
+
+// extendLoopLimits raises the limits of the current request by their configured values
+func (m *Manager) extendLoopLimits() {
+	l := m.loop
+	if l.maxSteps > 0 {
+		l.maxSteps = l.steps + m.GetMaxSteps()
+	}
+	l.guidelineRetries = 0
+	if !l.deadline.IsZero() {
+		l.maxDuration = time.Duration(m.GetMaxDuration()) * time.Second
+		l.deadline = time.Now().Add(l.maxDuration)
+	}
+	if l.maxTokens > 0 {
+		l.maxTokens = m.AiClient.Usage().Sub(l.usage).TotalTokens + m.GetMaxTokens()
+	}
+}
+
+// pauseLoop asks the user to continue, adjust or abort a request that reached a limit.
+// Returns an optional note of the user for the AI and false if the request stops.
+func (m *Manager) pauseLoop(limit string) (string, bool) {
+	logger.Info("Request reached the limit of %s after %d steps", limit, m.loop.steps)
+	if !m.Interactive {
+		m.LastError = "stopped after reaching the limit of " + limit
+		m.Println("Stopped: the request reached the limit of " + limit)
+		m.Status = ""
+		return "", false
+	}
+
+	m.Println(fmt.Sprintf("The request reached the limit of %s.", limit))
+	answer, ok := m.readLine("[C]ontinue/A[d]just/A[b]ort: ")
+	if !ok {
+		return m.abortLoop(limit)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "c", "continue":
+		m.extendLoopLimits()
+		return "", true
+	case "d", "adjust":
+		note, ok := m.readLine("Instructions for the AI: ")
+		if !ok {
+			return m.abortLoop(limit)
+		}
+		m.extendLoopLimits()
+		return strings.TrimSpace(note), true
+	case "b", "abort":
+		return m.abortLoop(limit)
+	default:
+		return m.pauseLoop(limit)
+	}
+}
+
+func (m *Manager) abortLoop(limit string) (string, bool) {
+	m.LastError = "aborted after reaching the limit of " + limit
+	m.Status = ""
+	return "", false
+}
+
+// readLine reads a line from the user, false means the user pressed Ctrl+C
+func (m *Manager) readLine(prompt string) (string, bool) {
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          color.New(color.FgHiCyan).Sprint(prompt),
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		fmt.Printf("Error initializing readline: %v\n", err)
+		return "", false
+	}
+	defer rl.Close()
+
+	line, err := rl.Readline()
+	if err != nil {
+		return "", false
+	}
+	return line, true
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+func TestLoopLimits(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Limits = config.LimitsConfig{MaxSteps: 2, MaxGuidelineRetries: 1, MaxDuration: 60}
+	m := newManager(cfg, "")
+	m.Interactive = false
+	m.Status = "running"
+	m.loop = m.newLoopState()
+
+	m.loop.steps = 1
+	if limit := m.loopLimitReached(); limit != "" {
+		t.Fatalf("limit reached after 1 step: %s", limit)
+	}
+	m.loop.steps = 2
+	if limit := m.loopLimitReached(); limit != "2 steps" {
+		t.Errorf("limit = %q", limit)
+	}
+	if !strings.Contains(m.GetPrompt(), "2/2") {
+		t.Errorf("prompt %q doesn't show the step count", m.GetPrompt())
+	}
+
+	// continuing allows as many steps again
+	m.extendLoopLimits()
+	if limit := m.loopLimitReached(); limit != "" || m.loop.maxSteps != 4 {
+		t.Errorf("after extending: %q, max steps %d", limit, m.loop.maxSteps)
+	}
+
+	m.loop.guidelineRetries = 2
+	if limit := m.loopLimitReached(); !strings.Contains(limit, "guidelines") {
+		t.Errorf("limit = %q", limit)
+	}
+	m.loop.guidelineRetries = 0
+
+	// the limit is the extended running time, not the time since the request started
+	m.loop.started = time.Now().Add(-time.Hour)
+	m.loop.deadline = time.Now().Add(-time.Second)
+	if limit := m.loopLimitReached(); limit != "1m0s of running time" {
+		t.Errorf("limit = %q", limit)
+	}
+
+	m.loop.deadline = time.Time{}
+
+	// the size of the last prompt counts toward the budget of the next request
+	m.loop.maxTokens = 1000
+	m.loop.promptTokens = 1000
+	if limit := m.loopLimitReached(); limit != "1000 tokens" {
+		t.Errorf("limit = %q", limit)
+	}
+
+	// without a user the request stops
+	if _, ok := m.pauseLoop("2 steps"); ok || m.Status != "" || m.LastError == "" {
+		t.Errorf("pauseLoop continued: status %q, error %q", m.Status, m.LastError)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/sigrunnr/tmuxai/config"
@@ -13,21 +14,26 @@ import (
 )
 
 type AIResponse struct {
-	Message                string
-	SendKeys               []string
-	ExecCommand            []string
-	PasteMultilineContent  string
-	RequestAccomplished    bool
-	ExecPaneSeemsBusy      bool
-	WaitingForUserResponse bool
-	NoComment              bool
+	Message                string              `json:"message"`
+	SendKeys               []string            `json:"send_keys"`
+	ExecCommand            []string            `json:"exec_command"`
+	PasteMultilineContent  string              `json:"paste_multiline_content"`
+	SearchPane             []SearchPaneRequest `json:"search_pane"`
+	ReadFile               []string            `json:"read_file"`
+	WriteFile              []FileEdit          `json:"write_file"`
+	ApplyPatch             []FileEdit          `json:"apply_patch"`
+	CallTool               []ToolCall          `json:"call_tool"`
+	RequestAccomplished    bool                `json:"request_accomplished"`
+	ExecPaneSeemsBusy      bool                `json:"exec_pane_seems_busy"`
+	WaitingForUserResponse bool                `json:"waiting_for_user_response"`
+	NoComment              bool                `json:"no_comment"`
 }
 
 // Parsed only when pane is prepared
 type CommandExecHistory struct {
-	Command string
-	Output  string
-	Code    int
+	Command string `json:"command"`
+	Output  string `json:"output"`
+	Code    int    `json:"code"`
 }
 
 // Manager represents the TmuxAI manager agent
@@ -37,11 +43,37 @@ type Manager struct {
 	Status           string // running, waiting, done
 	PaneId           string
 	ExecPane         *system.TmuxPaneDetails
+	Tmux             system.TmuxBackend // the tmux server panes are read from and keys sent to
 	Messages         []ChatMessage
 	ExecHistory      []CommandExecHistory
+	Ledger           []CommandExecHistory // commands run in the exec pane, kept when the history is squashed
+	Memory           *MemoryFile          // project memory appended to the system prompt, nil if none
+	memoryWarned     string               // memory file whose size was warned about
+	Checkpoints      []Checkpoint
+	MCPClients       map[string]*MCPClient // connected MCP servers by name
+	UserCommands     map[string]*UserCommand
+	Check            *TaskCheck   // verifies RequestAccomplished of the current task
+	task             *taskRestore // settings the current task changed
+	checkFailures    int
+	loop             *loopState // steps and limits of the running request
 	WatchMode        bool
+	watchStop        atomic.Bool     // set by the control API, ends watch mode from another goroutine
+	PlanMode         bool            // dry-run: actions are collected instead of sent to panes
+	Plan             []PlannedAction // actions proposed for the last request in plan mode
+	PlanRequest      string
+	ReadOnly         bool             // actions that change panes or files are refused
+	Interactive      bool             // the user can be prompted for confirmations
+	LastMessage      string           // last message shown to the user
+	ExtraContext     string           // context attached to the next message, e.g. piped input
+	LastError        string           // last error of the agent loop
+	StepHandler      func(StepRecord) // receives each step of the agent loop when set
+	Events           *EventBus        // events for control API subscribers, nil without the control API
+	currentStep      *StepRecord
+	recorder         *recorder // records the session, see StartRecording
+	replay           *replayer // answers from a recording instead of the user, files and tools
 	OS               string
-	SessionOverrides map[string]interface{} // session-only config overrides
+	SessionOverrides map[string]interface{}    // session-only config overrides
+	configOriginals  map[string]configOriginal // values of the keys changed by /config set
 }
 
 // NewManager creates a new manager agent
@@ -71,21 +103,56 @@ func NewManager(cfg *config.Config) (*Manager, error) {
 		os.Exit(0)
 	}
 
-	aiClient := NewAiClient(&cfg.OpenRouter)
-	os := system.GetOSDetails()
+	manager := newManager(cfg, paneId)
+	manager.Tmux = newTmuxBackend(cfg, paneId)
+	manager.InitExecPane()
+	manager.applyConfigLayers()
+	return manager, nil
+}
+
+// newTmuxBackend connects to tmux in control mode when it's enabled, otherwise or when that
+// fails the tmux binary runs for each call. The control mode client attaches to the pane's session.
+func newTmuxBackend(cfg *config.Config, paneId string) system.TmuxBackend {
+	if !cfg.TmuxControlMode || paneId == "" {
+		return system.ExecBackend{}
+	}
+	backend, err := system.NewControlBackend(paneId)
+	if err != nil {
+		logger.Error("Failed to connect to tmux in control mode, running tmux for each call: %v", err)
+		return system.ExecBackend{}
+	}
+	return backend
+}
+
+// waitForPane waits up to timeout for output of a pane. Without notifications of the
+// backend it sleeps, with them it returns early but not before minWait.
+func (m *Manager) waitForPane(paneId string, minWait, timeout time.Duration) {
+	waiter, ok := m.Tmux.(system.OutputWaiter)
+	if !ok {
+		time.Sleep(timeout)
+		return
+	}
+	start := time.Now()
+	waiter.WaitForOutput(paneId, timeout)
+	if elapsed := time.Since(start); elapsed < minWait {
+		time.Sleep(minWait - elapsed)
+	}
+}
 
-	manager := &Manager{
+// newManager creates the manager struct for the given TmuxAI pane
+func newManager(cfg *config.Config, paneId string) *Manager {
+	return &Manager{
 		Config:           cfg,
-		AiClient:         aiClient,
+		AiClient:         NewAiClient(&cfg.OpenRouter),
 		PaneId:           paneId,
 		Messages:         []ChatMessage{},
 		ExecPane:         &system.TmuxPaneDetails{},
-		OS:               os,
+		Tmux:             system.ExecBackend{},
+		OS:               system.GetOSDetails(),
 		SessionOverrides: make(map[string]interface{}),
+		Interactive:      true,
+		UserCommands:     LoadUserCommands(cfg),
 	}
-
-	manager.InitExecPane()
-	return manager, nil
 }
 
 // Start starts the manager agent
@@ -132,6 +199,16 @@ func (m *Manager) GetPrompt() string {
 	}
 
 	prompt := tmuxaiColor.Sprint("TmuxAI")
+	if m.PlanMode {
+		prompt += " " + arrowColor.Sprint("(plan)")
+	}
+	if m.loop != nil && m.loop.steps > 0 && m.Status == "running" && !m.WatchMode {
+		steps := fmt.Sprint(m.loop.steps)
+		if m.loop.maxSteps > 0 {
+			steps += fmt.Sprintf("/%d", m.loop.maxSteps)
+		}
+		stateSymbol += " " + steps
+	}
 	if stateSymbol != "" {
 		prompt += " " + stateColor.Sprint("["+stateSymbol+"]")
 	}
@@ -145,6 +222,11 @@ func (ai *AIResponse) String() string {
 	SendKeys: %v
 	ExecCommand: %v
 	PasteMultilineContent: %s
+	SearchPane: %v
+	ReadFile: %v
+	WriteFile: %v
+	ApplyPatch: %v
+	CallTool: %v
 	RequestAccomplished: %v
 	ExecPaneSeemsBusy: %v
 	WaitingForUserResponse: %v
@@ -154,6 +236,11 @@ func (ai *AIResponse) String() string {
 		ai.SendKeys,
 		ai.ExecCommand,
 		ai.PasteMultilineContent,
+		ai.SearchPane,
+		ai.ReadFile,
+		ai.WriteFile,
+		ai.ApplyPatch,
+		ai.CallTool,
 		ai.RequestAccomplished,
 		ai.ExecPaneSeemsBusy,
 		ai.WaitingForUserResponse,
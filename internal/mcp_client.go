@@ -0,0 +1,562 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+const (
+	// mcpCallTimeout bounds a single request to an MCP server
+	mcpCallTimeout = 2 * time.Minute
+	// maxToolResultSize is the largest tool result sent to the AI
+	maxToolResultSize = 50000
+)
+
+// ToolCall is the payload of a CallTool action
+type ToolCall struct {
+	Server    string `json:"server"`
+	Tool      string `json:"tool"`
+	Arguments string `json:"arguments"` // JSON object
+}
+
+// mcpTransport sends JSON-RPC messages to an MCP server
+type mcpTransport interface {
+	call(ctx context.Context, method string, params any) (json.RawMessage, error)
+	notify(method string, params any) error
+	close() error
+}
+
+// MCPClient is a connection to a configured MCP server
+type MCPClient struct {
+	Name      string
+	Tools     []MCPTool
+	config    config.MCPServerConfig
+	transport mcpTransport
+}
+
+// ConnectMCPServer starts or connects to an MCP server and lists its tools
+func ConnectMCPServer(ctx context.Context, name string, cfg config.MCPServerConfig) (*MCPClient, error) {
+	var transport mcpTransport
+	var err error
+	switch {
+	case cfg.Command != "":
+		transport, err = newStdioTransport(cfg)
+	case cfg.URL != "":
+		transport = &httpTransport{url: cfg.URL, headers: cfg.Headers, client: &http.Client{}}
+	default:
+		return nil, fmt.Errorf("either command or url is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := &MCPClient{Name: name, config: cfg, transport: transport}
+	if err := client.initialize(ctx); err != nil {
+		transport.close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (c *MCPClient) initialize(ctx context.Context) error {
+	_, err := c.transport.call(ctx, "initialize", map[string]any{
+		"protocolVersion": mcpProtocolVersions[0],
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "tmuxai", "version": Version},
+	})
+	if err != nil {
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	if err := c.transport.notify("notifications/initialized", nil); err != nil {
+		return fmt.Errorf("initialized notification failed: %w", err)
+	}
+
+	var cursor string
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		raw, err := c.transport.call(ctx, "tools/list", params)
+		if err != nil {
+			return fmt.Errorf("tools/list failed: %w", err)
+		}
+		var result struct {
+			Tools      []MCPTool `json:"tools"`
+			NextCursor string    `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return fmt.Errorf("invalid tools/list result: %w", err)
+		}
+		c.Tools = append(c.Tools, result.Tools...)
+		if result.NextCursor == "" {
+			return nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// HasTool reports whether the server offers the tool
+func (c *MCPClient) HasTool(name string) bool {
+	for _, tool := range c.Tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoApproved reports whether the tool can be called without confirmation
+func (c *MCPClient) AutoApproved(tool string) bool {
+	for _, name := range c.config.AutoApprove {
+		if name == tool || name == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CallTool calls a tool and returns its text content and whether the tool reported an error
+func (c *MCPClient) CallTool(ctx context.Context, tool string, args map[string]any) (string, bool, error) {
+	raw, err := c.transport.call(ctx, "tools/call", map[string]any{"name": tool, "arguments": args})
+	if err != nil {
+		return "", false, err
+	}
+
+	var result struct {
+		Content []struct {
+			Type     string          `json:"type"`
+			Text     string          `json:"text"`
+			MimeType string          `json:"mimeType"`
+			Resource json.RawMessage `json:"resource"`
+		} `json:"content"`
+		StructuredContent json.RawMessage `json:"structuredContent"`
+		IsError           bool            `json:"isError"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", false, fmt.Errorf("invalid tools/call result: %w", err)
+	}
+
+	var parts []string
+	for _, content := range result.Content {
+		switch content.Type {
+		case "text":
+			parts = append(parts, content.Text)
+		case "resource":
+			parts = append(parts, string(content.Resource))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content %s omitted]", content.Type, content.MimeType))
+		}
+	}
+	if len(parts) == 0 && len(result.StructuredContent) > 0 {
+		parts = append(parts, string(result.StructuredContent))
+	}
+	return strings.Join(parts, "\n"), result.IsError, nil
+}
+
+// Close stops the server or ends the session
+func (c *MCPClient) Close() {
+	if err := c.transport.close(); err != nil {
+		logger.Debug("Closing MCP server %s: %v", c.Name, err)
+	}
+}
+
+// connectMCPServers connects to the configured MCP servers, failures are reported and skipped
+func (m *Manager) connectMCPServers() {
+	if len(m.Config.MCPServers) == 0 {
+		return
+	}
+	m.MCPClients = make(map[string]*MCPClient)
+
+	names := make([]string, 0, len(m.Config.MCPServers))
+	for name := range m.Config.MCPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		client, err := ConnectMCPServer(ctx, name, m.Config.MCPServers[name])
+		cancel()
+		if err != nil {
+			logger.Error("Failed to connect to MCP server %s: %v", name, err)
+			m.Println(fmt.Sprintf("Failed to connect to MCP server %s: %v", name, err))
+			continue
+		}
+		logger.Info("Connected to MCP server %s with %d tools", name, len(client.Tools))
+		m.Println(fmt.Sprintf("Connected to MCP server %s (%d tools)", name, len(client.Tools)))
+		m.MCPClients[name] = client
+	}
+}
+
+// closeMCPServers disconnects from all MCP servers
+func (m *Manager) closeMCPServers() {
+	for _, client := range m.MCPClients {
+		client.Close()
+	}
+	m.MCPClients = nil
+}
+
+// toolAutoApproved reports whether a tool call runs without confirmation
+func (m *Manager) toolAutoApproved(call ToolCall) bool {
+	client, ok := m.MCPClients[call.Server]
+	return ok && client.AutoApproved(call.Tool)
+}
+
+// callToolAction executes a CallTool action.
+// Returns the result for the AI and false if the user declined the call.
+func (m *Manager) callToolAction(ctx context.Context, call ToolCall) (string, bool) {
+	client, ok := m.MCPClients[call.Server]
+	if !ok {
+		return toolResultError(call, fmt.Errorf("unknown MCP server %q", call.Server)), true
+	}
+	if !client.HasTool(call.Tool) {
+		return toolResultError(call, fmt.Errorf("server %s has no tool %q", call.Server, call.Tool)), true
+	}
+
+	args := map[string]any{}
+	if strings.TrimSpace(call.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			return toolResultError(call, fmt.Errorf("arguments must be a JSON object: %w", err)), true
+		}
+	}
+
+	// whitelist patterns can match the call as "server/tool {arguments}"
+	description := fmt.Sprintf("%s/%s %s", call.Server, call.Tool, strings.TrimSpace(call.Arguments))
+	code, _ := system.HighlightCode("json", description)
+	m.Println(code)
+
+	if !client.AutoApproved(call.Tool) {
+		if ok, _ := m.confirmedToExec(description, "Call this tool?", false); !ok {
+			return "", false
+		}
+	}
+
+	m.Println(fmt.Sprintf("Calling tool %s/%s", call.Server, call.Tool))
+	ctx, cancel := context.WithTimeout(ctx, mcpCallTimeout)
+	defer cancel()
+	text, isError, err := client.CallTool(ctx, call.Tool, args)
+	if err != nil {
+		return toolResultError(call, err), true
+	}
+
+	text = m.redact(text)
+	note := ""
+	if len(text) > maxToolResultSize {
+		note = fmt.Sprintf(" truncated=\"showing first %d of %d bytes\"", maxToolResultSize, len(text))
+		text = text[:maxToolResultSize]
+	}
+	if isError {
+		note += ` error="true"`
+	}
+	return fmt.Sprintf("<tool_result server=%q tool=%q%s>\n%s\n</tool_result>", call.Server, call.Tool, note, text), true
+}
+
+// toolResultError formats a failed tool call for the AI
+func toolResultError(call ToolCall, err error) string {
+	logger.Error("Tool call %s/%s failed: %v", call.Server, call.Tool, err)
+	return fmt.Sprintf("<tool_result server=%q tool=%q error=\"true\">\nError: %v\n</tool_result>", call.Server, call.Tool, err)
+}
+
+// mcpToolsPrompt describes the tools of the connected MCP servers for the system prompt
+func (m *Manager) mcpToolsPrompt() string {
+	if len(m.MCPClients) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(m.MCPClients))
+	for name := range m.MCPClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(`<CallTool>: Use this tag to call a tool of a connected MCP server with a JSON object of arguments, e.g. <CallTool server="docs" tool="search">{"query": "tmux hooks"}</CallTool>. The result is sent to you in the next message.
+Available tools (server/tool: description, arguments schema):
+`)
+	for _, name := range names {
+		for _, tool := range m.MCPClients[name].Tools {
+			schema, _ := json.Marshal(tool.InputSchema)
+			sb.WriteString(fmt.Sprintf("- %s/%s: %s %s\n", name, tool.Name, strings.TrimSpace(tool.Description), schema))
+		}
+	}
+	return sb.String()
+}
+
+// rpcMessage is a JSON-RPC message received from an MCP server
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// stdioTransport talks to an MCP server started as a child process
+type stdioTransport struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nextID int
+}
+
+func newStdioTransport(cfg config.MCPServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+	return &stdioTransport{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+func (t *stdioTransport) write(message map[string]any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	id := t.nextID
+	if err := t.write(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return nil, err
+	}
+
+	type readResult struct {
+		result json.RawMessage
+		err    error
+	}
+	done := make(chan readResult, 1)
+	go func() {
+		result, err := t.readResponse(id)
+		done <- readResult{result, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-ctx.Done():
+		// the server is in an unknown state, stop it
+		t.cmd.Process.Kill()
+		return nil, ctx.Err()
+	}
+}
+
+// readResponse reads messages until the response to id, answering requests of the server
+func (t *stdioTransport) readResponse(id int) (json.RawMessage, error) {
+	want := fmt.Sprint(id)
+	for {
+		line, err := t.stdout.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("server closed the connection: %w", err)
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			logger.Debug("Ignoring invalid MCP message: %s", line)
+			continue
+		}
+		if msg.Method != "" {
+			if len(msg.ID) > 0 {
+				// requests like sampling or roots are not supported
+				t.write(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "error": rpcError{rpcMethodNotFound, "not supported"}})
+			}
+			continue
+		}
+		if string(msg.ID) != want {
+			continue
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	}
+}
+
+func (t *stdioTransport) notify(method string, params any) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	message := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		message["params"] = params
+	}
+	return t.write(message)
+}
+
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	done := make(chan error, 1)
+	go func() { done <- t.cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(2 * time.Second):
+		t.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// httpTransport talks to an MCP server over streamable HTTP
+type httpTransport struct {
+	mu        sync.Mutex
+	url       string
+	headers   map[string]string
+	client    *http.Client
+	sessionId string
+	nextID    int
+}
+
+func (t *httpTransport) post(ctx context.Context, message map[string]any) (*http.Response, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("MCP-Protocol-Version", mcpProtocolVersions[0])
+	if t.sessionId != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionId)
+	}
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.sessionId = id
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	want := fmt.Sprint(t.nextID)
+	resp, err := t.post(ctx, map[string]any{"jsonrpc": "2.0", "id": t.nextID, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	handle := func(data []byte) (json.RawMessage, bool, error) {
+		var msg rpcMessage
+		if err := json.Unmarshal(data, &msg); err != nil || string(msg.ID) != want || msg.Method != "" {
+			return nil, false, nil
+		}
+		if msg.Error != nil {
+			return nil, true, msg.Error
+		}
+		return msg.Result, true, nil
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if result, ok, err := handle(body); ok {
+			return result, err
+		}
+		return nil, fmt.Errorf("no response to %s", method)
+	}
+
+	// server-sent events, the response is one of the data events
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case line == "" && data.Len() > 0:
+			if result, ok, err := handle([]byte(data.String())); ok {
+				return result, err
+			}
+			data.Reset()
+		}
+	}
+	if data.Len() > 0 {
+		if result, ok, err := handle([]byte(data.String())); ok {
+			return result, err
+		}
+	}
+	return nil, fmt.Errorf("no response to %s", method)
+}
+
+func (t *httpTransport) notify(method string, params any) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	message := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		message["params"] = params
+	}
+	resp, err := t.post(context.Background(), message)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) close() error {
+	if t.sessionId == "" {
+		return nil
+	}
+	req, err := http.NewRequest("DELETE", t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", t.sessionId)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
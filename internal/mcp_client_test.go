@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+// fakeMCPServer answers streamable HTTP requests, responses are sent as server-sent events
+func fakeMCPServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "s1" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		var result any
+		switch req.Method {
+		case "initialize":
+			w.Header().Set("Mcp-Session-Id", "s1")
+			result = map[string]any{"protocolVersion": mcpProtocolVersions[0], "capabilities": map[string]any{}}
+		case "tools/list":
+			result = map[string]any{"tools": []MCPTool{{Name: "search", Description: "Search the docs"}}}
+		case "tools/call":
+			var params struct {
+				Arguments map[string]any `json:"arguments"`
+			}
+			json.Unmarshal(req.Params, &params)
+			result = mcpToolResult{Content: []mcpContent{{Type: "text", Text: fmt.Sprintf("found %v, token=abc123def456", params.Arguments["query"])}}}
+		}
+
+		data, _ := json.Marshal(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\ndata: %s\n\n", data)
+	}))
+}
+
+func TestMCPClientHTTP(t *testing.T) {
+	server := fakeMCPServer()
+	defer server.Close()
+
+	client, err := ConnectMCPServer(context.Background(), "docs", config.MCPServerConfig{URL: server.URL})
+	if err != nil {
+		t.Fatalf("ConnectMCPServer failed: %v", err)
+	}
+	defer client.Close()
+
+	if !client.HasTool("search") || client.HasTool("delete") {
+		t.Errorf("tools = %+v", client.Tools)
+	}
+	text, isError, err := client.CallTool(context.Background(), "search", map[string]any{"query": "hooks"})
+	if err != nil || isError {
+		t.Fatalf("CallTool = %q, %v, %v", text, isError, err)
+	}
+	if !strings.HasPrefix(text, "found hooks") {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestCallToolAction(t *testing.T) {
+	server := fakeMCPServer()
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.MCPServers = map[string]config.MCPServerConfig{
+		"docs": {URL: server.URL, AutoApprove: []string{"search"}},
+	}
+	m := newManager(cfg, "")
+	m.Interactive = false
+	m.connectMCPServers()
+	defer m.closeMCPServers()
+
+	result, ok := m.callToolAction(context.Background(), ToolCall{Server: "docs", Tool: "search", Arguments: `{"query": "hooks"}`})
+	if !ok {
+		t.Fatal("auto approved call was declined")
+	}
+	if !strings.Contains(result, `<tool_result server="docs" tool="search">`) || strings.Contains(result, "abc123") {
+		t.Errorf("result = %q", result)
+	}
+
+	result, _ = m.callToolAction(context.Background(), ToolCall{Server: "docs", Tool: "search", Arguments: `not json`})
+	if !strings.Contains(result, `error="true"`) {
+		t.Errorf("invalid arguments result = %q", result)
+	}
+
+	m.MCPClients["docs"].config.AutoApprove = nil
+	if _, ok := m.callToolAction(context.Background(), ToolCall{Server: "docs", Tool: "search", Arguments: `{}`}); ok {
+		t.Error("call needing confirmation ran without a user")
+	}
+}
@@ -0,0 +1,351 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// MCP protocol versions the server speaks, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// defaultExecTimeout is how long exec_wait_capture waits for a command by default
+const defaultExecTimeout = 60 * time.Second
+
+// MCPTool describes a tool in the tools/list result
+type MCPTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// mcpToolResult is the result of tools/call
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolArgs struct {
+	Target         string `json:"target"`
+	Pane           string `json:"pane"`
+	Lines          int    `json:"lines"`
+	Keys           string `json:"keys"`
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// MCPServer exposes tmux panes as Model Context Protocol tools over stdio.
+// Actions are gated by the whitelist, blacklist and confirmation settings; as nobody
+// can confirm, actions that need confirmation are denied.
+type MCPServer struct {
+	manager *Manager
+}
+
+func NewMCPServer(cfg *config.Config) *MCPServer {
+	manager := newManager(cfg, "")
+	manager.Interactive = false
+	paneId, _ := system.TmuxCurrentPaneId()
+	manager.Tmux = newTmuxBackend(cfg, paneId)
+	return &MCPServer{manager: manager}
+}
+
+// mcpTools lists the tools of the server
+func mcpTools() []MCPTool {
+	pane := map[string]any{"type": "string", "description": "Pane id, e.g. %3"}
+	object := func(properties map[string]any, required ...string) map[string]any {
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+
+	return []MCPTool{
+		{
+			Name:        "list_panes",
+			Description: "List the panes of a tmux window with their current command.",
+			InputSchema: object(map[string]any{
+				"target": map[string]any{"type": "string", "description": "Window target (session:window) or a pane id, defaults to the current window"},
+			}),
+		},
+		{
+			Name:        "capture_pane",
+			Description: "Capture the visible content and recent history of a pane.",
+			InputSchema: object(map[string]any{
+				"pane":  pane,
+				"lines": map[string]any{"type": "integer", "description": "Number of lines to capture, defaults to max_capture_lines"},
+			}, "pane"),
+		},
+		{
+			Name:        "send_keys",
+			Description: "Send keys to a pane using tmux key names, e.g. C-c or Enter.",
+			InputSchema: object(map[string]any{
+				"pane": pane,
+				"keys": map[string]any{"type": "string", "description": "Keys separated by spaces"},
+			}, "pane", "keys"),
+		},
+		{
+			Name:        "run_command",
+			Description: "Type a command into a pane and press Enter without waiting for it to finish.",
+			InputSchema: object(map[string]any{
+				"pane":    pane,
+				"command": map[string]any{"type": "string"},
+			}, "pane", "command"),
+		},
+		{
+			Name:        "exec_wait_capture",
+			Description: "Run a command in a pane prepared by tmuxai (/prepare), wait for it to finish and return its output and exit code.",
+			InputSchema: object(map[string]any{
+				"pane":            pane,
+				"command":         map[string]any{"type": "string"},
+				"timeout_seconds": map[string]any{"type": "integer", "description": "Defaults to 60"},
+			}, "pane", "command"),
+		},
+	}
+}
+
+// Serve answers newline delimited JSON-RPC requests until in is closed
+func (s *MCPServer) Serve(in io.Reader, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxControlRequestSize)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			encoder.Encode(rpcResponse{JSONRPC: "2.0", Error: &rpcError{rpcParseError, "parse error: " + err.Error()}})
+			continue
+		}
+		// notifications have no id and get no response
+		if len(req.ID) == 0 {
+			logger.Debug("MCP notification: %s", req.Method)
+			continue
+		}
+
+		result, err := s.handle(req.Method, req.Params)
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+		if err != nil {
+			resp.Result = nil
+			resp.Error = err
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *MCPServer) handle(method string, rawParams json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(rawParams, &params)
+		version := mcpProtocolVersions[0]
+		for _, v := range mcpProtocolVersions {
+			if v == params.ProtocolVersion {
+				version = v
+			}
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "tmuxai", "version": Version},
+		}, nil
+
+	case "ping":
+		return map[string]any{}, nil
+
+	case "tools/list":
+		return map[string]any{"tools": mcpTools()}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "invalid params: " + err.Error()}
+		}
+		var args mcpToolArgs
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments, &args); err != nil {
+				return nil, &rpcError{rpcInvalidParams, "invalid arguments: " + err.Error()}
+			}
+		}
+
+		logger.Info("MCP tool call: %s %s", params.Name, string(params.Arguments))
+		text, err := s.callTool(params.Name, args)
+		if err != nil {
+			return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}}, nil
+
+	default:
+		return nil, &rpcError{rpcMethodNotFound, "method not found: " + method}
+	}
+}
+
+func (s *MCPServer) callTool(name string, args mcpToolArgs) (string, error) {
+	m := s.manager
+
+	if name != "list_panes" {
+		if !strings.HasPrefix(args.Pane, "%") {
+			return "", fmt.Errorf("pane must be a pane id like %%3")
+		}
+	}
+
+	switch name {
+	case "list_panes":
+		return s.listPanes(args.Target)
+
+	case "capture_pane":
+		lines := args.Lines
+		if lines <= 0 {
+			lines = m.GetMaxCaptureLines()
+		}
+		content, err := m.Tmux.CapturePane(args.Pane, lines)
+		if err != nil {
+			return "", fmt.Errorf("failed to capture pane %s: %w", args.Pane, err)
+		}
+		return m.redactPane(content), nil
+
+	case "send_keys":
+		if args.Keys == "" {
+			return "", fmt.Errorf("keys are required")
+		}
+		if m.GetSendKeysConfirm() {
+			if ok, _ := m.confirmedToExec(args.Keys, "Send this key(s)?", false); !ok {
+				return "", deniedError("send_keys_confirm")
+			}
+		}
+		m.Tmux.SendKeys(args.Pane, args.Keys, false)
+		return "Keys sent", nil
+
+	case "run_command":
+		if args.Command == "" {
+			return "", fmt.Errorf("command is required")
+		}
+		if m.GetExecConfirm() {
+			if ok, _ := m.confirmedToExec(args.Command, "Execute this command?", false); !ok {
+				return "", deniedError("exec_confirm")
+			}
+		}
+		m.Tmux.SendKeys(args.Pane, args.Command, true)
+		return "Command sent, use capture_pane to see its output", nil
+
+	case "exec_wait_capture":
+		return s.execWaitCapture(args)
+
+	default:
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+}
+
+// listPanes lists the panes of the target window as JSON
+func (s *MCPServer) listPanes(target string) (string, error) {
+	if target == "" {
+		paneId, err := s.manager.Tmux.CurrentPaneId()
+		if err == nil {
+			target, err = s.manager.Tmux.WindowTarget(paneId)
+		}
+		if err != nil {
+			return "", fmt.Errorf("not inside tmux, a target window is required")
+		}
+	}
+	panes, err := s.manager.Tmux.ListPanes(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to list panes of %s: %w", target, err)
+	}
+
+	type paneInfo struct {
+		Id                 string `json:"id"`
+		Active             bool   `json:"active"`
+		CurrentCommand     string `json:"current_command"`
+		CurrentCommandArgs string `json:"current_command_args"`
+		LastLine           string `json:"last_line"`
+		Prepared           bool   `json:"prepared"`
+	}
+	infos := make([]paneInfo, 0, len(panes))
+	for _, pane := range panes {
+		s.manager.refreshPane(&pane)
+		infos = append(infos, paneInfo{
+			Id:                 pane.Id,
+			Active:             pane.IsActive == 1,
+			CurrentCommand:     pane.CurrentCommand,
+			CurrentCommandArgs: pane.CurrentCommandArgs,
+			LastLine:           s.manager.redact(pane.LastLine),
+			Prepared:           pane.IsPrepared,
+		})
+	}
+	data, err := json.MarshalIndent(infos, "", "  ")
+	return string(data), err
+}
+
+// execWaitCapture runs a command in a prepared pane and returns its history entry as JSON
+func (s *MCPServer) execWaitCapture(args mcpToolArgs) (string, error) {
+	m := s.manager
+	if args.Command == "" {
+		return "", fmt.Errorf("command is required")
+	}
+
+	panes, err := s.manager.Tmux.ListPanes(args.Pane)
+	if err != nil || len(panes) == 0 {
+		return "", fmt.Errorf("pane %s not found", args.Pane)
+	}
+	pane := panes[0]
+	m.refreshPane(&pane)
+	if !pane.IsPrepared {
+		return "", fmt.Errorf("pane %s is not prepared, run /prepare in tmuxai for that pane or use run_command", args.Pane)
+	}
+
+	if m.GetExecConfirm() {
+		if ok, _ := m.confirmedToExec(args.Command, "Execute this command?", false); !ok {
+			return "", deniedError("exec_confirm")
+		}
+	}
+
+	timeout := defaultExecTimeout
+	if args.TimeoutSeconds > 0 {
+		timeout = time.Duration(args.TimeoutSeconds) * time.Second
+	}
+
+	m.ExecPane = &pane
+	m.Status = "running"
+	result, err := m.execWaitCaptureTimeout(args.Command, timeout)
+	m.Status = ""
+
+	if errors.Is(err, errExecTimeout) {
+		return "", fmt.Errorf("command is still running after %s, use capture_pane to follow it", timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+	result.Output = m.redact(result.Output)
+	data, err := json.MarshalIndent(result, "", "  ")
+	return string(data), err
+}
+
+// deniedError explains why an action was not run
+func deniedError(setting string) error {
+	return fmt.Errorf("denied: the action is not whitelisted and %s requires a confirmation, which is not possible over MCP. Add it to whitelist_patterns to allow it", setting)
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+// mcpExchange sends requests to a server and returns the decoded responses
+func mcpExchange(t *testing.T, s *MCPServer, requests ...string) []map[string]any {
+	t.Helper()
+	var out bytes.Buffer
+	if err := s.Serve(strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	var responses []map[string]any
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var resp map[string]any
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+func TestMCPInitializeAndList(t *testing.T) {
+	s := NewMCPServer(config.DefaultConfig())
+	responses := mcpExchange(t, s,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+	)
+
+	if len(responses) != 2 {
+		t.Fatalf("got %d responses, want 2 (notifications get none)", len(responses))
+	}
+	result := responses[0]["result"].(map[string]any)
+	if result["protocolVersion"] != "2024-11-05" {
+		t.Errorf("protocolVersion = %v", result["protocolVersion"])
+	}
+	tools := responses[1]["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 5 {
+		t.Errorf("got %d tools, want 5", len(tools))
+	}
+}
+
+func TestMCPActionsNeedWhitelist(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WhitelistPatterns = []string{`^ls`}
+	cfg.BlacklistPatterns = []string{`rm`}
+	s := NewMCPServer(cfg)
+
+	for _, command := range []string{"rm -rf build", "make deploy"} {
+		text, err := s.callTool("run_command", mcpToolArgs{Pane: "%1", Command: command})
+		if err == nil || !strings.Contains(err.Error(), "denied") {
+			t.Errorf("run_command %q = %q, %v, want denied", command, text, err)
+		}
+	}
+
+	if _, err := s.callTool("capture_pane", mcpToolArgs{Pane: "1"}); err == nil {
+		t.Error("expected an error for an invalid pane id")
+	}
+}
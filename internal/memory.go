@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sigrunnr/tmuxai/logger"
+)
+
+// MemoryFile is a project memory file, conventions of a repository the AI should know
+type MemoryFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"` // at most memory.max_size bytes
+}
+
+// loadMemory reads the memory file of the exec pane's directory into m.Memory
+func (m *Manager) loadMemory() {
+	path, found := m.findMemoryFile()
+	if !found {
+		m.Memory = nil
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("Failed to read memory file %s: %v", path, err)
+		m.Memory = nil
+		return
+	}
+	content := string(data)
+	if limit := m.Config.Memory.MaxSize; limit > 0 && len(content) > limit {
+		if m.memoryWarned != path {
+			m.Println(fmt.Sprintf("Memory file %s is %d bytes, only the first %d are sent to the AI (memory.max_size)", path, len(content), limit))
+			m.memoryWarned = path
+		}
+		content = strings.ToValidUTF8(content[:limit], "")
+	}
+	m.Memory = &MemoryFile{Path: path, Content: strings.TrimSpace(content)}
+}
+
+// findMemoryFile returns the memory file of the exec pane's directory or of its git root.
+// If there is none it returns where /remember creates it and false.
+func (m *Manager) findMemoryFile() (string, bool) {
+	names := m.Config.Memory.Files
+	if len(names) == 0 || m.ExecPane == nil || m.ExecPane.Id == "" {
+		return "", false
+	}
+	dir, err := m.execPaneDir()
+	if err != nil || dir == "" {
+		return "", false
+	}
+	dirs := []string{dir}
+	if root := gitRoot(dir); root != "" && root != dir {
+		dirs = append(dirs, root)
+	}
+	for _, d := range dirs {
+		for _, name := range names {
+			path := filepath.Join(d, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path, true
+			}
+		}
+	}
+	return filepath.Join(dirs[len(dirs)-1], names[0]), false
+}
+
+// gitRoot returns the top level directory of the git repository of dir, "" outside of one
+func gitRoot(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// memoryPrompt returns the memory file as a section of the system prompt
+func (m *Manager) memoryPrompt() string {
+	if m.Memory == nil || m.Memory.Content == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n==== Project memory from %s, conventions to follow in this project ====\n%s\n",
+		filepath.Base(m.Memory.Path), m.Memory.Content)
+}
+
+// remember appends a fact to the memory file, creating it if needed
+func (m *Manager) remember(fact string) error {
+	path, found := m.findMemoryFile()
+	if path == "" {
+		return errors.New("no memory file: the exec pane's directory is unknown or memory.files is empty")
+	}
+	var prefix string
+	if found {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+			prefix = "\n"
+		}
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(prefix + "- " + fact + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	m.Println("Remembered in " + path)
+	m.loadMemory()
+	return nil
+}
+
+// showMemory prints the memory file, "edit" opens it in $EDITOR
+func (m *Manager) showMemory(arg string) {
+	path, found := m.findMemoryFile()
+	if path == "" {
+		m.Println("No memory file: the exec pane's directory is unknown or memory.files is empty")
+		return
+	}
+	if arg == "edit" {
+		editor := os.Getenv("EDITOR")
+		if editor == "" {
+			editor = "vi"
+		}
+		cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			m.Println("Failed to edit the memory file: " + err.Error())
+		}
+		m.loadMemory()
+		return
+	}
+	if !found {
+		m.Println(fmt.Sprintf("No memory file, /remember <fact> creates %s", path))
+		return
+	}
+	m.loadMemory()
+	if m.Memory == nil {
+		return
+	}
+	fmt.Println(m.Memory.Path)
+	fmt.Println()
+	fmt.Println(m.Memory.Content)
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+func TestMemoryFile(t *testing.T) {
+	root := t.TempDir()
+	if err := exec.Command("git", "-C", root, "init", "-q").Run(); err != nil {
+		t.Skip("git is not available")
+	}
+	root, _ = filepath.EvalSymlinks(root)
+	dir := filepath.Join(root, "cmd")
+	os.Mkdir(dir, 0755)
+
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Cwd = dir
+	m := newFakeManager(t, fake, "http://127.0.0.1:0")
+
+	// without a file in the directory, the file at the git root is used
+	os.WriteFile(filepath.Join(root, "AGENTS.md"), []byte("Use make, not go build."), 0644)
+	m.loadMemory()
+	if m.Memory == nil || m.Memory.Path != filepath.Join(root, "AGENTS.md") {
+		t.Fatalf("memory = %+v", m.Memory)
+	}
+	if prompt := m.chatAssistantPrompt(false).Content; !strings.Contains(prompt, "Use make, not go build.") {
+		t.Error("memory is not in the system prompt")
+	}
+
+	if err := m.remember("tests need TZ=UTC"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(root, "AGENTS.md"))
+	if string(data) != "Use make, not go build.\n- tests need TZ=UTC\n" {
+		t.Errorf("memory file = %q", data)
+	}
+
+	// larger files are cut
+	m.Config.Memory.MaxSize = 10
+	m.loadMemory()
+	if m.Memory.Content != "Use make," {
+		t.Errorf("content = %q", m.Memory.Content)
+	}
+
+	m.Config.Memory.Files = nil
+	m.loadMemory()
+	if m.Memory != nil || m.memoryPrompt() != "" {
+		t.Errorf("memory without files: %+v", m.Memory)
+	}
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// RunStatus is the final status of a one-shot request
+type RunStatus string
+
+const (
+	RunAccomplished RunStatus = "accomplished"
+	RunWaiting      RunStatus = "waiting_for_user"
+	RunFailed       RunStatus = "failed"
+)
+
+// ExitCode returns the process exit code for the status
+func (s RunStatus) ExitCode() int {
+	switch s {
+	case RunAccomplished:
+		return 0
+	case RunWaiting:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// NewHeadlessManager creates a manager for one-shot use without the chat interface.
+// It never re-executes itself inside a new tmux session. The exec pane is the given pane,
+// or another pane of the current window. Read-only managers may run without any pane.
+func NewHeadlessManager(cfg *config.Config, execPaneId string, readOnly bool) (*Manager, error) {
+	if cfg.OpenRouter.APIKey == "" {
+		return nil, fmt.Errorf("OpenRouter API key is required. Set it in the config file or as an environment variable: TMUXAI_OPENROUTER_API_KEY")
+	}
+	target, _ := system.TmuxCurrentPaneId()
+	if target == "" {
+		target = execPaneId
+	}
+	manager, err := newHeadlessManager(cfg, newTmuxBackend(cfg, target), execPaneId, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	manager.applyConfigLayers()
+	return manager, nil
+}
+
+// newHeadlessManager creates a headless manager working with the panes of a tmux backend
+func newHeadlessManager(cfg *config.Config, tmux system.TmuxBackend, execPaneId string, readOnly bool) (*Manager, error) {
+	paneId, _ := tmux.CurrentPaneId()
+	manager := newManager(cfg, paneId)
+	manager.Tmux = tmux
+	manager.Interactive = false
+	manager.ReadOnly = readOnly
+
+	switch {
+	case execPaneId != "":
+		panes, err := manager.Tmux.ListPanes(execPaneId)
+		if err != nil || len(panes) == 0 {
+			return nil, fmt.Errorf("pane %s not found", execPaneId)
+		}
+		if execPaneId == paneId {
+			// the pane tmuxai runs in is the one to work with
+			manager.PaneId = ""
+		}
+		manager.ExecPane = &panes[0]
+	case paneId != "":
+		if available := manager.GetAvailablePane(); available.Id != "" {
+			manager.ExecPane = &available
+		} else if !readOnly {
+			manager.InitExecPane()
+		} else if panes, err := manager.Tmux.ListPanes(paneId); err == nil && len(panes) > 0 {
+			// nothing is sent to panes in read-only mode, observe the pane tmuxai runs in
+			manager.PaneId = ""
+			manager.ExecPane = &panes[0]
+		}
+	case !readOnly:
+		return nil, fmt.Errorf("not inside tmux, use --pane to choose the pane to work in")
+	}
+
+	return manager, nil
+}
+
+// RunOnce processes a single request without the interactive chat and returns its final status
+func (m *Manager) RunOnce(ctx context.Context, message string) RunStatus {
+	m.connectMCPServers()
+	defer m.closeMCPServers()
+
+	if expanded, ok, err := m.ExpandUserCommand(message); ok {
+		if err != nil {
+			m.LastError = err.Error()
+			return RunFailed
+		}
+		message = expanded
+	}
+
+	m.Status = "running"
+	m.checkFailures = 0
+	accomplished := m.ProcessUserMessage(ctx, message)
+	m.flushStep()
+	return m.runStatus(accomplished)
+}
+
+// runStatus returns the final status of a request from the result of ProcessUserMessage
+func (m *Manager) runStatus(accomplished bool) RunStatus {
+	switch {
+	case accomplished:
+		return RunAccomplished
+	case m.Status == "waiting":
+		return RunWaiting
+	default:
+		return RunFailed
+	}
+}
+
+// refusedAction tells the AI that an action is not available in read-only mode
+func refusedAction(kind, content string) string {
+	return fmt.Sprintf("<action_refused action=%q>\n%s\n%s is not available, you can only observe in this mode. Answer using the information you have.\n</action_refused>", kind, content, kind)
+}
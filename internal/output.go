@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// OutputSchemaVersion is the version of the JSON output schema, bumped on incompatible changes
+const OutputSchemaVersion = 1
+
+// Statuses of an action in the JSON output
+const (
+	ActionExecuted = "executed"
+	ActionDeclined = "declined"
+	ActionRefused  = "refused"
+	ActionPlanned  = "planned"
+)
+
+// ActionRecord is an action of an AI response and what happened to it
+type ActionRecord struct {
+	Kind    string              `json:"kind"`
+	Content string              `json:"content,omitempty"`
+	Path    string              `json:"path,omitempty"`
+	Status  string              `json:"status"`
+	Result  *CommandExecHistory `json:"result,omitempty"` // prepared exec pane only
+	Error   string              `json:"error,omitempty"`
+}
+
+// StepRecord is one round trip of the agent loop
+type StepRecord struct {
+	Type           string         `json:"type"` // always "step"
+	SchemaVersion  int            `json:"schema_version"`
+	Step           int            `json:"step"`
+	Time           time.Time      `json:"time"`
+	Response       AIResponse     `json:"response"`
+	GuidelineError string         `json:"guideline_error,omitempty"`
+	Actions        []ActionRecord `json:"actions"`
+	Usage          TokenUsage     `json:"usage"`
+}
+
+// RunReport is the result of a one-shot request
+type RunReport struct {
+	Type          string       `json:"type"` // always "result"
+	SchemaVersion int          `json:"schema_version"`
+	Status        RunStatus    `json:"status"`
+	Message       string       `json:"message"`
+	Error         string       `json:"error,omitempty"`
+	Steps         []StepRecord `json:"steps,omitempty"` // json output only, jsonl emits steps as they happen
+	Usage         TokenUsage   `json:"usage"`
+}
+
+// beginStep starts recording a step, emitting the previous one
+func (m *Manager) beginStep(r AIResponse, usage TokenUsage) {
+	if m.StepHandler == nil {
+		return
+	}
+	m.flushStep()
+	m.currentStep = &StepRecord{
+		Type:          "step",
+		SchemaVersion: OutputSchemaVersion,
+		Time:          time.Now(),
+		Response:      r,
+		Actions:       []ActionRecord{},
+		Usage:         usage,
+	}
+	if m.loop != nil {
+		m.currentStep.Step = m.loop.steps
+	}
+}
+
+// recordAction adds an action to the current step
+func (m *Manager) recordAction(action ActionRecord) {
+	if m.currentStep != nil {
+		m.currentStep.Actions = append(m.currentStep.Actions, action)
+	}
+}
+
+// flushStep emits the current step to the step handler
+func (m *Manager) flushStep() {
+	if m.currentStep != nil && m.StepHandler != nil {
+		m.StepHandler(*m.currentStep)
+	}
+	m.currentStep = nil
+}
+
+// NewRunReport builds the result of a one-shot request
+func (m *Manager) NewRunReport(status RunStatus, steps []StepRecord) RunReport {
+	return RunReport{
+		Type:          "result",
+		SchemaVersion: OutputSchemaVersion,
+		Status:        status,
+		Message:       m.LastMessage,
+		Error:         m.LastError,
+		Steps:         steps,
+		Usage:         m.AiClient.Usage(),
+	}
+}
+
+// WriteJSON writes v as a single line of JSON
+func WriteJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
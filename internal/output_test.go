@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestStepRecording(t *testing.T) {
+	var steps []StepRecord
+	m := &Manager{StepHandler: func(step StepRecord) { steps = append(steps, step) }, loop: &loopState{}}
+
+	m.loop.steps++
+	m.beginStep(AIResponse{ExecCommand: []string{"ls"}}, TokenUsage{TotalTokens: 10})
+	m.recordAction(ActionRecord{Kind: PlanExecCommand, Content: "ls", Status: ActionExecuted, Result: &CommandExecHistory{Command: "ls", Code: 0}})
+	m.loop.steps++
+	m.beginStep(AIResponse{RequestAccomplished: true}, TokenUsage{TotalTokens: 5})
+	m.flushStep()
+	m.flushStep()
+
+	if len(steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(steps))
+	}
+	if steps[0].Step != 1 || steps[1].Step != 2 {
+		t.Errorf("step numbers = %d, %d", steps[0].Step, steps[1].Step)
+	}
+	if len(steps[0].Actions) != 1 || len(steps[1].Actions) != 0 {
+		t.Errorf("actions = %v, %v", steps[0].Actions, steps[1].Actions)
+	}
+}
+
+func TestStepRecordJSON(t *testing.T) {
+	var buf bytes.Buffer
+	step := StepRecord{Type: "step", SchemaVersion: OutputSchemaVersion, Step: 1, Response: AIResponse{Message: "done", RequestAccomplished: true}}
+	if err := WriteJSON(&buf, step); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["schema_version"] != float64(OutputSchemaVersion) {
+		t.Errorf("schema_version = %v", decoded["schema_version"])
+	}
+	response := decoded["response"].(map[string]any)
+	if response["message"] != "done" || response["request_accomplished"] != true {
+		t.Errorf("response = %v", response)
+	}
+}
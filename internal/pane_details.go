@@ -8,10 +8,23 @@ import (
 	"github.com/sigrunnr/tmuxai/system"
 )
 
+// refreshPane captures the content of a pane
+func (m *Manager) refreshPane(pane *system.TmuxPaneDetails) {
+	pane.RefreshWith(m.Tmux, m.GetMaxCaptureLines())
+}
+
 func (m *Manager) GetTmuxPanes() ([]system.TmuxPaneDetails, error) {
-	currentPaneId, _ := system.TmuxCurrentPaneId()
-	windowTarget, _ := system.TmuxCurrentWindowTarget()
-	currentPanes, _ := system.TmuxPanesDetails(windowTarget)
+	// headless managers may not have a TmuxAI pane, use the exec pane's window then
+	currentPaneId := m.PaneId
+	targetPane := currentPaneId
+	if targetPane == "" {
+		targetPane = m.ExecPane.Id
+	}
+	if targetPane == "" {
+		return nil, nil
+	}
+	windowTarget, _ := m.Tmux.WindowTarget(targetPane)
+	currentPanes, _ := m.Tmux.ListPanes(windowTarget)
 
 	for i := range currentPanes {
 		currentPanes[i].IsTmuxAiPane = currentPanes[i].Id == currentPaneId
@@ -41,7 +54,11 @@ func (m *Manager) GetTmuxPanesInXml(config *config.Config) string {
 	}
 	for _, pane := range filteredPanes {
 		if !pane.IsTmuxAiPane {
-			pane.Refresh(m.GetMaxCaptureLines())
+			if m.GetCaptureMode(pane) == system.CaptureModeAnsi {
+				pane.RefreshAnnotatedWith(m.Tmux, m.GetMaxCaptureLines())
+			} else {
+				m.refreshPane(&pane)
+			}
 		}
 		if pane.IsTmuxAiExecPane {
 			m.ExecPane = &pane
@@ -69,10 +86,13 @@ func (m *Manager) GetTmuxPanesInXml(config *config.Config) string {
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - IsSubShell: %t\n", pane.IsSubShell))
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - HistorySize: %d\n", pane.HistorySize))
 		currentTmuxWindow.WriteString(fmt.Sprintf(" - HistoryLimit: %d\n", pane.HistoryLimit))
+		if pane.CaptureMode == system.CaptureModeAnsi {
+			currentTmuxWindow.WriteString(" - CaptureMode: ansi (colours annotated as [err]...[/err], [warn]...[/warn], [ok]...[/ok], bold as [bold]...[/bold]; repeated progress lines collapsed)\n")
+		}
 
 		if !pane.IsTmuxAiPane && pane.Content != "" {
 			currentTmuxWindow.WriteString("<pane_content>\n")
-			currentTmuxWindow.WriteString(pane.Content)
+			currentTmuxWindow.WriteString(m.redactPane(pane.Content))
 			currentTmuxWindow.WriteString("\n</pane_content>\n")
 		}
 
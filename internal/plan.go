@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// Kinds of actions collected in plan mode
+const (
+	PlanExecCommand = "ExecCommand"
+	PlanSendKeys    = "SendKeys"
+	PlanPaste       = "PasteMultilineContent"
+	PlanWriteFile   = "WriteFile"
+	PlanApplyPatch  = "ApplyPatch"
+	PlanCallTool    = "CallTool"
+)
+
+// dryRunNotice replaces the updated pane content message in plan mode
+const dryRunNotice = "Dry run: your actions were not executed and the panes are unchanged. Assume they succeeded and continue with the next step, or mark the request accomplished when the plan is complete."
+
+// PlannedAction is an action proposed by the AI in plan mode
+type PlannedAction struct {
+	Kind    string
+	Path    string
+	Content string
+}
+
+// planAction prints and collects an action instead of sending it to a pane
+func (m *Manager) planAction(action PlannedAction) {
+	m.Plan = append(m.Plan, action)
+	switch action.Kind {
+	case PlanWriteFile, PlanApplyPatch, PlanCallTool:
+		m.Println(fmt.Sprintf("[plan] %s %s", action.Kind, action.Path))
+	default:
+		m.Println(fmt.Sprintf("[plan] %s: %s", action.Kind, action.Content))
+	}
+}
+
+// PlanScript returns the collected actions as a shell script
+func (m *Manager) PlanScript() string {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\n")
+	if m.PlanRequest != "" {
+		for _, line := range strings.Split(m.PlanRequest, "\n") {
+			sb.WriteString("# " + line + "\n")
+		}
+	}
+	for _, action := range m.Plan {
+		switch action.Kind {
+		case PlanExecCommand:
+			sb.WriteString(action.Content + "\n")
+		case PlanSendKeys:
+			sb.WriteString("# send keys: " + action.Content + "\n")
+		case PlanPaste:
+			sb.WriteString("# paste:\n")
+			for _, line := range strings.Split(action.Content, "\n") {
+				sb.WriteString("#   " + line + "\n")
+			}
+		case PlanWriteFile:
+			sb.WriteString(fmt.Sprintf("cat > %s <<'TMUXAI_EOF'\n%s\nTMUXAI_EOF\n", shellQuote(action.Path), strings.TrimSuffix(action.Content, "\n")))
+		case PlanApplyPatch:
+			sb.WriteString(fmt.Sprintf("patch %s <<'TMUXAI_EOF'\n%s\nTMUXAI_EOF\n", shellQuote(action.Path), strings.TrimSuffix(action.Content, "\n")))
+		case PlanCallTool:
+			sb.WriteString(fmt.Sprintf("# call tool %s: %s\n", action.Path, strings.ReplaceAll(action.Content, "\n", " ")))
+		}
+	}
+	return sb.String()
+}
+
+// printPlan prints the proposed script at the end of a plan mode request
+func (m *Manager) printPlan() {
+	if len(m.Plan) == 0 {
+		m.Println("No actions proposed")
+		return
+	}
+	m.Println(fmt.Sprintf("Proposed script (%d steps), save it with /plan save <file>:", len(m.Plan)))
+	code, _ := system.HighlightCode("sh", m.PlanScript())
+	fmt.Println(code)
+}
+
+// savePlan writes the proposed steps as a task file that can be run with `tmuxai -f`
+func (m *Manager) savePlan(path string) error {
+	if len(m.Plan) == 0 {
+		return fmt.Errorf("no plan to save")
+	}
+	var sb strings.Builder
+	if m.PlanRequest != "" {
+		sb.WriteString(m.PlanRequest + "\n\n")
+	}
+	sb.WriteString("Run the following steps in the exec pane, checking the result of each step before continuing:\n\n```sh\n")
+	sb.WriteString(m.PlanScript())
+	sb.WriteString("```\n")
+	return os.WriteFile(path, []byte(sb.String()), 0o644)
+}
+
+// shellQuote quotes a string for use as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/sigrunnr/tmuxai/logger"
@@ -10,22 +11,73 @@ import (
 	"github.com/briandowns/spinner"
 )
 
+// stepResult tells the agent loop how to go on after a step
+type stepResult struct {
+	next         string // message of the next step
+	done         bool
+	accomplished bool
+}
+
+var (
+	stepDone         = stepResult{done: true}
+	stepAccomplished = stepResult{done: true, accomplished: true}
+)
+
 // Main function to process regular user messages
 // Returns true if the request was accomplished and no further processing should happen
 func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
-	// Check if context management is needed before sending
-	if m.needSquash() {
-		m.Println("Exceeded context size, squashing history...")
-		m.squashHistory()
+	if m.replay == nil {
+		m.applyConfigLayers()
+		m.loadMemory()
+	}
+	m.recordMessage(message)
+	defer m.recordMessageEnd()
+	m.loop = m.newLoopState()
+	defer func() { m.loop = nil }()
+
+	for {
+		if limit := m.loopLimitReached(); limit != "" {
+			note, ok := m.pauseLoop(limit)
+			if !ok {
+				return false
+			}
+			if note != "" {
+				message += "\n\nThe user paused the loop and adds: " + note
+			}
+		}
+
+		m.loop.steps++
+		result := m.processStep(ctx, message)
+		if result.done {
+			return result.accomplished
+		}
+		message = result.next
+	}
+}
+
+// chatHistory returns the system prompt and the messages of the chat
+func (m *Manager) chatHistory() []ChatMessage {
+	var history []ChatMessage
+	switch {
+	case m.WatchMode:
+		history = []ChatMessage{m.watchPrompt()}
+	case m.ExecPane.IsPrepared:
+		history = []ChatMessage{m.chatAssistantPrompt(true)}
+	default:
+		history = []ChatMessage{m.chatAssistantPrompt(false)}
 	}
+	return append(history, m.Messages...)
+}
 
+// processStep sends a message to the AI and runs the actions of its response
+func (m *Manager) processStep(ctx context.Context, message string) stepResult {
 	s := spinner.New(spinner.CharSets[26], 100*time.Millisecond)
 	s.Start()
 
 	// check for status change before processing
 	if m.Status == "" {
 		s.Stop()
-		return false
+		return stepDone
 	}
 
 	currentTmuxWindow := m.GetTmuxPanesInXml(m.Config)
@@ -33,56 +85,63 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 	if !m.ExecPane.IsSubShell {
 		execPaneEnv = fmt.Sprintf("Keep in mind, you are working within the shell: %s and OS: %s", m.ExecPane.Shell, m.ExecPane.OS)
 	}
+	if m.ExtraContext != "" {
+		// sent once, it stays in the chat history
+		currentTmuxWindow += "\n" + m.ExtraContext + "\n"
+		m.ExtraContext = ""
+	}
 	currentMessage := ChatMessage{
 		Content:   currentTmuxWindow + "\n\n" + execPaneEnv + "\n\n" + message,
 		FromUser:  true,
 		Timestamp: time.Now(),
 	}
 
-	// build current chat history
-	var history []ChatMessage
-	switch {
-	case m.WatchMode:
-		history = []ChatMessage{m.watchPrompt()}
-	case m.ExecPane.IsPrepared:
-		history = []ChatMessage{m.chatAssistantPrompt(true)}
-	default:
-		history = []ChatMessage{m.chatAssistantPrompt(false)}
+	sending := append(m.chatHistory(), currentMessage)
+	// Check if context management is needed before sending
+	if m.needSquash(sending) {
+		s.Stop()
+		m.Println("Exceeded context size, squashing history...")
+		m.squashHistory()
+		sending = append(m.chatHistory(), currentMessage)
+		s.Start()
+	}
+	if m.loop != nil {
+		m.loop.promptTokens = m.countTokens(sending)
 	}
 
-	history = append(history, m.Messages...)
-
-	sending := append(history, currentMessage)
-
+	usageBefore := m.AiClient.Usage()
 	response, err := m.AiClient.GetResponseFromChatMessages(ctx, sending, m.GetOpenRouterModel())
 	if err != nil {
 		s.Stop()
 		m.Status = ""
 
 		if ctx.Err() == context.Canceled {
-			return false
+			m.LastError = "canceled"
+			return stepDone
 		}
 
-		fmt.Println("Failed to get response from AI: " + err.Error())
-		return false
+		m.LastError = "Failed to get response from AI: " + err.Error()
+		fmt.Println(m.LastError)
+		return stepDone
 	}
 
 	// check for status change again
 	if m.Status == "" {
 		s.Stop()
-		return false
+		return stepDone
 	}
 
 	r, err := m.parseAIResponse(response)
 	if err != nil {
 		s.Stop()
 		m.Status = ""
-		fmt.Println("Failed to parse AI response: " + err.Error())
-		return false
+		m.LastError = "Failed to parse AI response: " + err.Error()
+		fmt.Println(m.LastError)
+		return stepDone
 	}
 
 	if m.Config.Debug {
-		debugChatMessages(append(history, currentMessage), response)
+		debugChatMessages(sending, response)
 	}
 
 	logger.Debug("AIResponse: %s", r.String())
@@ -95,17 +154,24 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		Timestamp: time.Now(),
 	}
 
+	m.beginStep(r, m.AiClient.Usage().Sub(usageBefore))
+
 	// did AI follow our guidelines?
 	guidelineError, validResponse := m.aiFollowedGuidelines(r)
 	if !validResponse {
+		if m.currentStep != nil {
+			m.currentStep.GuidelineError = guidelineError
+		}
 		m.Println("AI didn't follow guidelines, trying again...")
 		m.Messages = append(m.Messages, currentMessage, responseMsg)
-		return m.ProcessUserMessage(ctx, guidelineError)
-
+		m.loop.guidelineRetries++
+		return stepResult{next: guidelineError}
 	}
+	m.loop.guidelineRetries = 0
 
 	// colorize code blocks in the response
 	if r.Message != "" {
+		m.LastMessage = r.Message
 		fmt.Println(system.Cosmetics(r.Message))
 	}
 
@@ -115,8 +181,59 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		m.Messages = append(m.Messages, currentMessage, responseMsg)
 	}
 
+	// read-only actions are auto-approved, their results are sent with the next message
+	var observations []string
+	for _, search := range r.SearchPane {
+		m.Println(fmt.Sprintf("Searching pane %s history for: %s", search.Pane, search.Pattern))
+		observations = append(observations, m.searchPane(search))
+		m.recordAction(ActionRecord{Kind: "SearchPane", Content: search.Pattern, Path: search.Pane, Status: ActionExecuted})
+	}
+	for _, path := range r.ReadFile {
+		result, ok := m.replayable("ReadFile", path, func() (string, bool) { return m.readFileAction(path) })
+		if !ok {
+			m.recordAction(ActionRecord{Kind: "ReadFile", Path: path, Status: ActionDeclined})
+			m.Status = ""
+			return stepDone
+		}
+		m.recordAction(ActionRecord{Kind: "ReadFile", Path: path, Status: ActionExecuted})
+		observations = append(observations, result)
+	}
+
+	for _, call := range r.CallTool {
+		if m.ReadOnly && !m.toolAutoApproved(call) {
+			m.recordAction(ActionRecord{Kind: PlanCallTool, Path: call.Server + "/" + call.Tool, Content: call.Arguments, Status: ActionRefused})
+			observations = append(observations, refusedAction(PlanCallTool, call.Server+"/"+call.Tool))
+			continue
+		}
+		if m.PlanMode {
+			m.recordAction(ActionRecord{Kind: PlanCallTool, Path: call.Server + "/" + call.Tool, Content: call.Arguments, Status: ActionPlanned})
+			m.planAction(PlannedAction{Kind: PlanCallTool, Path: call.Server + "/" + call.Tool, Content: call.Arguments})
+			continue
+		}
+
+		result, ok := m.replayable(PlanCallTool, call.Server+"/"+call.Tool+" "+call.Arguments, func() (string, bool) { return m.callToolAction(ctx, call) })
+		if !ok {
+			m.recordAction(ActionRecord{Kind: PlanCallTool, Path: call.Server + "/" + call.Tool, Content: call.Arguments, Status: ActionDeclined})
+			m.Status = ""
+			return stepDone
+		}
+		m.recordAction(ActionRecord{Kind: PlanCallTool, Path: call.Server + "/" + call.Tool, Content: call.Arguments, Status: ActionExecuted})
+		observations = append(observations, result)
+	}
+
 	// observe/prepared mode
 	for _, execCommand := range r.ExecCommand {
+		if m.ReadOnly {
+			m.recordAction(ActionRecord{Kind: PlanExecCommand, Content: execCommand, Status: ActionRefused})
+			observations = append(observations, refusedAction(PlanExecCommand, execCommand))
+			continue
+		}
+		if m.PlanMode {
+			m.recordAction(ActionRecord{Kind: PlanExecCommand, Content: execCommand, Status: ActionPlanned})
+			m.planAction(PlannedAction{Kind: PlanExecCommand, Content: execCommand})
+			continue
+		}
+
 		code, _ := system.HighlightCode("sh", execCommand)
 		m.Println(code)
 
@@ -129,19 +246,36 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		}
 		if isSafe {
 			m.Println("Executing command: " + command)
+			action := ActionRecord{Kind: PlanExecCommand, Content: command, Status: ActionExecuted}
 			if m.ExecPane.IsPrepared {
-				m.ExecWaitCapture(command)
+				m.checkpointCommand(command)
+				if result, err := m.ExecWaitCapture(command); err == nil {
+					action.Result = &result
+				}
 			} else {
-				system.TmuxSendCommandToPane(m.ExecPane.Id, command, true)
+				m.Tmux.SendKeys(m.ExecPane.Id, command, true)
 				time.Sleep(1 * time.Second)
 			}
+			m.recordAction(action)
 		} else {
+			m.recordAction(ActionRecord{Kind: PlanExecCommand, Content: execCommand, Status: ActionDeclined})
 			m.Status = ""
-			return false
+			return stepDone
 		}
 	}
 
 	for _, sendKey := range r.SendKeys {
+		if m.ReadOnly {
+			m.recordAction(ActionRecord{Kind: PlanSendKeys, Content: sendKey, Status: ActionRefused})
+			observations = append(observations, refusedAction(PlanSendKeys, sendKey))
+			continue
+		}
+		if m.PlanMode {
+			m.recordAction(ActionRecord{Kind: PlanSendKeys, Content: sendKey, Status: ActionPlanned})
+			m.planAction(PlannedAction{Kind: PlanSendKeys, Content: sendKey})
+			continue
+		}
+
 		code, _ := system.HighlightCode("txt", sendKey)
 		m.Println(code)
 
@@ -154,27 +288,24 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 		}
 		if isSafe {
 			m.Println("Sending keys: " + command)
-			system.TmuxSendCommandToPane(m.ExecPane.Id, command, false)
+			m.Tmux.SendKeys(m.ExecPane.Id, command, false)
+			m.recordAction(ActionRecord{Kind: PlanSendKeys, Content: command, Status: ActionExecuted})
 			time.Sleep(1 * time.Second)
 		} else {
+			m.recordAction(ActionRecord{Kind: PlanSendKeys, Content: sendKey, Status: ActionDeclined})
 			m.Status = ""
-			return false
-		}
-	}
-
-	if r.ExecPaneSeemsBusy {
-		m.Countdown(m.GetWaitInterval())
-		// Create a new context for this recursive call
-		newCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		accomplished := m.ProcessUserMessage(newCtx, "waited for 5 more seconds, here is the current pane(s) content")
-		if accomplished {
-			return true
+			return stepDone
 		}
 	}
 
-	// observe or prepared mode
-	if r.PasteMultilineContent != "" {
+	if r.PasteMultilineContent != "" && m.ReadOnly {
+		m.recordAction(ActionRecord{Kind: PlanPaste, Content: r.PasteMultilineContent, Status: ActionRefused})
+		observations = append(observations, refusedAction(PlanPaste, r.PasteMultilineContent))
+	} else if r.PasteMultilineContent != "" && m.PlanMode {
+		m.recordAction(ActionRecord{Kind: PlanPaste, Content: r.PasteMultilineContent, Status: ActionPlanned})
+		m.planAction(PlannedAction{Kind: PlanPaste, Content: r.PasteMultilineContent})
+	} else if r.PasteMultilineContent != "" {
+		// observe or prepared mode
 		code, _ := system.HighlightCode("txt", r.PasteMultilineContent)
 		fmt.Println(code)
 
@@ -187,60 +318,105 @@ func (m *Manager) ProcessUserMessage(ctx context.Context, message string) bool {
 
 		if isSafe {
 			m.Println("Pasting...")
-			system.TmuxSendCommandToPane(m.ExecPane.Id, r.PasteMultilineContent, true)
+			m.Tmux.SendKeys(m.ExecPane.Id, r.PasteMultilineContent, true)
+			m.recordAction(ActionRecord{Kind: PlanPaste, Content: r.PasteMultilineContent, Status: ActionExecuted})
 			time.Sleep(1 * time.Second)
 		} else {
+			m.recordAction(ActionRecord{Kind: PlanPaste, Content: r.PasteMultilineContent, Status: ActionDeclined})
 			m.Status = ""
-			return false
+			return stepDone
 		}
 	}
 
+	for i, edit := range append(r.WriteFile, r.ApplyPatch...) {
+		patch := i >= len(r.WriteFile)
+		kind := PlanWriteFile
+		if patch {
+			kind = PlanApplyPatch
+		}
+		if m.ReadOnly {
+			m.recordAction(ActionRecord{Kind: kind, Path: edit.Path, Status: ActionRefused})
+			observations = append(observations, refusedAction(kind, edit.Path))
+			continue
+		}
+		if m.PlanMode {
+			m.recordAction(ActionRecord{Kind: kind, Path: edit.Path, Content: edit.Content, Status: ActionPlanned})
+			m.planAction(PlannedAction{Kind: kind, Path: edit.Path, Content: edit.Content})
+			continue
+		}
+
+		result, ok := m.replayable(kind, edit.Path, func() (string, bool) { return m.writeFileAction(edit, patch) })
+		if !ok {
+			m.recordAction(ActionRecord{Kind: kind, Path: edit.Path, Status: ActionDeclined})
+			m.Status = ""
+			return stepDone
+		}
+		m.recordAction(ActionRecord{Kind: kind, Path: edit.Path, Status: ActionExecuted})
+		observations = append(observations, result)
+	}
+
 	if r.RequestAccomplished {
+		if passed, result := m.verifyAccomplished(ctx); !passed {
+			if m.Status == "" {
+				return stepDone
+			}
+			if m.checkFailures >= m.checkAttempts() {
+				m.LastError = fmt.Sprintf("the success check failed %d times", m.checkFailures)
+				m.Println("Giving up: " + m.LastError)
+				m.Status = ""
+				return stepDone
+			}
+			observations = append(observations, result)
+			return stepResult{next: withObservations(observations, "The request is not accomplished: the success check failed. Find the cause, fix it and set RequestAccomplished again when it's done.")}
+		}
 		m.Status = ""
-		return true
+		return stepAccomplished
 	}
 
 	if r.WaitingForUserResponse {
 		m.Status = "waiting"
-		return false
+		return stepDone
 	}
 
 	// watch mode only
 	if r.NoComment {
-		return false
+		return stepDone
 	}
 
-	if !m.WatchMode {
-		accomplished := m.ProcessUserMessage(ctx, "sending updated pane(s) content")
-		if accomplished {
-			return true
-		}
+	// nothing runs in plan mode, there is nothing to wait for
+	if r.ExecPaneSeemsBusy && !m.PlanMode {
+		m.Countdown(m.GetWaitInterval())
+		return stepResult{next: withObservations(observations, fmt.Sprintf("waited for %d more seconds, here is the current pane(s) content", m.GetWaitInterval()))}
 	}
-	return false
-}
 
-func (m *Manager) startWatchMode(desc string) {
-
-	// check status
-	if m.Status == "" {
-		return
+	// results of read-only actions are still sent back in watch mode
+	if m.WatchMode && len(observations) == 0 {
+		return stepDone
 	}
-
-	m.Countdown(m.GetWaitInterval())
-
-	// Create a new background context since this is a separate process
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	accomplished := m.ProcessUserMessage(ctx, desc)
-	if accomplished {
-		m.WatchMode = false
-		m.Status = ""
+	nextMessage := "sending updated pane(s) content"
+	if m.PlanMode {
+		nextMessage = dryRunNotice
 	}
+	return stepResult{next: withObservations(observations, nextMessage)}
+}
 
-	// we continue running if status is still set
-	if m.Status != "" && m.WatchMode {
-		m.startWatchMode("")
+func (m *Manager) startWatchMode(desc string) {
+	m.watchStop.Store(false)
+	// we continue running while status is set
+	for m.Status != "" && m.WatchMode {
+		m.Countdown(m.GetWaitInterval())
+		if m.watchStop.Load() {
+			m.WatchMode = false
+			m.Status = ""
+			break
+		}
+
+		accomplished := m.ProcessUserMessage(context.Background(), desc)
+		if accomplished {
+			m.WatchMode = false
+			m.Status = ""
+		}
+		desc = ""
 	}
 }
 
@@ -264,8 +440,13 @@ func (m *Manager) aiFollowedGuidelines(r AIResponse) (string, bool) {
 		return "You didn't follow the guidelines. Only one boolean flag should be set to true in your response. Pay attention!", false
 	}
 
+	// search results come back in the next message, there must be one
+	if len(r.SearchPane) > 0 && (r.RequestAccomplished || r.WaitingForUserResponse || r.NoComment) {
+		return "You didn't follow the guidelines. SearchPane results are sent to you in the next message, don't combine it with RequestAccomplished, WaitingForUserResponse or NoComment. Pay attention!", false
+	}
+
 	// Check if only one tag is used
-	tags := []int{len(r.ExecCommand), len(r.SendKeys), len(r.PasteMultilineContent)}
+	tags := []int{len(r.ExecCommand), len(r.SendKeys), len(r.PasteMultilineContent), len(r.SearchPane), len(r.ReadFile), len(r.WriteFile), len(r.ApplyPatch), len(r.CallTool)}
 	count := 0
 	for _, len := range tags {
 		if len > 0 {
@@ -284,3 +465,11 @@ func (m *Manager) aiFollowedGuidelines(r AIResponse) (string, bool) {
 
 	return "", true
 }
+
+// withObservations prepends results of read-only actions to the next message
+func withObservations(observations []string, message string) string {
+	if len(observations) == 0 {
+		return message
+	}
+	return strings.Join(observations, "\n\n") + "\n\n" + message
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -25,10 +26,65 @@ func (m *Manager) parseAIResponse(response string) (AIResponse, error) {
 		{"NoComment", false, true, func(r *AIResponse, v string) { r.NoComment = isTrue(v) }},
 	}
 
+	// Attribute tags: <TagName attr="value"/> or <TagName attr="value">body</TagName>
+	type attrTagInfo struct {
+		name     string
+		setField func(*AIResponse, map[string]string, string)
+	}
+	attrTags := []attrTagInfo{
+		{"SearchPane", func(r *AIResponse, attrs map[string]string, _ string) {
+			r.SearchPane = append(r.SearchPane, newSearchPaneRequest(attrs))
+		}},
+		{"ReadFile", func(r *AIResponse, attrs map[string]string, _ string) {
+			r.ReadFile = append(r.ReadFile, attrs["path"])
+		}},
+		{"WriteFile", func(r *AIResponse, attrs map[string]string, body string) {
+			r.WriteFile = append(r.WriteFile, FileEdit{Path: attrs["path"], Content: trimBlock(body)})
+		}},
+		{"ApplyPatch", func(r *AIResponse, attrs map[string]string, body string) {
+			r.ApplyPatch = append(r.ApplyPatch, FileEdit{Path: attrs["path"], Content: trimBlock(body)})
+		}},
+		{"CallTool", func(r *AIResponse, attrs map[string]string, body string) {
+			r.CallTool = append(r.CallTool, ToolCall{Server: attrs["server"], Tool: attrs["tool"], Arguments: strings.TrimSpace(body)})
+		}},
+	}
+
 	clean := response
 	tagPattern := `(?s)<%s>(.*?)</%s>`
 	r := AIResponse{}
 	cleanForMsg := clean
+	attrTagRes := make([]*regexp.Regexp, len(attrTags))
+	for i, t := range attrTags {
+		tagExpr := fmt.Sprintf(`<%s((?:\s+[\w-]+\s*=\s*(?:"[^"]*"|'[^']*'))*)\s*(?:/>|>(.*?)</%s>)`, t.name, t.name)
+		reTag := regexp.MustCompile("(?s)" + tagExpr)
+		attrTagRes[i] = reTag
+		// Remove the tags from the message, including code/backtick wrappers
+		cleanForMsg = regexp.MustCompile("(?s)```(?:xml)?\\s*"+tagExpr+"\\s*```").ReplaceAllString(cleanForMsg, "")
+		cleanForMsg = regexp.MustCompile("(?s)`"+tagExpr+"`").ReplaceAllString(cleanForMsg, "")
+		cleanForMsg = reTag.ReplaceAllString(cleanForMsg, "")
+	}
+
+	// Take the attribute tags in order of appearance and cut each one out,
+	// so tags inside a file body or tool arguments are not taken for actions
+	for {
+		first, loc := -1, []int(nil)
+		for i, reTag := range attrTagRes {
+			if l := reTag.FindStringSubmatchIndex(clean); l != nil && (loc == nil || l[0] < loc[0]) {
+				first, loc = i, l
+			}
+		}
+		if loc == nil {
+			break
+		}
+		body := ""
+		if loc[4] >= 0 {
+			body = clean[loc[4]:loc[5]]
+		}
+		// file content is taken verbatim, XML entities are not decoded
+		attrTags[first].setField(&r, parseTagAttributes(clean[loc[2]:loc[3]]), body)
+		clean = clean[:loc[0]] + clean[loc[1]:]
+	}
+
 	for _, t := range tags {
 		reTag := regexp.MustCompile(fmt.Sprintf(tagPattern, t.name, t.name))
 		tagMatches := reTag.FindAllStringSubmatch(clean, -1)
@@ -85,6 +141,46 @@ func (m *Manager) parseAIResponse(response string) (AIResponse, error) {
 	return r, nil
 }
 
+var tagAttributeRe = regexp.MustCompile(`([\w-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// parseTagAttributes parses XML attributes into a map, decoding XML entities
+func parseTagAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range tagAttributeRe.FindAllStringSubmatch(s, -1) {
+		val := m[2]
+		if val == "" {
+			val = m[3]
+		}
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(val)
+	}
+	return attrs
+}
+
+// newSearchPaneRequest builds a SearchPaneRequest from tag attributes
+func newSearchPaneRequest(attrs map[string]string) SearchPaneRequest {
+	req := SearchPaneRequest{
+		Pane:    attrs["pane"],
+		Pattern: attrs["pattern"],
+		Context: defaultSearchContext,
+	}
+	if c, err := strconv.Atoi(strings.TrimSpace(attrs["context"])); err == nil && c >= 0 {
+		req.Context = c
+	}
+	return req
+}
+
+// trimBlock removes surrounding blank lines but keeps the indentation of the first line
+func trimBlock(s string) string {
+	s = strings.TrimRight(s, " \t\r\n")
+	for {
+		idx := strings.Index(s, "\n")
+		if idx < 0 || strings.TrimSpace(s[:idx]) != "" {
+			return s
+		}
+		s = s[idx+1:]
+	}
+}
+
 // Helper: check if string is "1" or "true" (case-insensitive)
 func isTrue(s string) bool {
 	s = strings.TrimSpace(strings.ToLower(s))
@@ -253,3 +253,91 @@ func TestParseAIResponse_MixedAIAndNonAIXMLTags(t *testing.T) {
 		t.Errorf("got %+v, want %+v", got, want)
 	}
 }
+
+// Test: Self-closing SearchPane tag with attributes
+func TestParseAIResponse_SearchPane(t *testing.T) {
+	m := &Manager{}
+	input := "I'll search for the panic.\n<SearchPane pane=\"%3\" pattern=\"panic: &quot;x&quot;\" context=\"20\"/>"
+	want := AIResponse{
+		Message:    "I'll search for the panic.",
+		SearchPane: []SearchPaneRequest{{Pane: "%3", Pattern: `panic: "x"`, Context: 20}},
+	}
+	got, err := m.parseAIResponse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// Test: SearchPane in code block with default context
+func TestParseAIResponse_SearchPane_CodeBlockDefaults(t *testing.T) {
+	m := &Manager{}
+	input := "Searching.\n```xml\n<SearchPane pattern='error'></SearchPane>\n```"
+	want := AIResponse{
+		Message:    "Searching.",
+		SearchPane: []SearchPaneRequest{{Pattern: "error", Context: defaultSearchContext}},
+	}
+	got, err := m.parseAIResponse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// Test: WriteFile keeps content verbatim, ReadFile is self-closing
+func TestParseAIResponse_FileActions(t *testing.T) {
+	m := &Manager{}
+	input := "Writing the file.\n<WriteFile path=\"a.yaml\">\n  key: a &amp; b\n  other: <x>\n</WriteFile>\n<ReadFile path=\"b.txt\"/>"
+	want := AIResponse{
+		Message:   "Writing the file.",
+		ReadFile:  []string{"b.txt"},
+		WriteFile: []FileEdit{{Path: "a.yaml", Content: "  key: a &amp; b\n  other: <x>"}},
+	}
+	got, err := m.parseAIResponse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// Test: CallTool with JSON arguments
+func TestParseAIResponse_CallTool(t *testing.T) {
+	m := &Manager{}
+	input := "Searching the docs.\n<CallTool server=\"docs\" tool=\"search\">\n{\"query\": \"a < b\"}\n</CallTool>"
+	want := AIResponse{
+		Message:  "Searching the docs.",
+		CallTool: []ToolCall{{Server: "docs", Tool: "search", Arguments: `{"query": "a < b"}`}},
+	}
+	got, err := m.parseAIResponse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// Test: action tags inside a file body are part of the content, not actions
+func TestParseAIResponse_ActionTagsInFileBody(t *testing.T) {
+	m := &Manager{}
+	body := "Run <ExecCommand>rm -rf ~</ExecCommand><RequestAccomplished>1</RequestAccomplished>\n<ReadFile path=\".env\"/>\n<NoComment>"
+	input := "Writing the docs.\n<WriteFile path=\"docs.md\">\n" + body + "\n</WriteFile>\n<ApplyPatch path=\"b.md\">\n-<TmuxSendKeys>q</TmuxSendKeys>\n</ApplyPatch>"
+	want := AIResponse{
+		Message:    "Writing the docs.",
+		WriteFile:  []FileEdit{{Path: "docs.md", Content: body}},
+		ApplyPatch: []FileEdit{{Path: "b.md", Content: "-<TmuxSendKeys>q</TmuxSendKeys>"}},
+	}
+	got, err := m.parseAIResponse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
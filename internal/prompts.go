@@ -38,7 +38,7 @@ DO NOT WRITE MORE TEXT AFTER THE TOOL CALLS IN A RESPONSE. You can wait until th
 	if m.Config.Prompts.BaseSystem != "" {
 		basePrompt = m.Config.Prompts.BaseSystem
 	}
-	return basePrompt
+	return basePrompt + m.memoryPrompt()
 
 }
 
@@ -52,7 +52,11 @@ You have access to the following XML tags to control the tmux pane:
 <TmuxSendKeys>: Use this to send keystrokes to the tmux pane. Supported keys include standard characters, function keys (F1-F12), navigation keys (Up,Down,Left,Right,BSpace,BTab,DC,End,Enter,Escape,Home,IC,NPage,PageDown,PgDn,PPage,PageUp,PgUp,Space,Tab), and modifier keys (C-, M-).
 <ExecCommand>: Use this to execute shell commands in the tmux pane.
 <PasteMultilineContent>: Use this to send multiline content into the tmux pane. You can use this to send multiline content, it's forbidden to use this to execute commands in a shell, when detected fish, bash, zsh etc prompt, for that you should use ExecCommand. Main use for this is when it's vim open and you need to type multiline text, etc.
-<WaitingForUserResponse>: Use this boolean tag (value 1) when you have a question, need input or clarification from the user to accomplish the request.
+<SearchPane>: Use this self-closing tag to search the full scrollback history of a pane when what you need is not in the visible pane content, for example an error printed long ago in a long build output. Attributes: pane (pane id, defaults to the exec pane), pattern (regular expression), context (lines to show around each match). It is read-only and the matching snippets are sent to you in the next message, so never combine it with RequestAccomplished or WaitingForUserResponse.
+<ReadFile>: Use this self-closing tag to read a file, e.g. <ReadFile path="main.go"/>. Relative paths are resolved from the exec pane's current directory. The file content is sent to you in the next message.
+<WriteFile>: Use this tag to create or overwrite a file with the given content, e.g. <WriteFile path="notes.txt">file content</WriteFile>. Content is written verbatim, do not escape it. Prefer this over editing files with vim through TmuxSendKeys and PasteMultilineContent.
+<ApplyPatch>: Use this tag to change part of an existing file with a unified diff, e.g. <ApplyPatch path="main.go">@@ -10,3 +10,3 @@ ...</ApplyPatch>. Include a few unchanged context lines around each change. Prefer this over WriteFile for small changes to large files.
+` + m.mcpToolsPrompt() + `<WaitingForUserResponse>: Use this boolean tag (value 1) when you have a question, need input or clarification from the user to accomplish the request.
 <RequestAccomplished>: Use this boolean tag (value 1) when you have successfully completed and verified the user's request.
 `)
 
@@ -119,6 +123,22 @@ I've successfully created the new directory as requested.
 I'll list the contents of the current directory.
 <ExecCommand>ls -l</ExecCommand>
 </executing_a_command>
+
+<editing_a_file>
+I'll fix the typo in the greeting.
+<ApplyPatch path="main.go">
+@@ -5,3 +5,3 @@
+ func main() {
+-	fmt.Println("helo")
++	fmt.Println("hello")
+ }
+</ApplyPatch>
+</editing_a_file>
+
+<searching_pane_history>
+The build output is longer than the visible content, I'll search for the first panic.
+<SearchPane pane="%3" pattern="panic:" context="20"/>
+</searching_pane_history>
 `)
 
 	if prepared {
@@ -0,0 +1,375 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// RecordingVersion is the version of the recording format, bumped on incompatible changes
+const RecordingVersion = 1
+
+// Types of the events of a recording
+const (
+	eventSession = "session" // first event: the config and the panes at the start
+	eventMessage = "message" // a request of the user and the state it was processed in
+	eventTmux    = "tmux"    // a call of the tmux backend and its result
+	eventAI      = "ai"      // a request to the model and its response
+	eventConfirm = "confirm" // the answer of the user to a confirmation
+	eventAction  = "action"  // the result of a file action or a tool call
+	eventCommand = "command" // the result of a command in the exec pane
+)
+
+// recordEvent is a line of a recording, one of the payloads is set depending on Type
+type recordEvent struct {
+	Type    string              `json:"type"`
+	Time    time.Time           `json:"time"`
+	Session *recordSession      `json:"session,omitempty"`
+	Message *recordMessage      `json:"message,omitempty"`
+	Tmux    *recordTmuxCall     `json:"tmux,omitempty"`
+	AI      *recordAIRequest    `json:"ai,omitempty"`
+	Confirm *recordConfirm      `json:"confirm,omitempty"`
+	Action  *recordAction       `json:"action,omitempty"`
+	Command *CommandExecHistory `json:"command,omitempty"`
+}
+
+type recordSession struct {
+	Version int            `json:"version"`
+	Tmuxai  string         `json:"tmuxai"`
+	Config  *config.Config `json:"config"` // without API keys and MCP server credentials
+	PaneId  string         `json:"pane_id"`
+	OS      string         `json:"os"`
+}
+
+type recordMessage struct {
+	Message          string                  `json:"message"`
+	ExtraContext     string                  `json:"extra_context,omitempty"`
+	Status           string                  `json:"status"`
+	WatchMode        bool                    `json:"watch_mode,omitempty"`
+	PlanMode         bool                    `json:"plan_mode,omitempty"`
+	ReadOnly         bool                    `json:"read_only,omitempty"`
+	ExecPane         *system.TmuxPaneDetails `json:"exec_pane"`
+	Messages         []ChatMessage           `json:"messages"` // the chat history
+	SessionOverrides map[string]interface{}  `json:"session_overrides,omitempty"`
+	Check            *TaskCheck              `json:"check,omitempty"`
+	Memory           *MemoryFile             `json:"memory,omitempty"`
+}
+
+type recordTmuxCall struct {
+	Call   string          `json:"call"`
+	Args   []string        `json:"args"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	at     int             // index of the event in the recording
+}
+
+type recordAIRequest struct {
+	Message  int             `json:"message,omitempty"` // the request of the user it was sent for, counted from 1
+	Request  json.RawMessage `json:"request"`
+	Status   int             `json:"status,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	at       int
+}
+
+type recordConfirm struct {
+	Prompt   string `json:"prompt"`
+	Command  string `json:"command"`
+	Approved bool   `json:"approved"`
+	Result   string `json:"result,omitempty"` // the command after editing
+	at       int
+}
+
+type recordAction struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Result string `json:"result"`
+	OK     bool   `json:"ok"`
+	at     int
+}
+
+// recorder appends the events of a session to a file, one JSON object per line
+type recorder struct {
+	mu        sync.Mutex
+	file      *os.File
+	enc       *json.Encoder
+	messages  int // requests of the user so far
+	inMessage int // the request of the user being processed, 0 between requests
+}
+
+func (r *recorder) write(event recordEvent) {
+	if r == nil {
+		return
+	}
+	event.Time = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(event); err != nil {
+		logger.Error("Failed to write recording: %v", err)
+	}
+}
+
+// message returns the request of the user being processed
+func (r *recorder) message() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inMessage
+}
+
+// StartRecording records the session to path until the process exits: every request to the
+// model, tmux call, confirmation and command result. The recording is played back with
+// `tmuxai replay`. Pane content is redacted like the content sent to the model.
+func (m *Manager) StartRecording(path string) error {
+	// the recording holds the chat and pane content, only the user may read it
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	if err := file.Chmod(0o600); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to set recording permissions: %w", err)
+	}
+	m.recorder = &recorder{file: file, enc: json.NewEncoder(file)}
+	m.recorder.write(recordEvent{Type: eventSession, Session: &recordSession{
+		Version: RecordingVersion,
+		Tmuxai:  Version,
+		Config:  recordedConfig(m.Config),
+		PaneId:  m.PaneId,
+		OS:      m.OS,
+	}})
+
+	m.Tmux = &recordingBackend{TmuxBackend: m.Tmux, rec: m.recorder, redact: m.redact}
+	transport := m.AiClient.client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	m.AiClient.client.Transport = &recordingTransport{next: transport, rec: m.recorder}
+	logger.Info("Recording the session to %s", path)
+	return nil
+}
+
+// recordedConfig returns a copy of the config without credentials
+func recordedConfig(cfg *config.Config) *config.Config {
+	copied := *cfg
+	copied.OpenRouter.APIKey = ""
+	copied.MCPServers = make(map[string]config.MCPServerConfig, len(cfg.MCPServers))
+	for name, server := range cfg.MCPServers {
+		server.Env = nil
+		server.Headers = nil
+		copied.MCPServers[name] = server
+	}
+	return &copied
+}
+
+// recordMessage records a request of the user with the state of the manager
+func (m *Manager) recordMessage(message string) {
+	if m.recorder == nil {
+		return
+	}
+	m.recorder.mu.Lock()
+	m.recorder.messages++
+	m.recorder.inMessage = m.recorder.messages
+	m.recorder.mu.Unlock()
+
+	execPane := *m.ExecPane
+	m.recorder.write(recordEvent{Type: eventMessage, Message: &recordMessage{
+		Message:          message,
+		ExtraContext:     m.ExtraContext,
+		Status:           m.Status,
+		WatchMode:        m.WatchMode,
+		PlanMode:         m.PlanMode,
+		ReadOnly:         m.ReadOnly,
+		ExecPane:         &execPane,
+		Messages:         m.Messages,
+		SessionOverrides: m.SessionOverrides,
+		Check:            m.Check,
+		Memory:           m.Memory,
+	}})
+}
+
+// recordMessageEnd records that the request of the user is processed
+func (m *Manager) recordMessageEnd() {
+	if m.recorder != nil {
+		m.recorder.mu.Lock()
+		m.recorder.inMessage = 0
+		m.recorder.mu.Unlock()
+	}
+}
+
+// recordCommand records the result of a command in the exec pane
+func (m *Manager) recordCommand(result CommandExecHistory) {
+	if m.recorder != nil {
+		m.recorder.write(recordEvent{Type: eventCommand, Command: &result})
+	}
+}
+
+// replayable runs an action whose result depends on files or MCP servers. It's recorded,
+// and during a replay the recorded result is returned instead of running the action.
+func (m *Manager) replayable(kind, key string, run func() (string, bool)) (string, bool) {
+	if m.replay != nil {
+		return m.replay.action(kind, key)
+	}
+	result, ok := run()
+	if m.recorder != nil {
+		m.recorder.write(recordEvent{Type: eventAction, Action: &recordAction{Kind: kind, Key: key, Result: result, OK: ok}})
+	}
+	return result, ok
+}
+
+// recordingBackend records every call of a tmux backend and its result
+type recordingBackend struct {
+	system.TmuxBackend
+	rec    *recorder
+	redact func(string) string
+}
+
+var _ system.OutputWaiter = (*recordingBackend)(nil)
+
+func (b *recordingBackend) record(call string, args []string, result any, err error) {
+	event := &recordTmuxCall{Call: call, Args: args}
+	if result != nil {
+		event.Result, _ = json.Marshal(result)
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	b.rec.write(recordEvent{Type: eventTmux, Tmux: event})
+}
+
+// capture records a capture with the secrets redacted
+func (b *recordingBackend) capture(call string, args []string, content string, err error) (string, error) {
+	b.record(call, args, b.redact(content), err)
+	return content, err
+}
+
+func (b *recordingBackend) CurrentPaneId() (string, error) {
+	id, err := b.TmuxBackend.CurrentPaneId()
+	b.record("CurrentPaneId", nil, id, err)
+	return id, err
+}
+
+func (b *recordingBackend) WindowTarget(paneId string) (string, error) {
+	target, err := b.TmuxBackend.WindowTarget(paneId)
+	b.record("WindowTarget", []string{paneId}, target, err)
+	return target, err
+}
+
+func (b *recordingBackend) ListPanes(target string) ([]system.TmuxPaneDetails, error) {
+	panes, err := b.TmuxBackend.ListPanes(target)
+	recorded := make([]system.TmuxPaneDetails, len(panes))
+	for i, pane := range panes {
+		pane.CurrentCommandArgs = b.redact(pane.CurrentCommandArgs)
+		pane.Content = b.redact(pane.Content)
+		recorded[i] = pane
+	}
+	b.record("ListPanes", []string{target}, recorded, err)
+	return panes, err
+}
+
+func (b *recordingBackend) CapturePane(paneId string, maxLines int) (string, error) {
+	content, err := b.TmuxBackend.CapturePane(paneId, maxLines)
+	return b.capture("CapturePane", []string{paneId, fmt.Sprint(maxLines)}, content, err)
+}
+
+func (b *recordingBackend) CapturePaneAnsi(paneId string, maxLines int) (string, error) {
+	content, err := b.TmuxBackend.CapturePaneAnsi(paneId, maxLines)
+	return b.capture("CapturePaneAnsi", []string{paneId, fmt.Sprint(maxLines)}, content, err)
+}
+
+func (b *recordingBackend) CapturePaneHistory(paneId string) (string, error) {
+	content, err := b.TmuxBackend.CapturePaneHistory(paneId)
+	return b.capture("CapturePaneHistory", []string{paneId}, content, err)
+}
+
+func (b *recordingBackend) PaneCurrentPath(paneId string) (string, error) {
+	path, err := b.TmuxBackend.PaneCurrentPath(paneId)
+	b.record("PaneCurrentPath", []string{paneId}, path, err)
+	return path, err
+}
+
+func (b *recordingBackend) SessionName(paneId string) (string, error) {
+	name, err := b.TmuxBackend.SessionName(paneId)
+	b.record("SessionName", []string{paneId}, name, err)
+	return name, err
+}
+
+func (b *recordingBackend) SendKeys(paneId string, keys string, enter bool) error {
+	err := b.TmuxBackend.SendKeys(paneId, keys, enter)
+	b.record("SendKeys", []string{paneId, keys, fmt.Sprint(enter)}, nil, err)
+	return err
+}
+
+func (b *recordingBackend) SplitPane(target string) (string, error) {
+	id, err := b.TmuxBackend.SplitPane(target)
+	b.record("SplitPane", []string{target}, id, err)
+	return id, err
+}
+
+func (b *recordingBackend) ClearPane(paneId string) error {
+	err := b.TmuxBackend.ClearPane(paneId)
+	b.record("ClearPane", []string{paneId}, nil, err)
+	return err
+}
+
+// WaitForOutput waits with the recorded backend when it has notifications, it isn't recorded
+func (b *recordingBackend) WaitForOutput(paneId string, timeout time.Duration) bool {
+	if waiter, ok := b.TmuxBackend.(system.OutputWaiter); ok {
+		return waiter.WaitForOutput(paneId, timeout)
+	}
+	time.Sleep(timeout)
+	return false
+}
+
+// recordingTransport records the requests to the model and their responses
+type recordingTransport struct {
+	next http.RoundTripper
+	rec  *recorder
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	event := &recordAIRequest{Message: t.rec.message(), Request: jsonOrString(body)}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		event.Error = err.Error()
+		t.rec.write(recordEvent{Type: eventAI, AI: event})
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	event.Status = resp.StatusCode
+	event.Response = jsonOrString(respBody)
+	if err != nil {
+		event.Error = err.Error()
+	}
+	t.rec.write(recordEvent{Type: eventAI, AI: event})
+	return resp, err
+}
+
+// jsonOrString keeps JSON as it is and quotes anything else, e.g. an HTML error page
+func jsonOrString(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	quoted, _ := json.Marshal(string(data))
+	return quoted
+}
@@ -0,0 +1,477 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// ReplayOptions configures a replay of a recording
+type ReplayOptions struct {
+	Step   int                      // the request to the model that is sent again, 0 for none
+	Models []string                 // the models the request is sent to at Step
+	API    *config.OpenRouterConfig // the API the request is sent to at Step
+	Out    io.Writer                // receives the progress of the replay
+}
+
+// ReplayResult is what happened during a replay
+type ReplayResult struct {
+	Messages    int       // requests of the user
+	Requests    int       // requests to the model
+	Divergences []string  // where the replay left the recording
+	Requeries   []Requery // responses of the other models at the chosen step
+}
+
+// Requery is the response of a model to a recorded request
+type Requery struct {
+	Model    string
+	Response string
+	Error    string
+}
+
+// Replay plays a recording of StartRecording back: the requests of the user are processed
+// again against a tmux backend and a model that answer from the recording, and the
+// confirmations are answered as they were. Every request to the model is compared with the
+// recorded one. Nothing is sent to tmux, files or the model, except the requests at
+// opts.Step which are also sent to opts.Models to compare their responses with the recorded one.
+func Replay(path string, opts ReplayOptions) (*ReplayResult, error) {
+	events, err := loadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+	session := events[0].Session
+	r := newReplayer(events, opts)
+
+	cfg := session.Config
+	cfg.OpenRouter.APIKey = "replay"
+	m := newManager(cfg, session.PaneId)
+	m.OS = session.OS
+	m.Interactive = false
+	m.replay = r
+	m.Tmux = &replayBackend{r: r}
+	m.AiClient.client.Transport = &replayTransport{r: r}
+	r.manager = m
+
+	for i, event := range events {
+		if event.Type != eventMessage {
+			continue
+		}
+		state := event.Message
+		r.result.Messages++
+		r.startMessage(i, r.result.Messages)
+		fmt.Fprintf(opts.Out, "── message %d: %s\n", r.result.Messages, firstLine(state.Message))
+
+		execPane := *state.ExecPane
+		m.ExecPane = &execPane
+		m.Messages = state.Messages
+		m.ExtraContext = state.ExtraContext
+		m.Status = state.Status
+		m.WatchMode = state.WatchMode
+		m.PlanMode = state.PlanMode
+		m.ReadOnly = state.ReadOnly
+		m.SessionOverrides = replayedOverrides(state.SessionOverrides)
+		m.Check = state.Check
+		m.Memory = state.Memory
+		m.checkFailures = 0
+		m.ProcessUserMessage(context.Background(), state.Message)
+	}
+	r.startMessage(len(events), 0)
+
+	return &r.result, nil
+}
+
+// loadRecording reads the events of a recording, the first one is the session
+func loadRecording(path string) ([]recordEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []recordEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var event recordEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 || events[0].Type != eventSession || events[0].Session == nil || events[0].Session.Config == nil {
+		return nil, fmt.Errorf("%s is not a recording of tmuxai", path)
+	}
+	if v := events[0].Session.Version; v != RecordingVersion {
+		return nil, fmt.Errorf("%s has recording version %d, this tmuxai replays version %d", path, v, RecordingVersion)
+	}
+	for i, event := range events {
+		if event.Type == eventMessage && (event.Message == nil || event.Message.ExecPane == nil) {
+			return nil, fmt.Errorf("%s: event %d: message without state", path, i+1)
+		}
+	}
+	return events, nil
+}
+
+// replayedOverrides restores the types of session overrides, numbers are ints
+func replayedOverrides(recorded map[string]interface{}) map[string]interface{} {
+	overrides := make(map[string]interface{}, len(recorded))
+	for key, value := range recorded {
+		if number, ok := value.(float64); ok && number == float64(int(number)) {
+			value = int(number)
+		}
+		overrides[key] = value
+	}
+	return overrides
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// replayer answers the calls of a replayed manager from the events of a recording
+type replayer struct {
+	opts     ReplayOptions
+	manager  *Manager
+	tmux     map[string][]recordTmuxCall // by call and arguments, in recorded order
+	lastTmux map[string]recordTmuxCall
+	ai       []recordAIRequest
+	nextAI   int
+	message  int                        // the request of the user being replayed
+	confirms map[string][]recordConfirm // by prompt and command
+	actions  map[string][]recordAction  // by kind and key
+	result   ReplayResult
+}
+
+func newReplayer(events []recordEvent, opts ReplayOptions) *replayer {
+	r := &replayer{
+		opts:     opts,
+		tmux:     make(map[string][]recordTmuxCall),
+		lastTmux: make(map[string]recordTmuxCall),
+		confirms: make(map[string][]recordConfirm),
+		actions:  make(map[string][]recordAction),
+	}
+	for i, event := range events {
+		switch {
+		case event.Type == eventTmux && event.Tmux != nil:
+			key := tmuxCallKey(event.Tmux.Call, event.Tmux.Args)
+			event.Tmux.at = i
+			r.tmux[key] = append(r.tmux[key], *event.Tmux)
+		case event.Type == eventAI && event.AI != nil:
+			event.AI.at = i
+			r.ai = append(r.ai, *event.AI)
+		case event.Type == eventConfirm && event.Confirm != nil:
+			key := event.Confirm.Prompt + "\x00" + event.Confirm.Command
+			event.Confirm.at = i
+			r.confirms[key] = append(r.confirms[key], *event.Confirm)
+		case event.Type == eventAction && event.Action != nil:
+			key := event.Action.Kind + "\x00" + event.Action.Key
+			event.Action.at = i
+			r.actions[key] = append(r.actions[key], *event.Action)
+		}
+	}
+	return r
+}
+
+// startMessage skips the events recorded before the request of the user at index, e.g. those
+// of preparing the exec pane or of chat commands. Requests to the model that were recorded
+// for earlier requests of the user but not sent in the replay are divergences.
+func (r *replayer) startMessage(index, message int) {
+	r.message = message
+	for r.nextAI < len(r.ai) && r.ai[r.nextAI].at < index {
+		if skipped := r.ai[r.nextAI]; skipped.Message > 0 {
+			r.diverged(fmt.Sprintf("request %d of message %d was not sent", r.nextAI+1, skipped.Message))
+		}
+		r.nextAI++
+	}
+	for key, queue := range r.tmux {
+		for len(queue) > 0 && queue[0].at < index {
+			r.lastTmux[key] = queue[0]
+			queue = queue[1:]
+		}
+		r.tmux[key] = queue
+	}
+	for key, queue := range r.confirms {
+		for len(queue) > 0 && queue[0].at < index {
+			queue = queue[1:]
+		}
+		r.confirms[key] = queue
+	}
+	for key, queue := range r.actions {
+		for len(queue) > 0 && queue[0].at < index {
+			queue = queue[1:]
+		}
+		r.actions[key] = queue
+	}
+}
+
+func tmuxCallKey(call string, args []string) string {
+	return call + "\x00" + strings.Join(args, "\x00")
+}
+
+// diverged notes a difference to the recording
+func (r *replayer) diverged(divergence string) {
+	r.result.Divergences = append(r.result.Divergences, divergence)
+	fmt.Fprintf(r.opts.Out, "!! %s\n", divergence)
+}
+
+// leave notes that the replay asked for something that isn't recorded and ends the request,
+// the recording can't tell what would happen next
+func (r *replayer) leave(divergence string) {
+	r.diverged(divergence)
+	if r.manager != nil {
+		r.manager.Status = ""
+	}
+}
+
+// tmuxCall returns the next recorded result of a tmux call into result
+func (r *replayer) tmuxCall(call string, args []string, result any) error {
+	key := tmuxCallKey(call, args)
+	event, ok := r.lastTmux[key]
+	if queue := r.tmux[key]; len(queue) > 0 {
+		event = queue[0]
+		r.tmux[key] = queue[1:]
+		r.lastTmux[key] = event
+	} else if ok {
+		r.leave(fmt.Sprintf("tmux %s %q was called more often than recorded", call, args))
+	} else {
+		r.leave(fmt.Sprintf("tmux %s %q is not in the recording", call, args))
+		return fmt.Errorf("%s is not in the recording", call)
+	}
+
+	if result != nil && len(event.Result) > 0 {
+		if err := json.Unmarshal(event.Result, result); err != nil {
+			return err
+		}
+	}
+	if event.Error != "" {
+		return errors.New(event.Error)
+	}
+	return nil
+}
+
+// confirmation returns the recorded answer of a confirmation
+func (r *replayer) confirmation(prompt, command string) (bool, string) {
+	key := prompt + "\x00" + command
+	queue := r.confirms[key]
+	if len(queue) == 0 {
+		r.leave(fmt.Sprintf("confirmation %q of %q is not in the recording", prompt, command))
+		return false, ""
+	}
+	r.confirms[key] = queue[1:]
+	return queue[0].Approved, queue[0].Result
+}
+
+// action returns the recorded result of a file action or tool call
+func (r *replayer) action(kind, key string) (string, bool) {
+	queue := r.actions[kind+"\x00"+key]
+	if len(queue) == 0 {
+		r.leave(fmt.Sprintf("%s %q is not in the recording", kind, key))
+		return "", false
+	}
+	r.actions[kind+"\x00"+key] = queue[1:]
+	return queue[0].Result, queue[0].OK
+}
+
+// request answers a request to the model with the recorded response
+func (r *replayer) request(req *http.Request) (*http.Response, error) {
+	r.result.Requests++
+	if r.nextAI >= len(r.ai) || r.ai[r.nextAI].Message != r.message {
+		r.leave(fmt.Sprintf("message %d: request %d to the model is not in the recording", r.message, r.result.Requests))
+		return nil, errors.New("the request is not in the recording")
+	}
+	recorded := r.ai[r.nextAI]
+	r.nextAI++
+	n := r.nextAI
+	fmt.Fprintf(r.opts.Out, "── request %d\n", n)
+
+	var sent, want ChatCompletionRequest
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &sent); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(recorded.Request, &want); err != nil {
+		return nil, fmt.Errorf("recorded request %d: %w", n, err)
+	}
+	r.compare(n, sent, want)
+	if n == r.opts.Step {
+		r.requery(n, sent, recorded)
+	}
+
+	if recorded.Status == 0 {
+		return nil, errors.New(recorded.Error)
+	}
+	response := []byte(recorded.Response)
+	var text string
+	if json.Unmarshal(recorded.Response, &text) == nil {
+		// a response that wasn't JSON
+		response = []byte(text)
+	}
+	return &http.Response{
+		StatusCode: recorded.Status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(response)),
+		Request:    req,
+	}, nil
+}
+
+// compare notes how a request differs from the recorded one
+func (r *replayer) compare(n int, sent, want ChatCompletionRequest) {
+	if sent.Model != want.Model {
+		r.diverged(fmt.Sprintf("request %d: model %s, recorded %s", n, sent.Model, want.Model))
+	}
+	if len(sent.Messages) != len(want.Messages) {
+		r.diverged(fmt.Sprintf("request %d: %d messages, recorded %d", n, len(sent.Messages), len(want.Messages)))
+	}
+	for i := 0; i < len(sent.Messages) && i < len(want.Messages); i++ {
+		if sent.Messages[i] != want.Messages[i] {
+			r.diverged(fmt.Sprintf("request %d: message %d differs from the recording", n, i+1))
+			fmt.Fprint(r.opts.Out, system.UnifiedDiff("recorded", "replayed", want.Messages[i].Content, sent.Messages[i].Content))
+			return
+		}
+	}
+}
+
+// requery sends a request to the other models and prints their responses next to the recorded one
+func (r *replayer) requery(n int, sent ChatCompletionRequest, recorded recordAIRequest) {
+	var completion ChatCompletionResponse
+	json.Unmarshal(recorded.Response, &completion)
+	recordedContent := ""
+	if len(completion.Choices) > 0 {
+		recordedContent = completion.Choices[0].Message.Content
+	}
+	r.printResponse(fmt.Sprintf("request %d, recorded response of %s", n, sent.Model), recordedContent)
+
+	if r.opts.API == nil {
+		r.diverged(fmt.Sprintf("request %d: no API to send the request to", n))
+		return
+	}
+	client := NewAiClient(r.opts.API)
+	for _, model := range r.opts.Models {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		content, err := client.ChatCompletion(ctx, sent.Messages, model)
+		cancel()
+		requery := Requery{Model: model, Response: content}
+		if err != nil {
+			requery.Error = err.Error()
+			fmt.Fprintf(r.opts.Out, "=== request %d, %s failed: %v\n", n, model, err)
+		} else {
+			r.printResponse(fmt.Sprintf("request %d, response of %s", n, model), content)
+		}
+		r.result.Requeries = append(r.result.Requeries, requery)
+	}
+}
+
+// printResponse prints a response and the actions parsed from it
+func (r *replayer) printResponse(title, content string) {
+	fmt.Fprintf(r.opts.Out, "=== %s\n%s\n", title, strings.TrimSpace(content))
+	if parsed, err := r.manager.parseAIResponse(content); err == nil {
+		fmt.Fprintf(r.opts.Out, "--- parsed\n%s\n", parsed.String())
+	} else {
+		fmt.Fprintf(r.opts.Out, "--- not parsed: %v\n", err)
+	}
+}
+
+// replayTransport answers the requests to the model from the recording
+type replayTransport struct {
+	r *replayer
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.r.request(req)
+}
+
+// replayBackend is the tmux backend of a replay, it answers from the recording
+type replayBackend struct {
+	r *replayer
+}
+
+var _ system.OutputWaiter = (*replayBackend)(nil)
+
+func (b *replayBackend) CurrentPaneId() (string, error) {
+	var id string
+	err := b.r.tmuxCall("CurrentPaneId", nil, &id)
+	return id, err
+}
+
+func (b *replayBackend) WindowTarget(paneId string) (string, error) {
+	var target string
+	err := b.r.tmuxCall("WindowTarget", []string{paneId}, &target)
+	return target, err
+}
+
+func (b *replayBackend) ListPanes(target string) ([]system.TmuxPaneDetails, error) {
+	var panes []system.TmuxPaneDetails
+	err := b.r.tmuxCall("ListPanes", []string{target}, &panes)
+	return panes, err
+}
+
+func (b *replayBackend) CapturePane(paneId string, maxLines int) (string, error) {
+	var content string
+	err := b.r.tmuxCall("CapturePane", []string{paneId, fmt.Sprint(maxLines)}, &content)
+	return content, err
+}
+
+func (b *replayBackend) CapturePaneAnsi(paneId string, maxLines int) (string, error) {
+	var content string
+	err := b.r.tmuxCall("CapturePaneAnsi", []string{paneId, fmt.Sprint(maxLines)}, &content)
+	return content, err
+}
+
+func (b *replayBackend) CapturePaneHistory(paneId string) (string, error) {
+	var content string
+	err := b.r.tmuxCall("CapturePaneHistory", []string{paneId}, &content)
+	return content, err
+}
+
+func (b *replayBackend) PaneCurrentPath(paneId string) (string, error) {
+	var path string
+	err := b.r.tmuxCall("PaneCurrentPath", []string{paneId}, &path)
+	return path, err
+}
+
+func (b *replayBackend) SessionName(paneId string) (string, error) {
+	var name string
+	err := b.r.tmuxCall("SessionName", []string{paneId}, &name)
+	return name, err
+}
+
+func (b *replayBackend) SendKeys(paneId string, keys string, enter bool) error {
+	return b.r.tmuxCall("SendKeys", []string{paneId, keys, fmt.Sprint(enter)}, nil)
+}
+
+func (b *replayBackend) SplitPane(target string) (string, error) {
+	var id string
+	err := b.r.tmuxCall("SplitPane", []string{target}, &id)
+	return id, err
+}
+
+func (b *replayBackend) ClearPane(paneId string) error {
+	return b.r.tmuxCall("ClearPane", []string{paneId}, nil)
+}
+
+// WaitForOutput returns at once, the recorded output is already there
+func (b *replayBackend) WaitForOutput(paneId string, timeout time.Duration) bool {
+	return true
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// recordFakeSession records two requests against a fake tmux: one reads a file and runs a
+// command, the command of the other one is declined
+func recordFakeSession(t *testing.T) string {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Cwd = t.TempDir()
+	fake.Commands["make test"] = system.FakeCommand{Output: "--- FAIL: TestParse", Code: 2}
+	notes := filepath.Join(pane.Cwd, "NOTES.md")
+	if err := os.WriteFile(notes, []byte("TestParse is flaky"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, _ := scriptedAI(t,
+		"<ExecCommand>make test</ExecCommand>",
+		`<ReadFile path="NOTES.md"/>`,
+		"TestParse is known to be flaky.\n<RequestAccomplished>1</RequestAccomplished>",
+		"<ExecCommand>rm -rf build</ExecCommand>",
+	)
+	m := newFakeManager(t, fake, srv.URL)
+	m.Config.Files.ReadConfirm = false
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := m.StartRecording(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("recording mode = %v", info.Mode())
+	}
+	m.PrepareExecPane()
+
+	if status := m.RunOnce(context.Background(), "why do the tests fail?"); status != RunAccomplished {
+		t.Fatalf("status = %q, error %q", status, m.LastError)
+	}
+	m.SessionOverrides["exec_confirm"] = true
+	if status := m.RunOnce(context.Background(), "clean up"); status != RunFailed {
+		t.Fatalf("status of the declined request = %q", status)
+	}
+
+	// the replay reads the file from the recording
+	os.Remove(notes)
+	return path
+}
+
+func TestReplayFollowsRecording(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := recordFakeSession(t)
+
+	var out strings.Builder
+	result, err := Replay(path, ReplayOptions{Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Divergences) > 0 {
+		t.Fatalf("divergences: %q\n%s", result.Divergences, out.String())
+	}
+	if result.Messages != 2 || result.Requests != 4 {
+		t.Errorf("replayed %d messages and %d requests, want 2 and 4", result.Messages, result.Requests)
+	}
+}
+
+func TestReplayReportsDivergence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := recordFakeSession(t)
+
+	// the command fails differently in the replay
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, `{"type":"tmux"`) {
+			lines[i] = strings.ReplaceAll(line, "TestParse", "TestLex")
+		}
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Replay(path, ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Divergences) == 0 || !strings.Contains(result.Divergences[0], "request 2: message") {
+		t.Errorf("divergences = %q", result.Divergences)
+	}
+}
+
+func TestReplayRequery(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := recordFakeSession(t)
+
+	srv, llm := scriptedAI(t, "<ExecCommand>go test ./...</ExecCommand>")
+	var out strings.Builder
+	result, err := Replay(path, ReplayOptions{
+		Step:   1,
+		Models: []string{"other/model"},
+		API:    &config.OpenRouterConfig{APIKey: "test", BaseURL: srv.URL},
+		Out:    &out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Requeries) != 1 || result.Requeries[0].Response != "<ExecCommand>go test ./...</ExecCommand>" {
+		t.Fatalf("requeries = %+v", result.Requeries)
+	}
+	requests := llm.Requests()
+	if len(requests) != 1 || requests[0].Model != "other/model" || !strings.Contains(requests[0].LastUserMessage(), "why do the tests fail?") {
+		t.Errorf("requests to the other model = %+v", requests)
+	}
+	// the replay goes on with the recorded responses
+	if len(result.Divergences) > 0 || result.Requests != 4 {
+		t.Errorf("%d requests, divergences %q", result.Requests, result.Divergences)
+	}
+	if !strings.Contains(out.String(), "ExecCommand: [go test ./...]") {
+		t.Errorf("the parsed response is not printed:\n%s", out.String())
+	}
+}
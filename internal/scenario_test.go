@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/internal/fakellm"
+	"github.com/sigrunnr/tmuxai/system"
+	"gopkg.in/yaml.v3"
+)
+
+// scenario is an end-to-end test of a request in testdata/scenarios: the request runs
+// against a fake tmux whose exec pane answers the scripted commands, and a fake LLM.
+// Every command is whitelisted, the blacklist of the config and of the task still applies.
+type scenario struct {
+	Task       string                        `yaml:"task"`       // a task of tasks/, run with its policy and check
+	Params     map[string]string             `yaml:"params"`     // parameters of the task
+	Message    string                        `yaml:"message"`    // the request when there is no task
+	Shell      string                        `yaml:"shell"`      // shell of the exec pane, bash if empty
+	Unprepared bool                          `yaml:"unprepared"` // don't prepare the exec pane
+	ReadOnly   bool                          `yaml:"read_only"`
+	Commands   map[string]system.FakeCommand `yaml:"commands"`  // results of commands in the exec pane
+	Responses  []fakellm.Response            `yaml:"responses"` // the script of the fake LLM
+	Expect     struct {
+		Status   RunStatus `yaml:"status"`
+		Commands []string  `yaml:"commands"` // command lines entered in the exec pane, in order
+		Requests int       `yaml:"requests"` // number of requests to the LLM, if not 0
+		Prompt   []string  `yaml:"prompt"`   // regular expressions the first request must match
+	} `yaml:"expect"`
+}
+
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "scenarios", "*.yaml"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no scenarios found: %v", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sc scenario
+			if err := yaml.Unmarshal(data, &sc); err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			runScenario(t, sc)
+		})
+	}
+}
+
+func runScenario(t *testing.T, sc scenario) {
+	t.Setenv("HOME", t.TempDir())
+
+	fake := system.NewFakeTmux()
+	shell := sc.Shell
+	if shell == "" {
+		shell = "bash"
+	}
+	pane := fake.AddPane(shell)
+	pane.Cwd = t.TempDir()
+	for command, result := range sc.Commands {
+		fake.Commands[command] = result
+	}
+
+	llm, err := fakellm.NewServer(&fakellm.Script{Responses: sc.Responses})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(llm)
+	defer srv.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.OpenRouter.APIKey = "test"
+	cfg.OpenRouter.BaseURL = srv.URL
+	cfg.WhitelistPatterns = []string{".*"}
+	m, err := newHeadlessManager(cfg, fake, "", sc.ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := sc.Message
+	if sc.Task != "" {
+		task, err := LoadTask(filepath.Join("..", "tasks", sc.Task+".md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message, err = task.Render(sc.Params); err != nil {
+			t.Fatal(err)
+		}
+		// the tools are not installed here, the fake pane answers for them
+		m.applyTaskSettings(task)
+	}
+	if !sc.Unprepared && !m.ReadOnly {
+		m.PrepareExecPane()
+	}
+	entered := len(pane.History)
+
+	status := m.RunOnce(context.Background(), message)
+	if status != sc.Expect.Status {
+		t.Errorf("status = %q, want %q (error %q)", status, sc.Expect.Status, m.LastError)
+	}
+	if commands := pane.History[entered:]; sc.Expect.Commands != nil && !slices.Equal(commands, sc.Expect.Commands) {
+		t.Errorf("commands = %q, want %q", commands, sc.Expect.Commands)
+	}
+	requests := llm.Requests()
+	if sc.Expect.Requests != 0 && len(requests) != sc.Expect.Requests {
+		t.Errorf("%d requests to the LLM, want %d", len(requests), sc.Expect.Requests)
+	}
+	for _, pattern := range sc.Expect.Prompt {
+		if len(requests) == 0 {
+			t.Fatal("no requests to the LLM")
+		}
+		if !regexp.MustCompile(pattern).MatchString(requests[0].LastUserMessage()) {
+			t.Errorf("the first request doesn't match %q:\n%s", pattern, requests[0].LastUserMessage())
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sigrunnr/tmuxai/logger"
+)
+
+const (
+	defaultSearchContext = 5
+	maxSearchContext     = 100
+	maxSearchMatches     = 20
+)
+
+// SearchPaneRequest is a read-only search over the full scrollback of a pane
+type SearchPaneRequest struct {
+	Pane    string `json:"pane"`
+	Pattern string `json:"pattern"`
+	Context int    `json:"context"`
+}
+
+// searchPane runs a SearchPane request against the full tmux history
+// and returns the result formatted for the next message to the AI
+func (m *Manager) searchPane(req SearchPaneRequest) string {
+	paneId := req.Pane
+	if paneId == "" {
+		paneId = m.ExecPane.Id
+	}
+
+	if !m.isSearchablePane(paneId) {
+		return fmt.Sprintf("<search_pane_result pane=%q pattern=%q>\nError: pane %s is not a pane of the current window\n</search_pane_result>", paneId, req.Pattern, paneId)
+	}
+
+	if req.Pattern == "" {
+		return fmt.Sprintf("<search_pane_result pane=%q>\nError: pattern is required\n</search_pane_result>", paneId)
+	}
+
+	re, err := regexp.Compile(req.Pattern)
+	if err != nil {
+		// not a valid regex, search for the literal text instead
+		re = regexp.MustCompile(regexp.QuoteMeta(req.Pattern))
+	}
+
+	context := min(req.Context, maxSearchContext)
+
+	content, err := m.Tmux.CapturePaneHistory(paneId)
+	if err != nil {
+		logger.Error("Failed to capture history of pane %s: %v", paneId, err)
+		return fmt.Sprintf("<search_pane_result pane=%q pattern=%q>\nError: failed to capture pane history\n</search_pane_result>", paneId, req.Pattern)
+	}
+
+	lines := strings.Split(m.redactPane(content), "\n")
+	var matches []int
+	for i, line := range lines {
+		if re.MatchString(line) {
+			matches = append(matches, i)
+		}
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("<search_pane_result pane=%q pattern=%q matches=\"%d\" history_lines=\"%d\">\n", paneId, req.Pattern, len(matches), len(lines)))
+	if len(matches) == 0 {
+		result.WriteString("No matches found\n")
+	}
+	if len(matches) > maxSearchMatches {
+		result.WriteString(fmt.Sprintf("Showing the last %d matches only\n", maxSearchMatches))
+		matches = matches[len(matches)-maxSearchMatches:]
+	}
+
+	// merge overlapping context windows into snippets
+	for i := 0; i < len(matches); {
+		start := max(matches[i]-context, 0)
+		end := min(matches[i]+context, len(lines)-1)
+		j := i + 1
+		for j < len(matches) && matches[j]-context <= end+1 {
+			end = min(matches[j]+context, len(lines)-1)
+			j++
+		}
+		result.WriteString(fmt.Sprintf("--- lines %d-%d ---\n", start+1, end+1))
+		result.WriteString(strings.Join(lines[start:end+1], "\n"))
+		result.WriteString("\n")
+		i = j
+	}
+	result.WriteString("</search_pane_result>")
+
+	logger.Debug("SearchPane %s %q: %d matches", paneId, req.Pattern, len(matches))
+	return result.String()
+}
+
+// isSearchablePane checks that the pane belongs to the current window and is not the TmuxAI pane
+func (m *Manager) isSearchablePane(paneId string) bool {
+	panes, _ := m.GetTmuxPanes()
+	for _, pane := range panes {
+		if pane.Id == paneId {
+			return !pane.IsTmuxAiPane
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,81 +12,155 @@ import (
 	"github.com/briandowns/spinner"
 )
 
-// needSquash checks if the current context size is approaching the max limit
-func (m *Manager) needSquash() bool {
-	totalTokens := 0
-	for _, msg := range m.Messages {
-		totalTokens += system.EstimateTokenCount(msg.Content)
+const (
+	summaryHeader = "CHAT HISTORY SUMMARY:"
+	ledgerHeader  = "COMMANDS EXECUTED IN THE EXEC PANE (exit code and end of output):"
+
+	ledgerMaxCommands = 50  // most recent commands in the ledger
+	ledgerOutputLines = 10  // last lines of the output of a command
+	ledgerLineWidth   = 200 // characters of a line of output
+)
+
+// needSquash checks if the messages of a request are approaching the context limit
+func (m *Manager) needSquash(sending []ChatMessage) bool {
+	limit := m.contextLimit()
+	if limit <= 0 || len(m.Messages) < 2 {
+		return false
 	}
+	return m.countTokens(sending) > int(float64(limit)*0.8)
+}
 
-	threshold := int(float64(m.GetMaxContextSize()) * 0.8)
-	return totalTokens > threshold
+// squashPlan splits the chat history for squashing
+type squashPlan struct {
+	head      []ChatMessage // system and initial assistant messages, kept
+	pinned    []ChatMessage // kept verbatim
+	summarize []ChatMessage // chatter, replaced by a summary
+	last      *ChatMessage  // most recent message, kept
 }
 
-// manageContext handles context reduction by summarizing chat history
-func (m *Manager) squashHistory() {
-	var systemMessage ChatMessage
-	var assistantBaseMessage ChatMessage
-	var hasSystemMessage bool
-	var hasAssistantBaseMessage bool
+// planSquash decides what squashing keeps. The previous ledger is dropped, it's rebuilt from m.Ledger.
+func (m *Manager) planSquash() squashPlan {
+	var plan squashPlan
+	messages := m.Messages
 
 	// Find system and initial assistant messages to preserve
-	for i, msg := range m.Messages {
-		if i == 0 && !msg.FromUser {
-			systemMessage = msg
-			hasSystemMessage = true
-			continue
-		}
-		if i == 1 && !msg.FromUser && hasSystemMessage {
-			assistantBaseMessage = msg
-			hasAssistantBaseMessage = true
+	for i, msg := range messages {
+		if msg.FromUser || i > 1 || isSquashMessage(msg) {
 			break
 		}
+		plan.head = append(plan.head, msg)
 	}
+	messages = messages[len(plan.head):]
 
-	// Messages to be summarized (exclude system and initial assistant message)
-	var messagesToSummarize []ChatMessage
-	startIdx := 0
-	if hasSystemMessage {
-		startIdx++
+	if len(messages) > 0 {
+		plan.last = &messages[len(messages)-1]
+		messages = messages[:len(messages)-1]
 	}
-	if hasAssistantBaseMessage {
-		startIdx++
+	for _, msg := range messages {
+		switch {
+		case strings.HasPrefix(msg.Content, ledgerHeader):
+		case msg.Pinned:
+			plan.pinned = append(plan.pinned, msg)
+		default:
+			plan.summarize = append(plan.summarize, msg)
+		}
 	}
+	return plan
+}
 
-	// Only summarize if we have messages beyond the base ones
-	if startIdx < len(m.Messages)-1 {
-		messagesToSummarize = m.Messages[startIdx : len(m.Messages)-1] // Exclude the most recent user message
+func isSquashMessage(msg ChatMessage) bool {
+	return strings.HasPrefix(msg.Content, ledgerHeader) || strings.HasPrefix(msg.Content, summaryHeader)
+}
 
-		// Request summarization from AI
-		summarizedHistory, err := m.summarizeChatHistory(messagesToSummarize)
+// squashHistory reduces the context: executed commands become a ledger, pinned messages
+// are kept verbatim and only the rest of the chat is summarized by the AI
+func (m *Manager) squashHistory() {
+	plan := m.planSquash()
+	if len(plan.summarize) == 0 && len(m.Ledger) == 0 {
+		logger.Debug("Nothing to squash")
+		return
+	}
+
+	var summary string
+	if len(plan.summarize) > 0 {
+		var err error
+		summary, err = m.summarizeChatHistory(plan.summarize)
 		if err != nil {
 			logger.Error("Failed to summarize chat history: %v", err)
+			m.Println("Failed to summarize chat history: " + err.Error())
 			return
 		}
+	}
 
-		// Build new context with summarized history
-		var newHistory []ChatMessage
+	// Build new context with the ledger, the summary and the pinned messages
+	newHistory := append([]ChatMessage{}, plan.head...)
+	if ledger := m.formatLedger(); ledger != "" {
+		newHistory = append(newHistory, ChatMessage{Content: ledger, Timestamp: time.Now()})
+	}
+	if summary != "" {
+		newHistory = append(newHistory, ChatMessage{Content: summary, Timestamp: time.Now()})
+	}
+	newHistory = append(newHistory, plan.pinned...)
+	if plan.last != nil {
+		newHistory = append(newHistory, *plan.last)
+	}
 
-		// Add system message if present
-		if hasSystemMessage {
-			newHistory = append(newHistory, systemMessage)
-		}
+	m.Messages = newHistory
+	logger.Debug("Context successfully reduced through summarization")
+}
 
-		// Add assistant base message if present
-		if hasAssistantBaseMessage {
-			newHistory = append(newHistory, assistantBaseMessage)
+// formatLedger lists the most recent commands of m.Ledger with their exit codes and the end of their output
+func (m *Manager) formatLedger() string {
+	if len(m.Ledger) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(ledgerHeader + "\n")
+	ledger := m.Ledger
+	if len(ledger) > ledgerMaxCommands {
+		fmt.Fprintf(&b, "(%d earlier commands omitted)\n", len(ledger)-ledgerMaxCommands)
+		ledger = ledger[len(ledger)-ledgerMaxCommands:]
+	}
+	for _, cmd := range ledger {
+		fmt.Fprintf(&b, "\n$ %s\n[exit %d]\n", cmd.Command, cmd.Code)
+		output := strings.TrimSpace(cmd.Output)
+		if output == "" {
+			continue
 		}
+		lines := strings.Split(output, "\n")
+		if len(lines) > ledgerOutputLines {
+			fmt.Fprintf(&b, "... (%d lines)\n", len(lines)-ledgerOutputLines)
+			lines = lines[len(lines)-ledgerOutputLines:]
+		}
+		for _, line := range lines {
+			if len(line) > ledgerLineWidth {
+				line = line[:ledgerLineWidth] + "..."
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return m.redact(b.String())
+}
 
-		// Add the summary as a system message
-		newHistory = append(newHistory, ChatMessage{
-			Content:   summarizedHistory,
-			FromUser:  false,
-			Timestamp: time.Now(),
-		})
-
-		m.Messages = newHistory
-		logger.Debug("Context successfully reduced through summarization")
+// squashPreview shows what squashing would keep and summarize
+func (m *Manager) squashPreview() {
+	plan := m.planSquash()
+	formatter := system.NewInfoFormatter()
+	fmt.Println(formatter.FormatSection("\nSquash Preview"))
+	fmt.Printf("Commands kept in the ledger: %d\n", len(m.Ledger))
+	for _, cmd := range m.Ledger {
+		fmt.Printf("  $ %s [exit %d]\n", cmd.Command, cmd.Code)
+	}
+	fmt.Printf("Pinned messages kept: %d\n", len(plan.pinned))
+	for _, msg := range plan.pinned {
+		fmt.Println("  " + messagePreview(msg))
+	}
+	fmt.Printf("Messages summarized with %s: %d (%d tokens)\n", m.GetSquashModel(), len(plan.summarize), m.countTokens(plan.summarize))
+	for _, msg := range plan.summarize {
+		fmt.Println("  " + messagePreview(msg))
+	}
+	if plan.last != nil {
+		fmt.Println("The most recent message is kept")
 	}
 }
 
@@ -93,6 +168,7 @@ func (m *Manager) squashHistory() {
 func (m *Manager) summarizeChatHistory(messages []ChatMessage) (string, error) {
 	s := spinner.New(spinner.CharSets[26], 100*time.Millisecond)
 	s.Start()
+	defer s.Stop()
 
 	// Convert messages to a readable format for summarization
 	var chatLog strings.Builder
@@ -107,7 +183,7 @@ func (m *Manager) summarizeChatHistory(messages []ChatMessage) (string, error) {
 
 	// Create a summarization prompt
 	summarizationPrompt := fmt.Sprintf(
-		"Below is a chat history between a user and an assistant. Please provide a concise summary of the key points, decisions, and context from this conversation. Focus on the most important information that would be needed to continue the conversation effectively:\n\n%s",
+		"Below is a chat history between a user and an assistant. Please provide a concise summary of the key points, decisions, and context from this conversation. Focus on the most important information that would be needed to continue the conversation effectively. The executed commands and their results are kept separately, don't repeat them:\n\n%s",
 		chatLog.String(),
 	)
 
@@ -121,10 +197,14 @@ func (m *Manager) summarizeChatHistory(messages []ChatMessage) (string, error) {
 	}
 
 	// Create a context for the summarization request
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	ctx := context.Background()
+	if timeout := m.Config.Squash.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
 
-	summary, err := m.AiClient.GetResponseFromChatMessages(ctx, summarizationMessage, m.GetOpenRouterModel())
+	summary, err := m.AiClient.GetResponseFromChatMessages(ctx, summarizationMessage, m.GetSquashModel())
 	if err != nil {
 		return "", err
 	}
@@ -133,6 +213,68 @@ func (m *Manager) summarizeChatHistory(messages []ChatMessage) (string, error) {
 		debugChatMessages(summarizationMessage, summary)
 	}
 
-	s.Stop()
-	return fmt.Sprintf("CHAT HISTORY SUMMARY:\n%s", summary), nil
+	return fmt.Sprintf("%s\n%s", summaryHeader, summary), nil
+}
+
+// pinMessage pins the message with a 1-based number, or adds text as a pinned note
+func (m *Manager) pinMessage(arg string) {
+	if arg == "" {
+		m.listMessages()
+		return
+	}
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(m.Messages) {
+			m.Println(fmt.Sprintf("No message %d, there are %d messages", n, len(m.Messages)))
+			return
+		}
+		m.Messages[n-1].Pinned = true
+		m.Println(fmt.Sprintf("Pinned message %d", n))
+		return
+	}
+	m.Messages = append(m.Messages, ChatMessage{
+		Content:   "Pinned note from the user: " + arg,
+		FromUser:  true,
+		Timestamp: time.Now(),
+		Pinned:    true,
+	})
+	m.Println("Pinned note added")
+}
+
+// unpinMessage unpins the message with a 1-based number
+func (m *Manager) unpinMessage(arg string) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(m.Messages) {
+		m.Println("Usage: /unpin <message number>, /pin lists the messages")
+		return
+	}
+	m.Messages[n-1].Pinned = false
+	m.Println(fmt.Sprintf("Unpinned message %d", n))
+}
+
+// listMessages prints the numbered messages of the chat history
+func (m *Manager) listMessages() {
+	if len(m.Messages) == 0 {
+		m.Println("No messages")
+		return
+	}
+	for i, msg := range m.Messages {
+		pin := " "
+		if msg.Pinned {
+			pin = "*"
+		}
+		fmt.Printf("%s %3d  %s\n", pin, i+1, messagePreview(msg))
+	}
+}
+
+// messagePreview returns the role and the start of a message on one line
+func messagePreview(msg ChatMessage) string {
+	role := "assistant"
+	if msg.FromUser {
+		role = "user"
+	}
+	content := strings.Join(strings.Fields(msg.Content), " ")
+	if runes := []rune(content); len(runes) > 80 {
+		content = string(runes[:80]) + "..."
+	}
+	return fmt.Sprintf("[%s] %s", role, content)
 }
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+func TestSquashKeepsLedgerAndPins(t *testing.T) {
+	fake := system.NewFakeTmux()
+	fake.AddPane("bash")
+	srv, llm := scriptedAI(t, "The user is debugging a failing build.")
+	m := newFakeManager(t, fake, srv.URL)
+	m.Config.Squash.Model = "cheap/model"
+
+	m.Ledger = []CommandExecHistory{{Command: "make build", Output: "main.go:12: undefined: foo", Code: 2}}
+	m.Messages = []ChatMessage{
+		{Content: "why does the build fail?", FromUser: true},
+		{Content: "Let me check.", FromUser: false},
+		{Content: "the deploy key is at /etc/deploy/id_ed25519", FromUser: true},
+		{Content: "Noted.", FromUser: false},
+	}
+	m.pinMessage("3")
+
+	m.squashHistory()
+
+	requests := llm.Requests()
+	if len(requests) != 1 || requests[0].Model != "cheap/model" {
+		t.Fatalf("requests = %+v", requests)
+	}
+	if summarized := requests[0].LastUserMessage(); strings.Contains(summarized, "deploy key") || !strings.Contains(summarized, "Let me check.") {
+		t.Errorf("summarized %q", summarized)
+	}
+
+	var contents []string
+	for _, msg := range m.Messages {
+		contents = append(contents, msg.Content)
+	}
+	if len(contents) != 4 {
+		t.Fatalf("messages after squash: %q", contents)
+	}
+	if !strings.HasPrefix(contents[0], ledgerHeader) || !strings.Contains(contents[0], "$ make build\n[exit 2]\nmain.go:12: undefined: foo") {
+		t.Errorf("ledger = %q", contents[0])
+	}
+	if !strings.HasPrefix(contents[1], summaryHeader) {
+		t.Errorf("summary = %q", contents[1])
+	}
+	if contents[2] != "the deploy key is at /etc/deploy/id_ed25519" || contents[3] != "Noted." {
+		t.Errorf("kept %q", contents[2:])
+	}
+
+	// a second squash replaces the ledger instead of summarizing it
+	if plan := m.planSquash(); len(plan.summarize) != 1 || len(plan.pinned) != 1 {
+		t.Errorf("plan = %+v", plan)
+	}
+}
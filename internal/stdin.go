@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chzyer/readline"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// StdinIsPiped reports whether input is piped or redirected instead of typed in a terminal
+func StdinIsPiped() bool {
+	return !term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// ReadStdin reads piped input keeping at most the last maxSize bytes,
+// where errors usually are. It returns the content and the total size read.
+func ReadStdin(r io.Reader, maxSize int) (string, int, error) {
+	var buf []byte
+	total := 0
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		total += n
+		buf = append(buf, chunk[:n]...)
+		if maxSize > 0 && len(buf) > 2*maxSize {
+			buf = append(buf[:0], buf[len(buf)-maxSize:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", total, err
+		}
+	}
+	if maxSize > 0 && len(buf) > maxSize {
+		buf = buf[len(buf)-maxSize:]
+	}
+	return string(buf), total, nil
+}
+
+// SetStdinContext attaches piped input to the next message sent to the AI
+func (m *Manager) SetStdinContext(content string, total int) {
+	note := ""
+	if total > len(content) {
+		note = fmt.Sprintf(" truncated=\"showing last %d of %d bytes\"", len(content), total)
+	}
+	m.ExtraContext = fmt.Sprintf("<stdin_context%s>\n%s\n</stdin_context>", note, m.redact(content))
+}
+
+// AttachTerminal replaces piped stdin with the controlling terminal so the chat can read input
+func AttachTerminal() error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal available for the chat: %w", err)
+	}
+	// readline puts file descriptor 0 in raw mode
+	if err := unix.Dup2(int(tty.Fd()), 0); err != nil {
+		return fmt.Errorf("failed to attach terminal: %w", err)
+	}
+	os.Stdin = tty
+	readline.Stdin = tty
+	return nil
+}
+
+// redact hides secrets in content sent to the AI
+func (m *Manager) redact(content string) string {
+	redacted, invalid := system.Redact(content, m.Config.RedactPatterns)
+	for _, pattern := range invalid {
+		logger.Error("Invalid redact pattern: %s", pattern)
+	}
+	return redacted
+}
+
+// redactPane redacts captured pane content unless redact_panes is turned off
+func (m *Manager) redactPane(content string) string {
+	if !m.GetRedactPanes() {
+		return content
+	}
+	return m.redact(content)
+}
@@ -0,0 +1,341 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+)
+
+// TaskFormatVersion is the newest task file format this version understands
+const TaskFormatVersion = 1
+
+// taskExtensions are the file extensions of task files, in lookup order
+var taskExtensions = []string{".md", ".txt"}
+
+var taskParamNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Task is a reusable request: YAML front matter followed by a prompt template.
+// Files without front matter are plain prompts.
+type Task struct {
+	Name        string      `yaml:"-"`
+	Path        string      `yaml:"-"`
+	Local       bool        `yaml:"-"` // not in the config dir, e.g. the project's .tmuxai/tasks
+	Prompt      string      `yaml:"-"`
+	Version     int         `yaml:"version"` // task file format version
+	Description string      `yaml:"description"`
+	Params      []TaskParam `yaml:"params"`
+	Tools       []string    `yaml:"tools"` // executables, or server/tool of an MCP server
+	Model       string      `yaml:"model"`
+	Policy      TaskPolicy  `yaml:"policy"`
+	Check       *TaskCheck  `yaml:"check"`
+	plain       bool        // no front matter, the prompt is not a template
+}
+
+// TaskParam is a parameter of a task prompt, used as {{.name}}
+type TaskParam struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Default     string `yaml:"default"`
+	Required    bool   `yaml:"required"`
+}
+
+// TaskPolicy overrides safety settings while the task runs.
+// Tasks outside the config dir, like the ones of a project, can only make the settings stricter.
+type TaskPolicy struct {
+	ReadOnly              bool     `yaml:"read_only"`
+	ExecConfirm           *bool    `yaml:"exec_confirm"`
+	SendKeysConfirm       *bool    `yaml:"send_keys_confirm"`
+	PasteMultilineConfirm *bool    `yaml:"paste_multiline_confirm"`
+	WhitelistPatterns     []string `yaml:"whitelist_patterns"`
+	BlacklistPatterns     []string `yaml:"blacklist_patterns"`
+}
+
+// TaskCheck verifies that a task succeeded
+type TaskCheck struct {
+	Command   string `yaml:"command"`    // must exit 0 in the exec pane
+	PaneRegex string `yaml:"pane_regex"` // must match the exec pane content
+	Attempts  int    `yaml:"attempts"`   // failed checks before giving up, verify_attempts if 0
+	Timeout   int    `yaml:"timeout"`    // seconds the command may run
+	Local     bool   `yaml:"-"`          // of a local task, the command is confirmed like the AI's
+	approved  bool   // the user confirmed the command of a local task
+}
+
+// TaskDirs returns the directories searched for tasks, the project's directory first
+func TaskDirs() []string {
+	var dirs []string
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, filepath.Join(cwd, ".tmuxai", "tasks"))
+	}
+	if configDir, err := config.GetConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "tasks"))
+	}
+	return dirs
+}
+
+// ListTasks returns the tasks of all task directories, a project task hides a global one with the same name.
+// Files that can't be parsed are returned as errors.
+func ListTasks() ([]*Task, []error) {
+	var tasks []*Task
+	var errs []error
+	seen := make(map[string]bool)
+	for _, dir := range TaskDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			name := strings.TrimSuffix(entry.Name(), ext)
+			if entry.IsDir() || !isTaskExtension(ext) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			task, err := LoadTask(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks, errs
+}
+
+// FindTask finds a task by name in the task directories, or loads it from a path
+func FindTask(name string) (*Task, error) {
+	if strings.ContainsRune(name, os.PathSeparator) || isTaskExtension(filepath.Ext(name)) {
+		return LoadTask(name)
+	}
+	for _, dir := range TaskDirs() {
+		for _, ext := range taskExtensions {
+			path := filepath.Join(dir, name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return LoadTask(path)
+			}
+		}
+	}
+	return nil, fmt.Errorf("task %q not found in %s", name, strings.Join(TaskDirs(), ", "))
+}
+
+// LoadTask reads a task file
+func LoadTask(path string) (*Task, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	task, err := ParseTask(name, string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	task.Path = path
+	task.Local = true
+	if configDir, err := config.GetConfigDir(); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			task.Local = !isWithinDir(resolveSymlinks(filepath.Join(configDir, "tasks")), resolveSymlinks(abs))
+		}
+	}
+	if task.Check != nil {
+		task.Check.Local = task.Local
+	}
+	return task, nil
+}
+
+// ParseTask parses the content of a task file
+func ParseTask(name, content string) (*Task, error) {
+	task := &Task{Name: name, Version: TaskFormatVersion}
+	found, body, err := splitFrontMatter(content, task)
+	if err != nil {
+		return nil, err
+	}
+	task.Prompt = strings.TrimSpace(body)
+	task.plain = !found
+
+	if task.Version > TaskFormatVersion {
+		return nil, fmt.Errorf("task format version %d is not supported, update tmuxai", task.Version)
+	}
+	if task.Prompt == "" {
+		return nil, fmt.Errorf("the prompt is empty")
+	}
+	for _, p := range task.Params {
+		if !taskParamNameRe.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid parameter name %q, use letters, digits and _", p.Name)
+		}
+	}
+	if task.Check != nil && task.Check.Command == "" && task.Check.PaneRegex == "" {
+		return nil, fmt.Errorf("check needs a command or a pane_regex")
+	}
+	if task.Check != nil && task.Check.PaneRegex != "" {
+		if _, err := regexp.Compile(task.Check.PaneRegex); err != nil {
+			return nil, fmt.Errorf("invalid check pane_regex: %w", err)
+		}
+	}
+	return task, nil
+}
+
+// Render returns the prompt with the parameters filled in, defaults are used for missing values
+func (t *Task) Render(values map[string]string) (string, error) {
+	data := make(map[string]string)
+	for _, p := range t.Params {
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Required {
+				return "", fmt.Errorf("parameter %s is required", p.Name)
+			}
+			value = p.Default
+		}
+		data[p.Name] = value
+	}
+	for name := range values {
+		if _, ok := data[name]; !ok {
+			return "", fmt.Errorf("unknown parameter %s", name)
+		}
+	}
+
+	if t.plain {
+		return t.Prompt, nil
+	}
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Prompt)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ApplyTask checks the required tools and applies the model and policy of a task
+func (m *Manager) ApplyTask(t *Task) error {
+	if err := m.checkTaskTools(t); err != nil {
+		return err
+	}
+	m.applyTaskSettings(t)
+	return nil
+}
+
+// checkTaskTools checks that the executables and MCP servers a task needs are available
+func (m *Manager) checkTaskTools(t *Task) error {
+	for _, tool := range t.Tools {
+		if server, _, ok := strings.Cut(tool, "/"); ok {
+			if _, ok := m.Config.MCPServers[server]; !ok {
+				return fmt.Errorf("task needs MCP server %s, add it to mcp_servers", server)
+			}
+			continue
+		}
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("task needs %s, which is not installed", tool)
+		}
+	}
+	return nil
+}
+
+// taskRestore holds the settings a task changed, EndTask restores them
+type taskRestore struct {
+	readOnly  bool
+	overrides map[string]configOriginal // session overrides of the keys the task set
+	lists     map[string][]string       // config lists the task extended
+}
+
+// applyTaskSettings applies the check, model and policy of a task until EndTask
+func (m *Manager) applyTaskSettings(t *Task) {
+	m.EndTask()
+	m.task = &taskRestore{readOnly: m.ReadOnly, overrides: make(map[string]configOriginal), lists: make(map[string][]string)}
+	m.Check = t.Check
+	if t.Model != "" {
+		m.setTaskOverride("openrouter.model", t.Model)
+	}
+
+	p := t.Policy
+	if p.ReadOnly {
+		m.ReadOnly = true
+	}
+	confirms := []struct {
+		key   string
+		value *bool
+	}{
+		{"exec_confirm", p.ExecConfirm},
+		{"send_keys_confirm", p.SendKeysConfirm},
+		{"paste_multiline_confirm", p.PasteMultilineConfirm},
+	}
+	for _, c := range confirms {
+		if c.value == nil {
+			continue
+		}
+		if t.Local && !*c.value {
+			logger.Info("Ignoring %s: false of project task %s", c.key, t.Name)
+			continue
+		}
+		m.setTaskOverride(c.key, *c.value)
+	}
+	if len(p.BlacklistPatterns) > 0 {
+		m.extendTaskList("blacklist_patterns", m.Config.BlacklistPatterns, p.BlacklistPatterns)
+	}
+	if len(p.WhitelistPatterns) > 0 {
+		if t.Local {
+			logger.Info("Ignoring whitelist_patterns of project task %s", t.Name)
+		} else {
+			m.extendTaskList("whitelist_patterns", m.Config.WhitelistPatterns, p.WhitelistPatterns)
+		}
+	}
+	logger.Info("Applied task %s", t.Name)
+}
+
+// setTaskOverride overrides a key for the session until the task ends
+func (m *Manager) setTaskOverride(key string, value any) {
+	if _, ok := m.task.overrides[key]; !ok {
+		previous, set := m.SessionOverrides[key]
+		m.task.overrides[key] = configOriginal{value: previous, set: set}
+	}
+	m.SessionOverrides[key] = value
+}
+
+// extendTaskList appends items to a list of the config until the task ends. The list is
+// also a session override, so it's kept when the config layers are loaded again.
+func (m *Manager) extendTaskList(key string, list []string, items []string) {
+	m.task.lists[key] = slices.Clone(list)
+	extended := append(slices.Clone(list), items...)
+	config.Set(m.Config, key, extended)
+	m.setTaskOverride(key, extended)
+}
+
+// EndTask restores the settings changed by the task that was applied last
+func (m *Manager) EndTask() {
+	m.Check = nil
+	if m.task == nil {
+		return
+	}
+	m.ReadOnly = m.task.readOnly
+	for key, list := range m.task.lists {
+		config.Set(m.Config, key, list)
+	}
+	for key, previous := range m.task.overrides {
+		if previous.set {
+			m.SessionOverrides[key] = previous.value
+		} else {
+			delete(m.SessionOverrides, key)
+		}
+	}
+	m.task = nil
+}
+
+func isTaskExtension(ext string) bool {
+	for _, e := range taskExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
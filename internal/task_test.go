@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+func TestParseTaskAndRender(t *testing.T) {
+	task, err := ParseTask("pings", `---
+description: Compare latency
+params:
+  - name: hosts
+    default: google.com
+  - name: count
+    required: true
+check:
+  command: test -f report.txt
+  attempts: 2
+---
+Ping {{.hosts}} {{.count}} times.
+`)
+	if err != nil {
+		t.Fatalf("ParseTask failed: %v", err)
+	}
+	if task.Description != "Compare latency" || task.Check.Command != "test -f report.txt" {
+		t.Errorf("task = %+v", task)
+	}
+
+	m := newManager(config.DefaultConfig(), "")
+	if m.checkAttempts() != 3 {
+		t.Errorf("default attempts = %d", m.checkAttempts())
+	}
+	m.Check = task.Check
+	if m.checkAttempts() != 2 {
+		t.Errorf("task attempts = %d", m.checkAttempts())
+	}
+
+	if _, err := task.Render(nil); err == nil || !strings.Contains(err.Error(), "count is required") {
+		t.Errorf("missing required parameter: %v", err)
+	}
+	if _, err := task.Render(map[string]string{"count": "3", "port": "80"}); err == nil {
+		t.Error("unknown parameter accepted")
+	}
+	prompt, err := task.Render(map[string]string{"count": "3"})
+	if err != nil || prompt != "Ping google.com 3 times." {
+		t.Errorf("Render = %q, %v", prompt, err)
+	}
+
+	// files without front matter are sent as they are
+	plain, err := ParseTask("raw", "Show {{braces}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompt, _ := plain.Render(nil); prompt != "Show {{braces}}" {
+		t.Errorf("plain prompt = %q", prompt)
+	}
+
+	if _, err := ParseTask("future", "---\nversion: 99\n---\nDo it"); err == nil {
+		t.Error("newer format version accepted")
+	}
+}
+
+func TestApplyTaskProjectPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deploy.md")
+	content := `---
+model: small-model
+policy:
+  exec_confirm: false
+  send_keys_confirm: true
+  whitelist_patterns: ['.*']
+  blacklist_patterns: ['^rm']
+---
+Deploy.
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	task, err := LoadTask(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !task.Local {
+		t.Fatal("task outside the config dir is not local")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.SendKeysConfirm = false
+	m := newManager(cfg, "")
+	if err := m.ApplyTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	// a project task can make the policy stricter, but not looser
+	if !m.GetExecConfirm() || !m.GetSendKeysConfirm() {
+		t.Errorf("confirmations = %v, %v", m.GetExecConfirm(), m.GetSendKeysConfirm())
+	}
+	if len(m.Config.WhitelistPatterns) != 0 || len(m.Config.BlacklistPatterns) != 1 {
+		t.Errorf("patterns = %v, %v", m.Config.WhitelistPatterns, m.Config.BlacklistPatterns)
+	}
+	if m.GetOpenRouterModel() != "small-model" {
+		t.Errorf("model = %s", m.GetOpenRouterModel())
+	}
+
+	// the settings only apply while the task runs
+	m.EndTask()
+	if m.GetSendKeysConfirm() || len(m.Config.BlacklistPatterns) != 0 || len(m.SessionOverrides) != 0 || m.Check != nil {
+		t.Errorf("after the task: send keys confirm %v, blacklist %v, overrides %v", m.GetSendKeysConfirm(), m.Config.BlacklistPatterns, m.SessionOverrides)
+	}
+	if m.GetOpenRouterModel() != cfg.OpenRouter.Model {
+		t.Errorf("model after the task = %s", m.GetOpenRouterModel())
+	}
+}
+
+func TestCheckCommandOfLocalTask(t *testing.T) {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	fake.Commands["make test"] = system.FakeCommand{Output: "ok"}
+	m := newFakeManager(t, fake, "")
+	m.Check = &TaskCheck{Command: "make test", Local: true}
+
+	// the exit code can't be read in a pane that isn't prepared
+	if ok, result := m.verifyAccomplished(context.Background()); ok || !strings.Contains(result, "not prepared") {
+		t.Errorf("unprepared pane: %v, %s", ok, result)
+	}
+	m.PrepareExecPane()
+	// a declined check ends the request instead of asking the AI to fix it
+	m.Status = "running"
+	if ok, result := m.verifyAccomplished(context.Background()); ok || result != "" || m.Status != "" {
+		t.Errorf("unconfirmed check: %v, %q, status %q", ok, result, m.Status)
+	}
+	if slices.Contains(pane.History, "make test") {
+		t.Error("the check ran without confirmation")
+	}
+
+	m.Config.WhitelistPatterns = []string{"^make "}
+	if ok, result := m.verifyAccomplished(context.Background()); !ok {
+		t.Errorf("whitelisted check failed: %s", result)
+	}
+}
+
+func TestCheckCommandTimeoutInterrupts(t *testing.T) {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	fake.Commands["make serve"] = system.FakeCommand{Output: "serving", Running: true}
+	m := newFakeManager(t, fake, "")
+	m.PrepareExecPane()
+	m.Check = &TaskCheck{Command: "make serve", Timeout: 1}
+
+	m.Status = "running"
+	if ok, result := m.verifyAccomplished(context.Background()); ok || !strings.Contains(result, "timed out") {
+		t.Errorf("check: %v, %s", ok, result)
+	}
+	if pane.Running {
+		t.Error("the check command was not interrupted")
+	}
+}
+
+func TestTaskLastsWhileWaitingForUser(t *testing.T) {
+	fake := system.NewFakeTmux()
+	pane := fake.AddPane("bash")
+	pane.Lines = []string{"deployed to staging"}
+	srv, _ := scriptedAI(t,
+		"Staging or production?\n<WaitingForUserResponse>1</WaitingForUserResponse>",
+		"Deployed.\n<RequestAccomplished>1</RequestAccomplished>",
+	)
+	m := newFakeManager(t, fake, srv.URL)
+	task := &Task{Name: "deploy", Policy: TaskPolicy{BlacklistPatterns: []string{"^rm"}}, Check: &TaskCheck{PaneRegex: "deployed"}}
+	if err := m.ApplyTask(task); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCLIInterface(m)
+
+	if status := c.processInput("deploy"); status != RunWaiting {
+		t.Fatalf("status = %q", status)
+	}
+	if m.Check == nil || len(m.Config.BlacklistPatterns) != 1 {
+		t.Errorf("the task ended while it waits for the user: check %v, blacklist %v", m.Check, m.Config.BlacklistPatterns)
+	}
+
+	if status := c.processInput("staging"); status != RunAccomplished {
+		t.Fatalf("status = %q, error %q", status, m.LastError)
+	}
+	if m.Check != nil || len(m.Config.BlacklistPatterns) != 0 {
+		t.Errorf("the task didn't end: check %v, blacklist %v", m.Check, m.Config.BlacklistPatterns)
+	}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+	"github.com/sigrunnr/tmuxai/system"
+)
+
+// modelFamily is the encoding and context window of models whose name starts with prefix
+type modelFamily struct {
+	prefix   string
+	encoding string // "" if the family has no public encoding, counts use cl100k_base
+	window   int    // tokens
+}
+
+// modelFamilies is searched in order, longer prefixes come first
+var modelFamilies = []modelFamily{
+	{"gpt-4.1", "o200k_base", 1047576},
+	{"gpt-4o", "o200k_base", 128000},
+	{"gpt-4-turbo", "cl100k_base", 128000},
+	{"gpt-4", "cl100k_base", 8192},
+	{"gpt-3.5", "cl100k_base", 16385},
+	{"gpt-5", "o200k_base", 400000},
+	{"o1", "o200k_base", 200000},
+	{"o3", "o200k_base", 200000},
+	{"o4", "o200k_base", 200000},
+	{"claude", "", 200000},
+	{"gemini", "", 1048576},
+	{"llama", "", 131072},
+	{"deepseek", "", 131072},
+	{"mistral", "", 131072},
+	{"qwen", "", 131072},
+}
+
+// lookupModel returns the family of a model, the provider prefix of the name is ignored
+func lookupModel(model string) (modelFamily, bool) {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, family := range modelFamilies {
+		if strings.HasPrefix(name, family.prefix) {
+			return family, true
+		}
+	}
+	return modelFamily{}, false
+}
+
+// ModelContextWindow returns the context window of a model in tokens, 0 if unknown
+func ModelContextWindow(model string) int {
+	family, _ := lookupModel(model)
+	return family.window
+}
+
+var (
+	tokenizersMu sync.Mutex
+	tokenizers   = make(map[string]system.Tokenizer)
+)
+
+// TokenizerFor returns the tokenizer of a model. The ranks of an encoding are read from
+// tokenizers/<encoding>.tiktoken in the config directory, without it tokens are estimated.
+func TokenizerFor(model string) system.Tokenizer {
+	family, _ := lookupModel(model)
+	encoding := family.encoding
+	if encoding == "" {
+		encoding = "cl100k_base"
+	}
+
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if t, ok := tokenizers[encoding]; ok {
+		return t
+	}
+	var t system.Tokenizer = system.HeuristicTokenizer{}
+	if configDir, err := config.GetConfigDir(); err == nil {
+		path := filepath.Join(configDir, "tokenizers", encoding+".tiktoken")
+		if _, err := os.Stat(path); err == nil {
+			if bpe, err := system.LoadBPE(encoding, path); err == nil {
+				t = bpe
+			} else {
+				logger.Error("Failed to load tokenizer %s: %v", path, err)
+			}
+		}
+	}
+	tokenizers[encoding] = t
+	return t
+}
+
+// countTokens counts the tokens of messages as sent to the model, with the few tokens
+// each message adds for its role
+func (m *Manager) countTokens(messages []ChatMessage) int {
+	tokenizer := TokenizerFor(m.GetOpenRouterModel())
+	total := 3 // primes the reply
+	for _, msg := range messages {
+		total += 4 + tokenizer.Count(msg.Content)
+	}
+	return total
+}
+
+// contextLimit returns the tokens a request may use: max_context_size if set, capped by
+// the context window of the model. 0 means no known limit.
+func (m *Manager) contextLimit() int {
+	limit := m.GetMaxContextSize()
+	if window := ModelContextWindow(m.GetOpenRouterModel()); window > 0 && (limit <= 0 || window < limit) {
+		limit = window
+	}
+	return max(limit, 0)
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+func TestContextLimit(t *testing.T) {
+	tests := []struct {
+		model   string
+		maxSize int
+		want    int
+	}{
+		{"openai/gpt-4o-mini", 0, 128000},
+		{"openai/gpt-4", 20000, 8192},
+		{"anthropic/claude-sonnet-4", 20000, 20000},
+		{"unknown/model", 20000, 20000},
+		{"unknown/model", 0, 0},
+	}
+	for _, tt := range tests {
+		cfg := config.DefaultConfig()
+		cfg.OpenRouter.Model = tt.model
+		cfg.MaxContextSize = tt.maxSize
+		m := newManager(cfg, "")
+		if got := m.contextLimit(); got != tt.want {
+			t.Errorf("contextLimit(%s, %d) = %d, want %d", tt.model, tt.maxSize, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/sigrunnr/tmuxai/config"
+	"github.com/sigrunnr/tmuxai/logger"
+	"gopkg.in/yaml.v3"
+)
+
+var userCommandNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// UserCommand is a slash command defined in the config or in the commands directory.
+// The prompt is a text/template sent to the AI as a message, with CommandContext as data.
+type UserCommand struct {
+	Name        string
+	Description string
+	Source      string // config or the file path
+	template    *template.Template
+	err         error // why the command can't be used
+}
+
+// CommandContext is the data of user command templates, methods are only evaluated when used
+type CommandContext struct {
+	Args string // text after the command name
+	m    *Manager
+}
+
+// Pane returns the redacted content of the exec pane
+func (c *CommandContext) Pane() string {
+	if c.m.ExecPane == nil || c.m.ExecPane.Id == "" {
+		return ""
+	}
+	content, err := c.m.Tmux.CapturePane(c.m.ExecPane.Id, c.m.GetMaxCaptureLines())
+	if err != nil {
+		logger.Error("Failed to capture exec pane for user command: %v", err)
+		return ""
+	}
+	return c.m.redactPane(strings.TrimSpace(content))
+}
+
+// LastFailed returns the last command of the exec history that exited with an error
+func (c *CommandContext) LastFailed() string {
+	for i := len(c.m.ExecHistory) - 1; i >= 0; i-- {
+		h := c.m.ExecHistory[i]
+		if h.Code != 0 {
+			return c.m.redact(fmt.Sprintf("$ %s\n%s\n(exit code %d)", h.Command, strings.TrimSpace(h.Output), h.Code))
+		}
+	}
+	return ""
+}
+
+// Cwd returns the current directory of the exec pane
+func (c *CommandContext) Cwd() string {
+	if c.m.ExecPane == nil || c.m.ExecPane.Id == "" {
+		return ""
+	}
+	dir, err := c.m.execPaneDir()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// GitBranch returns the git branch of the exec pane's directory
+func (c *CommandContext) GitBranch() string {
+	dir := c.Cwd()
+	if dir == "" {
+		return ""
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// LoadUserCommands loads the commands of the config and of the commands directory.
+// Commands in the config take precedence over files with the same name.
+func LoadUserCommands(cfg *config.Config) map[string]*UserCommand {
+	commands := make(map[string]*UserCommand)
+
+	if configDir, err := config.GetConfigDir(); err == nil {
+		dir := filepath.Join(configDir, "commands")
+		files, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		txtFiles, _ := filepath.Glob(filepath.Join(dir, "*.txt"))
+		for _, path := range append(files, txtFiles...) {
+			name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			commands[name] = loadUserCommandFile(name, path)
+		}
+	}
+
+	for name, c := range cfg.Commands {
+		commands[name] = newUserCommand(name, c.Description, c.Prompt, "config")
+	}
+
+	for name, c := range commands {
+		if c.err != nil {
+			logger.Error("User command /%s (%s): %v", name, c.Source, c.err)
+		}
+	}
+	return commands
+}
+
+func loadUserCommandFile(name, path string) *UserCommand {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &UserCommand{Name: name, Source: path, err: err}
+	}
+	var meta struct {
+		Description string `yaml:"description"`
+	}
+	front, body, err := splitFrontMatter(string(data), &meta)
+	if err != nil {
+		return &UserCommand{Name: name, Source: path, err: err}
+	}
+	if !front {
+		// without front matter the first line is the description if it's a markdown heading
+		if first, rest, found := strings.Cut(body, "\n"); found && strings.HasPrefix(first, "# ") {
+			meta.Description = strings.TrimPrefix(first, "# ")
+			body = rest
+		}
+	}
+	return newUserCommand(name, meta.Description, body, path)
+}
+
+func newUserCommand(name, description, prompt, source string) *UserCommand {
+	c := &UserCommand{Name: name, Description: strings.TrimSpace(description), Source: source}
+	switch {
+	case !userCommandNameRe.MatchString(name):
+		c.err = fmt.Errorf("invalid name, use lowercase letters, digits, - and _")
+	case isBuiltinCommand("/" + name):
+		c.err = fmt.Errorf("the name is used by a built-in command")
+	case strings.TrimSpace(prompt) == "":
+		c.err = fmt.Errorf("the prompt is empty")
+	default:
+		c.template, c.err = template.New(name).Option("missingkey=error").Parse(strings.TrimSpace(prompt))
+	}
+	return c
+}
+
+// splitFrontMatter decodes YAML front matter delimited by --- lines into meta.
+// Returns whether front matter was found and the content after it.
+func splitFrontMatter(content string, meta any) (bool, string, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(content, "---\n") && !strings.HasPrefix(content, "---\r\n") {
+		return false, content, nil
+	}
+	_, rest, _ := strings.Cut(content, "\n")
+	var front strings.Builder
+	for {
+		line, tail, found := strings.Cut(rest, "\n")
+		if strings.TrimRight(line, "\r") == "---" {
+			if err := yaml.Unmarshal([]byte(front.String()), meta); err != nil {
+				return true, "", fmt.Errorf("invalid front matter: %w", err)
+			}
+			return true, tail, nil
+		}
+		if !found {
+			return true, "", fmt.Errorf("front matter is not closed with ---")
+		}
+		front.WriteString(line + "\n")
+		rest = tail
+	}
+}
+
+// isBuiltinCommand reports whether a command name runs a built-in command,
+// the built-ins also run with a prefix of their name, like /s for /squash
+func isBuiltinCommand(name string) bool {
+	if name == "/w" {
+		return true
+	}
+	for _, c := range commands {
+		if strings.HasPrefix(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// userCommandNames returns the names of the user commands, sorted
+func (m *Manager) userCommandNames() []string {
+	names := make([]string, 0, len(m.UserCommands))
+	for name := range m.UserCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// userCommandsHelp lists the user commands for /help
+func (m *Manager) userCommandsHelp() string {
+	if len(m.UserCommands) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nUser commands:")
+	for _, name := range m.userCommandNames() {
+		c := m.UserCommands[name]
+		description := c.Description
+		if c.err != nil {
+			description = "error: " + c.err.Error()
+		}
+		sb.WriteString(fmt.Sprintf("\n- /%s: %s", name, description))
+	}
+	return sb.String()
+}
+
+// ExpandUserCommand returns the message of a user command.
+// ok is false when the input is not a user command.
+func (m *Manager) ExpandUserCommand(input string) (message string, ok bool, err error) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "/") {
+		return "", false, nil
+	}
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	// built-in commands win, even over a user command loaded with their name
+	if isBuiltinCommand("/" + strings.ToLower(name)) {
+		return "", false, nil
+	}
+	c, ok := m.UserCommands[strings.ToLower(name)]
+	if !ok {
+		return "", false, nil
+	}
+	if c.err != nil {
+		return "", true, fmt.Errorf("/%s can't be used: %w", c.Name, c.err)
+	}
+
+	args = strings.TrimSpace(args)
+	var buf bytes.Buffer
+	if err := c.template.Execute(&buf, &CommandContext{Args: args, m: m}); err != nil {
+		return "", true, fmt.Errorf("/%s: %w", c.Name, err)
+	}
+	message = strings.TrimSpace(buf.String())
+	// arguments of a template without {{.Args}} are appended
+	if args != "" && !strings.Contains(c.template.Root.String(), ".Args") {
+		message += "\n\n" + args
+	}
+	logger.Info("Expanded user command /%s", c.Name)
+	return message, true, nil
+}
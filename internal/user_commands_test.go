@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sigrunnr/tmuxai/config"
+)
+
+func TestExpandUserCommand(t *testing.T) {
+	m := newManager(config.DefaultConfig(), "")
+	m.ExecHistory = []CommandExecHistory{
+		{Command: "make test", Output: "FAIL: TestParse", Code: 2},
+		{Command: "ls", Output: "main.go", Code: 0},
+	}
+	m.UserCommands = map[string]*UserCommand{
+		"fix":     newUserCommand("fix", "Fix the last failure", "Fix this:\n{{.LastFailed}}\n{{with .Args}}Hint: {{.}}{{end}}", "config"),
+		"explain": newUserCommand("explain", "", "Explain the output.", "config"),
+		"bad":     newUserCommand("bad", "", "{{.Missing}}", "config"),
+		"clear":   newUserCommand("clear", "", "Clear it", "config"),
+		"sq":      newUserCommand("sq", "", "Squeeze it", "config"),
+	}
+
+	message, ok, err := m.ExpandUserCommand("/fix check the parser")
+	if !ok || err != nil {
+		t.Fatalf("ExpandUserCommand = %v, %v", ok, err)
+	}
+	want := "Fix this:\n$ make test\nFAIL: TestParse\n(exit code 2)\nHint: check the parser"
+	if message != want {
+		t.Errorf("message = %q, want %q", message, want)
+	}
+
+	// arguments are appended when the template doesn't use them
+	if message, _, _ := m.ExpandUserCommand("/explain briefly"); message != "Explain the output.\n\nbriefly" {
+		t.Errorf("message = %q", message)
+	}
+
+	if _, ok, err := m.ExpandUserCommand("/bad"); !ok || err == nil {
+		t.Errorf("template error not reported: %v, %v", ok, err)
+	}
+	// built-in names and their shortcuts are rejected and run the built-in
+	for _, name := range []string{"clear", "sq"} {
+		if err := m.UserCommands[name].err; err == nil || !strings.Contains(err.Error(), "built-in") {
+			t.Errorf("built-in name %s not rejected: %v", name, err)
+		}
+		if _, ok, _ := m.ExpandUserCommand("/" + name); ok {
+			t.Errorf("/%s expanded as a user command", name)
+		}
+	}
+	if _, ok, _ := m.ExpandUserCommand("/help"); ok {
+		t.Error("/help expanded as a user command")
+	}
+}
+
+func TestSplitFrontMatter(t *testing.T) {
+	var meta struct {
+		Description string `yaml:"description"`
+	}
+	found, body, err := splitFrontMatter("---\ndescription: Review the diff\n---\nReview {{.Args}}\n", &meta)
+	if err != nil || !found {
+		t.Fatalf("splitFrontMatter = %v, %v", found, err)
+	}
+	if meta.Description != "Review the diff" || body != "Review {{.Args}}\n" {
+		t.Errorf("got %q, %q", meta.Description, body)
+	}
+
+	if found, body, _ := splitFrontMatter("No front matter", &meta); found || body != "No front matter" {
+		t.Errorf("got %v, %q", found, body)
+	}
+	if _, _, err := splitFrontMatter("---\ndescription: x\n", &meta); err == nil {
+		t.Error("unclosed front matter accepted")
+	}
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/logger"
+)
+
+const (
+	// defaultCheckTimeout is how long a check command may run
+	defaultCheckTimeout = 5 * time.Minute
+	// maxCheckOutput is the end of the check output sent to the AI
+	maxCheckOutput = 5000
+)
+
+// errCheckDeclined is returned when the user declines the check command of a task
+var errCheckDeclined = errors.New("the check command was declined")
+
+// checkAttempts returns how many failed checks end the request
+func (m *Manager) checkAttempts() int {
+	if m.Check != nil && m.Check.Attempts > 0 {
+		return m.Check.Attempts
+	}
+	return m.GetVerifyAttempts()
+}
+
+// verifyAccomplished runs the success check when the AI claims the request is accomplished.
+// Returns whether the check passed and, if not, the result to send back to the AI.
+// A declined check command ends the request, Status is cleared.
+func (m *Manager) verifyAccomplished(ctx context.Context) (bool, string) {
+	check := m.Check
+	if check == nil || m.PlanMode {
+		return true, ""
+	}
+
+	m.Println("Verifying the result...")
+	var failures []string
+	if check.Command != "" {
+		if m.ReadOnly {
+			logger.Info("Skipping check command in read-only mode: %s", check.Command)
+		} else if result, err := m.runCheckCommand(ctx, check); errors.Is(err, errCheckDeclined) {
+			m.recordAction(ActionRecord{Kind: "Check", Content: check.Command, Status: ActionDeclined})
+			m.Status = ""
+			return false, ""
+		} else if err != nil {
+			failures = append(failures, fmt.Sprintf("<check_result command=%q error=%q/>", check.Command, err.Error()))
+		} else if result.Code != 0 {
+			output := m.redact(result.Output)
+			if len(output) > maxCheckOutput {
+				output = "..." + output[len(output)-maxCheckOutput:]
+			}
+			failures = append(failures, fmt.Sprintf("<check_result command=%q code=\"%d\">\n%s\n</check_result>", check.Command, result.Code, output))
+		}
+	}
+	if check.PaneRegex != "" && !m.execPaneMatches(check.PaneRegex) {
+		failures = append(failures, fmt.Sprintf("<check_result pane_regex=%q>\nThe exec pane content doesn't match.\n</check_result>", check.PaneRegex))
+	}
+
+	action := ActionRecord{Kind: "Check", Content: check.Command, Status: ActionExecuted}
+	if len(failures) > 0 {
+		action.Error = "check failed"
+	}
+	m.recordAction(action)
+
+	if len(failures) == 0 {
+		m.checkFailures = 0
+		m.Println("Check passed")
+		return true, ""
+	}
+	m.checkFailures++
+	m.Println(fmt.Sprintf("Check failed (%d/%d)", m.checkFailures, m.checkAttempts()))
+	return false, strings.Join(failures, "\n")
+}
+
+// runCheckCommand runs the check command in the prepared exec pane, the exit code can't
+// be read in other panes. The command of a local task, like one of the project's
+// .tmuxai/tasks, is confirmed unless it's whitelisted.
+func (m *Manager) runCheckCommand(ctx context.Context, check *TaskCheck) (CommandExecHistory, error) {
+	timeout := defaultCheckTimeout
+	if check.Timeout > 0 {
+		timeout = time.Duration(check.Timeout) * time.Second
+	}
+
+	m.refreshPane(m.ExecPane)
+	if !m.ExecPane.IsPrepared {
+		return CommandExecHistory{}, fmt.Errorf("the exec pane is not prepared, prepare it with /prepare to run the check command")
+	}
+	if check.Local && !check.approved {
+		if ok, _ := m.confirmedToExec(check.Command, "Run the check command of the task?", false); !ok {
+			return CommandExecHistory{}, errCheckDeclined
+		}
+		check.approved = true
+	}
+
+	result, err := m.execWaitCaptureTimeout(check.Command, timeout)
+	if errors.Is(err, errExecTimeout) {
+		// later commands would queue behind it
+		m.Tmux.SendKeys(m.ExecPane.Id, "C-c", false)
+		return result, fmt.Errorf("timed out after %s and was interrupted", timeout)
+	}
+	return result, err
+}
+
+// execPaneMatches reports whether the exec pane content matches a regular expression
+func (m *Manager) execPaneMatches(pattern string) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		logger.Error("Invalid check pane_regex %q: %v", pattern, err)
+		return false
+	}
+	content, err := m.Tmux.CapturePane(m.ExecPane.Id, m.GetMaxCaptureLines())
+	if err != nil {
+		logger.Error("Failed to capture exec pane for check: %v", err)
+		return false
+	}
+	return re.MatchString(content)
+}
@@ -0,0 +1,272 @@
+package system
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Capture modes for pane content sent to the AI
+const (
+	CaptureModePlain = "plain"
+	CaptureModeAnsi  = "ansi"
+)
+
+var (
+	ansiEscapeRe = regexp.MustCompile(`\x1b\[([0-9;:?]*)([A-Za-z])|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>78DEHM]`)
+	progressRe   = regexp.MustCompile(`[0-9]+(?:\.[0-9]+)?%|[0-9]+/[0-9]+|\[[=#>.\- ]{3,}\]|[\x{2800}-\x{28FF}◐◓◑◒]`)
+)
+
+// AnnotateAnsiCapture turns a `capture-pane -e` capture into compact plain text.
+// SGR colours and bold are replaced by semantic annotations ([err], [warn], [ok], [bold]),
+// box-drawing characters are stripped and repeated progress lines are collapsed.
+func AnnotateAnsiCapture(content string) string {
+	lines := strings.Split(content, "\n")
+	annotated := make([]string, 0, len(lines))
+
+	state := sgrState{}
+	for _, line := range lines {
+		var out string
+		out, state = annotateLine(line, state)
+		stripped := stripBoxDrawing(out)
+		if strings.TrimSpace(stripped) == "" && strings.TrimSpace(out) != "" {
+			// line consisted of borders only
+			continue
+		}
+		annotated = append(annotated, strings.TrimRight(stripped, " "))
+	}
+
+	return strings.TrimSpace(strings.Join(collapseRepeatedLines(annotated), "\n"))
+}
+
+// StripAnsi removes all terminal escape sequences from content
+func StripAnsi(content string) string {
+	return ansiEscapeRe.ReplaceAllString(content, "")
+}
+
+// sgrState tracks the SGR attributes relevant for annotations
+type sgrState struct {
+	fg   string
+	bg   string
+	bold bool
+}
+
+// tags returns the annotations for the current attributes, bold outermost
+func (s sgrState) tags() []string {
+	var tags []string
+	if s.bold {
+		tags = append(tags, "bold")
+	}
+	if s.fg == "err" || s.bg == "err" {
+		tags = append(tags, "err")
+	} else if s.fg != "" {
+		tags = append(tags, s.fg)
+	}
+	return tags
+}
+
+// annotateLine replaces escape sequences in a single line with annotations.
+// Open annotations are closed at the end of the line and reopened on the next one,
+// so every line stays self-contained.
+func annotateLine(line string, state sgrState) (string, sgrState) {
+	var sb strings.Builder
+	var current []string
+	open := func(tags []string) {
+		if slices.Equal(tags, current) {
+			return
+		}
+		for i := len(current) - 1; i >= 0; i-- {
+			sb.WriteString("[/" + current[i] + "]")
+		}
+		for _, tag := range tags {
+			sb.WriteString("[" + tag + "]")
+		}
+		current = tags
+	}
+
+	pending := state.tags()
+	last := 0
+	for _, loc := range ansiEscapeRe.FindAllStringSubmatchIndex(line, -1) {
+		if text := line[last:loc[0]]; text != "" {
+			if strings.TrimSpace(text) != "" {
+				open(pending)
+			}
+			sb.WriteString(text)
+		}
+		last = loc[1]
+
+		// only SGR sequences (ESC [ ... m) carry colour information
+		if loc[2] >= 0 && line[loc[4]:loc[5]] == "m" {
+			state = applySGR(state, line[loc[2]:loc[3]])
+			pending = state.tags()
+		}
+	}
+	if text := line[last:]; text != "" {
+		if strings.TrimSpace(text) != "" {
+			open(pending)
+		}
+		sb.WriteString(text)
+	}
+	open(nil)
+
+	return sb.String(), state
+}
+
+// applySGR updates the state with the parameters of an SGR sequence
+func applySGR(state sgrState, params string) sgrState {
+	if params == "" {
+		return sgrState{}
+	}
+	codes := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case code == 0:
+			state = sgrState{}
+		case code == 1:
+			state.bold = true
+		case code == 22:
+			state.bold = false
+		case code >= 30 && code <= 37:
+			state.fg = basicColorClass(code - 30)
+		case code >= 90 && code <= 97:
+			state.fg = basicColorClass(code - 90)
+		case code == 39:
+			state.fg = ""
+		case code == 41 || code == 101:
+			state.bg = "err"
+		case code >= 40 && code <= 47, code >= 100 && code <= 107, code == 49:
+			state.bg = ""
+		case code == 38 || code == 48:
+			class, consumed := extendedColorClass(codes[i+1:])
+			i += consumed
+			if code == 38 {
+				state.fg = class
+			} else if class == "err" {
+				state.bg = class
+			} else {
+				state.bg = ""
+			}
+		}
+	}
+	return state
+}
+
+// basicColorClass maps one of the 8 basic colours to an annotation
+func basicColorClass(c int) string {
+	switch c {
+	case 1:
+		return "err"
+	case 2:
+		return "ok"
+	case 3:
+		return "warn"
+	}
+	return ""
+}
+
+// extendedColorClass parses 256-colour and true colour arguments of SGR 38/48.
+// It returns the annotation and the number of parameters consumed.
+func extendedColorClass(args []string) (string, int) {
+	if len(args) == 0 {
+		return "", 0
+	}
+	switch args[0] {
+	case "5":
+		if len(args) < 2 {
+			return "", len(args)
+		}
+		n, _ := strconv.Atoi(args[1])
+		switch {
+		case n < 8:
+			return basicColorClass(n), 2
+		case n < 16:
+			return basicColorClass(n - 8), 2
+		case n < 232:
+			n -= 16
+			return rgbColorClass(n/36*51, (n/6)%6*51, n%6*51), 2
+		}
+		return "", 2
+	case "2":
+		if len(args) < 4 {
+			return "", len(args)
+		}
+		r, _ := strconv.Atoi(args[1])
+		g, _ := strconv.Atoi(args[2])
+		b, _ := strconv.Atoi(args[3])
+		return rgbColorClass(r, g, b), 4
+	}
+	return "", 0
+}
+
+// rgbColorClass classifies an RGB colour as red, yellow or green
+func rgbColorClass(r, g, b int) string {
+	switch {
+	case r >= 150 && g < 100 && b < 100:
+		return "err"
+	case r >= 150 && g >= 150 && b < 100:
+		return "warn"
+	case g >= 150 && r < 100 && b < 150:
+		return "ok"
+	}
+	return ""
+}
+
+// stripBoxDrawing removes box-drawing and block characters used by TUIs for borders and bars
+func stripBoxDrawing(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 0x2500 && r <= 0x259F {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// collapseRepeatedLines collapses runs of identical lines, and of progress lines that only
+// differ in their progress, into the last line of the run.
+func collapseRepeatedLines(lines []string) []string {
+	var result []string
+	for i := 0; i < len(lines); {
+		shape, progress := progressShape(lines[i])
+		j := i + 1
+		for strings.TrimSpace(lines[i]) != "" && j < len(lines) {
+			if lines[j] != lines[i] {
+				next, ok := progressShape(lines[j])
+				if !progress || !ok || next != shape {
+					break
+				}
+			}
+			j++
+		}
+		if j-i > 1 {
+			result = append(result, fmt.Sprintf("%s [repeated %d times]", lines[j-1], j-i))
+		} else {
+			result = append(result, lines[i])
+		}
+		i = j
+	}
+	return result
+}
+
+// progressShape returns a line with its progress indicators (percentages, counters like 3/10,
+// bars and spinners) replaced by #, and whether it has any
+func progressShape(line string) (string, bool) {
+	fields := strings.Fields(line)
+	found := false
+	for i, field := range fields {
+		if len(field) == 1 && strings.Contains(`|/-\`, field) {
+			fields[i] = "#"
+			found = true
+		}
+	}
+	shape := progressRe.ReplaceAllStringFunc(strings.Join(fields, " "), func(string) string {
+		found = true
+		return "#"
+	})
+	return shape, found
+}
@@ -0,0 +1,86 @@
+package system
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotateAnsiCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "plain text is untouched",
+			input:    "hello world",
+			expected: "hello world",
+		},
+		{
+			name:     "red span",
+			input:    "build \x1b[31mFAILED\x1b[0m in 3s",
+			expected: "build [err]FAILED[/err] in 3s",
+		},
+		{
+			name:     "bold bright red and green",
+			input:    "\x1b[1;91merror:\x1b[0m ok \x1b[32mPASS\x1b[39m",
+			expected: "[bold][err]error:[/err][/bold] ok [ok]PASS[/ok]",
+		},
+		{
+			name:     "bold without colour",
+			input:    "\x1b[1mSummary\x1b[22m: 3 \x1b[1;32mpassed\x1b[22m tests\x1b[0m",
+			expected: "[bold]Summary[/bold]: 3 [bold][ok]passed[/ok][/bold][ok] tests[/ok]",
+		},
+		{
+			name:     "256 colour yellow",
+			input:    "\x1b[38;5;11mwarning\x1b[m: unused variable",
+			expected: "[warn]warning[/warn]: unused variable",
+		},
+		{
+			name:     "true colour red spans lines",
+			input:    "\x1b[38;2;255;0;0mpanic: boom\ngoroutine 1\x1b[0m\ndone",
+			expected: "[err]panic: boom[/err]\n[err]goroutine 1[/err]\ndone",
+		},
+		{
+			name:     "box drawing is stripped",
+			input:    "┌────────┐\n│ htop   │\n└────────┘",
+			expected: " htop",
+		},
+		{
+			name:     "progress lines are collapsed",
+			input:    "Downloading 10%\nDownloading 55%\nDownloading 100%\nDone",
+			expected: "Downloading 100% [repeated 3 times]\nDone",
+		},
+		{
+			name:     "spinner and counter lines are collapsed",
+			input:    "⠋ [1/3] Installing\n⠙ [2/3] Installing\n| [=====     ] 50%\n/ [==========] 100%",
+			expected: "⠙ [2/3] Installing [repeated 2 times]\n/ [==========] 100% [repeated 2 times]",
+		},
+		{
+			name:     "identical lines are collapsed",
+			input:    "retrying\nretrying\nretrying",
+			expected: "retrying [repeated 3 times]",
+		},
+		{
+			name:     "lines differing in text are kept",
+			input:    "ok  pkg/a 0.1s\nok  pkg/b 0.2s\ntest 1 passed\ntest 2 passed\nsrc/a-b\nsrc/a|b",
+			expected: "ok  pkg/a 0.1s\nok  pkg/b 0.2s\ntest 1 passed\ntest 2 passed\nsrc/a-b\nsrc/a|b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnnotateAnsiCapture(tt.input)
+			if got != strings.TrimSpace(tt.expected) {
+				t.Errorf("got %q, want %q", got, strings.TrimSpace(tt.expected))
+			}
+		})
+	}
+}
+
+func TestStripAnsi(t *testing.T) {
+	got := StripAnsi("\x1b[1;32muser@host\x1b[0m:~[12:00][0]» ")
+	if got != "user@host:~[12:00][0]» " {
+		t.Errorf("unexpected result %q", got)
+	}
+}
@@ -0,0 +1,344 @@
+package system
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+	// maxDiffEdits bounds the work of the diff algorithm, larger changes are shown as a full replacement
+	maxDiffEdits = 2000
+)
+
+type diffOpKind int
+
+const (
+	diffEqual diffOpKind = iota
+	diffDelete
+	diffInsert
+)
+
+type diffOp struct {
+	kind diffOpKind
+	line string
+}
+
+// UnifiedDiff returns a unified diff between two texts, or an empty string if they are equal
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+
+	// find hunks: ranges of ops around changes, with context
+	for i := 0; i < len(ops); {
+		if ops[i].kind == diffEqual {
+			i++
+			continue
+		}
+		start := max(i-diffContextLines, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != diffEqual {
+				end++
+				continue
+			}
+			// count equal run
+			run := end
+			for run < len(ops) && ops[run].kind == diffEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContextLines {
+				end = min(end+diffContextLines, len(ops))
+				break
+			}
+			end = run
+		}
+		writeHunk(&sb, ops, start, end)
+		i = end
+	}
+
+	return sb.String()
+}
+
+// writeHunk writes the ops in [start, end) as a unified diff hunk
+func writeHunk(sb *strings.Builder, ops []diffOp, start, end int) {
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != diffInsert {
+			oldLine++
+		}
+		if op.kind != diffDelete {
+			newLine++
+		}
+	}
+
+	var body strings.Builder
+	oldCount, newCount := 0, 0
+	for _, op := range ops[start:end] {
+		switch op.kind {
+		case diffEqual:
+			body.WriteString(" " + op.line + "\n")
+			oldCount++
+			newCount++
+		case diffDelete:
+			body.WriteString("-" + op.line + "\n")
+			oldCount++
+		case diffInsert:
+			body.WriteString("+" + op.line + "\n")
+			newCount++
+		}
+	}
+
+	// an empty range starts at the line before it
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+	sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount))
+	sb.WriteString(body.String())
+}
+
+// diffLines computes a line based edit script using the Myers algorithm
+func diffLines(a, b []string) []diffOp {
+	// common prefix and suffix don't need the algorithm
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	return ops
+}
+
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+
+	// trace[d] holds the furthest x for diagonals -d..d before step d
+	var trace [][]int
+	v := map[int]int{1: 0}
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		snapshot := make([]int, 2*d+3)
+		for k := -d - 1; k <= d+1; k++ {
+			snapshot[k+d+1] = v[k]
+		}
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1] < v[k+1]) {
+				x = v[k+1]
+			} else {
+				x = v[k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		// too many changes, show as a full replacement
+		var ops []diffOp
+		for _, line := range a {
+			ops = append(ops, diffOp{diffDelete, line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{diffInsert, line})
+		}
+		return ops
+	}
+
+	// backtrack through the trace to build the edit script
+	var reversed []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffOp{diffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, diffOp{diffInsert, b[y-1]})
+			y--
+		} else {
+			reversed = append(reversed, diffOp{diffDelete, a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, diffOp{diffEqual, a[x-1]})
+		x--
+		y--
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+// splitLines splits text into lines without the trailing empty line of a final newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@\s*(?:-(\d+)(?:,\d+)?\s+\+\d+(?:,\d+)?\s*)?@@`)
+
+type patchHunk struct {
+	oldStart int
+	oldLines []string
+	newLines []string
+}
+
+// ApplyUnifiedPatch applies the hunks of a unified diff to the original text.
+// Hunks are located by their content, so slightly wrong line numbers are tolerated.
+func ApplyUnifiedPatch(original, patch string) (string, error) {
+	hunks, err := parseHunks(patch)
+	if err != nil {
+		return "", err
+	}
+
+	lines := splitLines(original)
+	offset := 0
+	for i, h := range hunks {
+		expected := max(h.oldStart-1+offset, 0)
+		pos := findBlock(lines, h.oldLines, expected, func(a, b string) bool { return a == b })
+		if pos < 0 {
+			pos = findBlock(lines, h.oldLines, expected, func(a, b string) bool {
+				return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+			})
+		}
+		if pos < 0 {
+			return "", fmt.Errorf("hunk %d does not match the file content", i+1)
+		}
+
+		updated := make([]string, 0, len(lines)-len(h.oldLines)+len(h.newLines))
+		updated = append(updated, lines[:pos]...)
+		updated = append(updated, h.newLines...)
+		updated = append(updated, lines[pos+len(h.oldLines):]...)
+		lines = updated
+		offset += len(h.newLines) - len(h.oldLines)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// parseHunks parses the hunks of a unified diff, ignoring file headers
+func parseHunks(patch string) ([]patchHunk, error) {
+	var hunks []patchHunk
+	var current *patchHunk
+	for _, line := range strings.Split(strings.TrimRight(patch, "\n"), "\n") {
+		if match := hunkHeaderRe.FindStringSubmatch(line); match != nil {
+			if current != nil {
+				hunks = append(hunks, *current)
+			}
+			start, _ := strconv.Atoi(match[1])
+			current = &patchHunk{oldStart: start}
+			continue
+		}
+		if current == nil {
+			// headers (---, +++, diff, index) before the first hunk
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+		case strings.HasPrefix(line, "+"):
+			current.newLines = append(current.newLines, line[1:])
+		case strings.HasPrefix(line, "-"):
+			current.oldLines = append(current.oldLines, line[1:])
+		case strings.HasPrefix(line, " "):
+			current.oldLines = append(current.oldLines, line[1:])
+			current.newLines = append(current.newLines, line[1:])
+		case line == "":
+			// some tools drop the space of empty context lines
+			current.oldLines = append(current.oldLines, "")
+			current.newLines = append(current.newLines, "")
+		default:
+			return nil, fmt.Errorf("invalid patch line: %q", line)
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks")
+	}
+	return hunks, nil
+}
+
+// findBlock finds block in lines, preferring the match closest to the expected position
+func findBlock(lines, block []string, expected int, equal func(a, b string) bool) int {
+	if len(block) == 0 {
+		return min(expected, len(lines))
+	}
+	best := -1
+	for pos := 0; pos+len(block) <= len(lines); pos++ {
+		matched := true
+		for j := range block {
+			if !equal(lines[pos+j], block[j]) {
+				matched = false
+				break
+			}
+		}
+		if matched && (best < 0 || abs(pos-expected) < abs(best-expected)) {
+			best = pos
+		}
+	}
+	return best
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,77 @@
+package system
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	oldText := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	newText := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	want := `--- a/file
++++ b/file
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+	got := UnifiedDiff("a/file", "b/file", oldText, newText)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if UnifiedDiff("a", "b", oldText, oldText) != "" {
+		t.Errorf("expected empty diff for equal texts")
+	}
+}
+
+func TestApplyUnifiedPatch_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+	}{
+		{"replace line", "one\ntwo\nthree\n", "one\n2\nthree\n"},
+		{"new file", "", "package main\n\nfunc main() {}\n"},
+		{"delete all", "x\ny\n", ""},
+		{"insert in middle", strings.Repeat("line\n", 10) + "end\n", strings.Repeat("line\n", 5) + "new\n" + strings.Repeat("line\n", 5) + "end\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := UnifiedDiff("a", "b", tt.oldText, tt.newText)
+			got, err := ApplyUnifiedPatch(tt.oldText, patch)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\npatch:\n%s", err, patch)
+			}
+			if got != tt.newText {
+				t.Errorf("got %q, want %q\npatch:\n%s", got, tt.newText, patch)
+			}
+		})
+	}
+}
+
+func TestApplyUnifiedPatch_WrongLineNumbers(t *testing.T) {
+	original := "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n"
+	patch := "@@ -1,3 +1,3 @@\n func b() {\n-\treturn 2\n+\treturn 3\n }\n"
+	got, err := ApplyUnifiedPatch(original, patch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 3\n}\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := ApplyUnifiedPatch(original, "@@ -1 +1 @@\n-missing\n+line\n"); err == nil {
+		t.Errorf("expected error for non matching hunk")
+	}
+}
@@ -0,0 +1,54 @@
+package system
+
+import (
+	"regexp"
+)
+
+// RedactedText replaces secrets in content sent to the AI
+const RedactedText = "[REDACTED]"
+
+// builtinSecretPatterns match common secrets, capture groups around the secret are kept
+var builtinSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`),
+	// the name must end in the keyword and the value look like a secret, not max_tokens: 4096 or ${API_KEY}
+	regexp.MustCompile(`(?i)(\b\w*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|secret[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',;$<{][^\s"',;]{7,}`),
+	regexp.MustCompile(`(?i)(\bauthorization:\s*(?:bearer|basic)\s+)\S+`),
+	regexp.MustCompile(`(?i)(\bbearer\s+)[a-z0-9._~+/=-]{16,}`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{30,}`),
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`(://[^:/\s]+:)[^@/\s]+(@)`),
+}
+
+// Redact hides common secrets and matches of the extra patterns in text.
+// Invalid extra patterns are returned so they can be reported.
+func Redact(text string, extraPatterns []string) (string, []string) {
+	for _, re := range builtinSecretPatterns {
+		text = redactMatches(re, text)
+	}
+
+	var invalid []string
+	for _, pattern := range extraPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			invalid = append(invalid, pattern)
+			continue
+		}
+		text = redactMatches(re, text)
+	}
+	return text, invalid
+}
+
+// redactMatches replaces matches of re with RedactedText. Up to two groups
+// before and after the secret (e.g. "password=") are kept.
+func redactMatches(re *regexp.Regexp, text string) string {
+	switch re.NumSubexp() {
+	case 0:
+		return re.ReplaceAllLiteralString(text, RedactedText)
+	case 1:
+		return re.ReplaceAllString(text, "${1}"+RedactedText)
+	default:
+		return re.ReplaceAllString(text, "${1}"+RedactedText+"${2}")
+	}
+}
@@ -28,9 +28,12 @@ func TmuxCreateNewPane(target string) (string, error) {
 	return paneId, nil
 }
 
+// paneDetailsFormat is the list-panes format parsed by parsePaneDetails
+const paneDetailsFormat = "#{pane_id},#{pane_active},#{pane_pid},#{pane_current_command},#{history_size},#{history_limit}"
+
 // TmuxPanesDetails gets details for all panes in a target window
 func TmuxPanesDetails(target string) ([]TmuxPaneDetails, error) {
-	cmd := exec.Command("tmux", "list-panes", "-t", target, "-F", "#{pane_id},#{pane_active},#{pane_pid},#{pane_current_command},#{history_size},#{history_limit}")
+	cmd := exec.Command("tmux", "list-panes", "-t", target, "-F", paneDetailsFormat)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -41,7 +44,13 @@ func TmuxPanesDetails(target string) ([]TmuxPaneDetails, error) {
 		return nil, err
 	}
 
-	output := strings.TrimSpace(stdout.String())
+	return parsePaneDetails(target, stdout.String(), GetProcessArgs)
+}
+
+// parsePaneDetails parses the list-panes output of paneDetailsFormat,
+// processArgs returns the command line of the process running in a pane
+func parsePaneDetails(target string, output string, processArgs func(pid int) string) ([]TmuxPaneDetails, error) {
+	output = strings.TrimSpace(output)
 	if output == "" {
 		return nil, fmt.Errorf("no pane details found for target %s", target)
 	}
@@ -56,7 +65,7 @@ func TmuxPanesDetails(target string) ([]TmuxPaneDetails, error) {
 		}
 
 		parts := strings.SplitN(line, ",", 6)
-		if len(parts) < 5 {
+		if len(parts) < 6 {
 			logger.Error("Invalid pane details format for line: %s", line)
 			continue
 		}
@@ -72,7 +81,7 @@ func TmuxPanesDetails(target string) ([]TmuxPaneDetails, error) {
 		pid, _ := strconv.Atoi(parts[2])
 		historySize, _ := strconv.Atoi(parts[4])
 		historyLimit, _ := strconv.Atoi(parts[5])
-		currentCommandArgs := GetProcessArgs(pid)
+		currentCommandArgs := processArgs(pid)
 		isSubShell := IsSubShell(parts[3])
 
 		paneDetail := TmuxPaneDetails{
@@ -109,6 +118,23 @@ func TmuxCapturePane(paneId string, maxLines int) (string, error) {
 	return content, nil
 }
 
+// TmuxCapturePaneAnsi gets the content of a specific pane including SGR escape sequences
+func TmuxCapturePaneAnsi(paneId string, maxLines int) (string, error) {
+	cmd := exec.Command("tmux", "capture-pane", "-p", "-e", "-t", paneId, "-S", fmt.Sprintf("-%d", maxLines))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		logger.Error("Failed to capture pane content with escapes from %s: %v, stderr: %s", paneId, err, stderr.String())
+		return "", err
+	}
+
+	content := strings.TrimSpace(stdout.String())
+	return content, nil
+}
+
 // Return current tmux window target with session id and window id
 func TmuxCurrentWindowTarget() (string, error) {
 	paneId, err := TmuxCurrentPaneId()
@@ -116,6 +142,11 @@ func TmuxCurrentWindowTarget() (string, error) {
 		return "", err
 	}
 
+	return TmuxWindowTarget(paneId)
+}
+
+// TmuxWindowTarget returns the window target (session id and window index) of a pane
+func TmuxWindowTarget(paneId string) (string, error) {
 	cmd := exec.Command("tmux", "list-panes", "-t", paneId, "-F", "#{session_id}:#{window_index}")
 	output, err := cmd.Output()
 	if err != nil {
@@ -157,6 +188,42 @@ func TmuxCreateSession() (string, error) {
 	return strings.TrimSpace(stdout.String()), nil
 }
 
+// TmuxNewSession creates a detached session with a shell in dir and returns its pane id
+func TmuxNewSession(name string, dir string) (string, error) {
+	cmd := exec.Command("tmux", "new-session", "-d", "-s", name, "-c", dir, "-P", "-F", "#{pane_id}")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.Error("Failed to create tmux session %s: %v, stderr: %s", name, err, stderr.String())
+		return "", fmt.Errorf("failed to create tmux session: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// TmuxKillSession kills a session and its panes
+func TmuxKillSession(name string) error {
+	cmd := exec.Command("tmux", "kill-session", "-t", name)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.Error("Failed to kill tmux session %s: %v, stderr: %s", name, err, stderr.String())
+		return err
+	}
+	return nil
+}
+
+// TmuxSessionName returns the name of the session of a pane
+func TmuxSessionName(paneId string) (string, error) {
+	cmd := exec.Command("tmux", "display-message", "-p", "-t", paneId, "#{session_name}")
+	output, err := cmd.Output()
+	if err != nil {
+		logger.Error("Failed to get the session of pane %s: %v", paneId, err)
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // AttachToTmuxSession attaches to an existing tmux session
 func TmuxAttachSession(paneId string) error {
 	cmd := exec.Command("tmux", "attach-session", "-t", paneId)
@@ -202,3 +269,50 @@ func TmuxClearPane(paneId string) error {
 	logger.Debug("Successfully cleared pane %s", paneId)
 	return nil
 }
+
+// TmuxCapturePaneHistory gets the full scrollback history of a pane, joining wrapped lines
+func TmuxCapturePaneHistory(paneId string) (string, error) {
+	cmd := exec.Command("tmux", "capture-pane", "-p", "-J", "-t", paneId, "-S", "-", "-E", "-")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		logger.Error("Failed to capture pane history from %s: %v, stderr: %s", paneId, err, stderr.String())
+		return "", err
+	}
+
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// TmuxPaneCurrentPath returns the current working directory of a pane
+func TmuxPaneCurrentPath(paneId string) (string, error) {
+	cmd := exec.Command("tmux", "display-message", "-p", "-t", paneId, "#{pane_current_path}")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current path of pane %s: %w", paneId, err)
+	}
+
+	path := strings.TrimSpace(string(output))
+	if path == "" {
+		return "", fmt.Errorf("empty current path returned for pane %s", paneId)
+	}
+	return path, nil
+}
+
+// TmuxWindowKey returns a string identifying the window of a pane across tmux servers,
+// made of the server pid and the window id, usable in file names
+func TmuxWindowKey(paneId string) (string, error) {
+	cmd := exec.Command("tmux", "display-message", "-p", "-t", paneId, "#{pid}-#{window_id}")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get window of pane %s: %w", paneId, err)
+	}
+
+	key := strings.ReplaceAll(strings.TrimSpace(string(output)), "@", "")
+	if key == "" {
+		return "", fmt.Errorf("empty window returned for pane %s", paneId)
+	}
+	return key, nil
+}
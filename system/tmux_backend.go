@@ -0,0 +1,73 @@
+package system
+
+// TmuxBackend is the tmux server the manager works with. ExecBackend runs the tmux binary,
+// FakeTmux simulates panes in memory for tests.
+type TmuxBackend interface {
+	// CurrentPaneId returns the pane tmuxai runs in
+	CurrentPaneId() (string, error)
+	// WindowTarget returns the window target (session id and window index) of a pane
+	WindowTarget(paneId string) (string, error)
+	// ListPanes returns the panes of a window target, or the pane of a pane id
+	ListPanes(target string) ([]TmuxPaneDetails, error)
+	CapturePane(paneId string, maxLines int) (string, error)
+	CapturePaneAnsi(paneId string, maxLines int) (string, error)
+	CapturePaneHistory(paneId string) (string, error)
+	PaneCurrentPath(paneId string) (string, error)
+	// SessionName returns the name of the session of a pane
+	SessionName(paneId string) (string, error)
+	// SendKeys sends keys to a pane, with enter set each line is followed by Enter
+	SendKeys(paneId string, keys string, enter bool) error
+	// SplitPane creates a new pane next to the target and returns its id
+	SplitPane(target string) (string, error)
+	// ClearPane clears the screen and the history of a pane
+	ClearPane(paneId string) error
+}
+
+// ExecBackend is the TmuxBackend of the tmux binary
+type ExecBackend struct{}
+
+var _ TmuxBackend = ExecBackend{}
+
+func (ExecBackend) CurrentPaneId() (string, error) {
+	return TmuxCurrentPaneId()
+}
+
+func (ExecBackend) WindowTarget(paneId string) (string, error) {
+	return TmuxWindowTarget(paneId)
+}
+
+func (ExecBackend) ListPanes(target string) ([]TmuxPaneDetails, error) {
+	return TmuxPanesDetails(target)
+}
+
+func (ExecBackend) CapturePane(paneId string, maxLines int) (string, error) {
+	return TmuxCapturePane(paneId, maxLines)
+}
+
+func (ExecBackend) CapturePaneAnsi(paneId string, maxLines int) (string, error) {
+	return TmuxCapturePaneAnsi(paneId, maxLines)
+}
+
+func (ExecBackend) CapturePaneHistory(paneId string) (string, error) {
+	return TmuxCapturePaneHistory(paneId)
+}
+
+func (ExecBackend) PaneCurrentPath(paneId string) (string, error) {
+	return TmuxPaneCurrentPath(paneId)
+}
+
+func (ExecBackend) SessionName(paneId string) (string, error) {
+	return TmuxSessionName(paneId)
+}
+
+func (ExecBackend) SendKeys(paneId string, keys string, enter bool) error {
+	return TmuxSendCommandToPane(paneId, keys, enter)
+}
+
+func (ExecBackend) SplitPane(target string) (string, error) {
+	return TmuxCreateNewPane(target)
+}
+
+func (ExecBackend) ClearPane(paneId string) error {
+	return TmuxClearPane(paneId)
+}
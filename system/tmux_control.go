@@ -0,0 +1,576 @@
+package system
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sigrunnr/tmuxai/logger"
+)
+
+// controlCommandTimeout is how long a command of the control mode connection may take
+const controlCommandTimeout = 10 * time.Second
+
+var errControlClosed = errors.New("tmux control mode connection closed")
+
+// OutputWaiter is implemented by backends that are notified about the output of panes
+type OutputWaiter interface {
+	// WaitForOutput waits until the pane printed something since it was last captured,
+	// or the timeout passed. It returns false on timeout.
+	WaitForOutput(paneId string, timeout time.Duration) bool
+}
+
+// ControlBackend is a TmuxBackend keeping one tmux control mode (tmux -C) connection open.
+// Commands are sent over the connection instead of starting a tmux process each, and the
+// %output notifications tell which panes changed, so captures of unchanged panes are reused.
+// When the connection is lost, the commands run the tmux binary again.
+type ControlBackend struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	mu        sync.Mutex // guards writes to stdin and the queue of commands waiting for a reply
+	pending   []chan controlReply
+	closed    bool
+	closeOnce sync.Once
+
+	stateMu  sync.Mutex
+	session  string          // id of the attached session, its panes send %output
+	watched  map[string]bool // panes of the attached session, nil when unknown
+	panes    map[string]*controlPane
+	procArgs map[string]controlProcArgs // command lines of pane processes by pane id
+}
+
+// controlPane is the change state of a pane of the attached session
+type controlPane struct {
+	output   int               // count of %output notifications
+	captures map[string]string // captures of the pane made after the last output, by kind
+	changed  chan struct{}     // closed on the next output
+}
+
+type controlProcArgs struct {
+	pid  int
+	args string
+}
+
+type controlReply struct {
+	lines []string
+	err   error
+}
+
+var _ TmuxBackend = (*ControlBackend)(nil)
+var _ OutputWaiter = (*ControlBackend)(nil)
+
+// NewControlBackend attaches a control mode client to the session of a pane
+func NewControlBackend(paneId string) (*ControlBackend, error) {
+	cmd := exec.Command("tmux", "-C", "attach-session", "-t", paneId)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start tmux control mode: %w", err)
+	}
+
+	c := &ControlBackend{
+		cmd:      cmd,
+		stdin:    stdin,
+		panes:    make(map[string]*controlPane),
+		procArgs: make(map[string]controlProcArgs),
+	}
+	go c.readLoop(stdout)
+
+	// the reply of the first command tells the connection works
+	lines, err := c.command("display-message", "-p", "-t", paneId, "#{session_id}")
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("tmux control mode: %w", err)
+	}
+	c.stateMu.Lock()
+	if c.session == "" && len(lines) > 0 {
+		c.session = strings.TrimSpace(lines[0])
+	}
+	c.stateMu.Unlock()
+	logger.Info("Connected to tmux in control mode for pane %s", paneId)
+	return c, nil
+}
+
+// Close detaches the control mode client
+func (c *ControlBackend) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		// the client detaches at the end of its input
+		c.stdin.Close()
+		err = c.cmd.Wait()
+	})
+	return err
+}
+
+// readLoop reads the replies and notifications of the connection until it is closed
+func (c *ControlBackend) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var parser controlParser
+	for scanner.Scan() {
+		event, ok := parser.parse(scanner.Text())
+		if !ok {
+			continue
+		}
+		switch event.name {
+		case "":
+			if event.ours {
+				c.reply(event)
+			}
+		case "output":
+			paneId, _, _ := strings.Cut(event.args, " ")
+			c.paneOutput(paneId)
+		case "session-changed":
+			session, _, _ := strings.Cut(event.args, " ")
+			c.stateMu.Lock()
+			c.session = session
+			c.stateMu.Unlock()
+			c.forgetCaptures()
+		case "exit":
+			logger.Info("tmux control mode exited: %s", event.args)
+		default:
+			// windows and panes changed, e.g. resized or moved to another session
+			c.forgetCaptures()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("Failed to read from tmux control mode: %v", err)
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	for _, ch := range pending {
+		ch <- controlReply{err: errControlClosed}
+	}
+	c.forgetCaptures()
+}
+
+// reply passes the output of a command to the caller waiting for it
+func (c *ControlBackend) reply(event controlEvent) {
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		logger.Error("Unexpected reply of tmux control mode: %v", event.lines)
+		return
+	}
+	ch := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+
+	reply := controlReply{lines: event.lines}
+	if event.err {
+		reply.err = fmt.Errorf("%s", strings.Join(event.lines, " "))
+	}
+	ch <- reply
+}
+
+// command runs a tmux command over the connection and returns its output lines
+func (c *ControlBackend) command(args ...string) ([]string, error) {
+	ch := make(chan controlReply, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errControlClosed
+	}
+	c.pending = append(c.pending, ch)
+	_, err := io.WriteString(c.stdin, controlCommandLine(args)+"\n")
+	c.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errControlClosed, err)
+	}
+
+	select {
+	case reply := <-ch:
+		return reply.lines, reply.err
+	case <-time.After(controlCommandTimeout):
+		return nil, fmt.Errorf("tmux %s timed out", args[0])
+	}
+}
+
+func (c *ControlBackend) CurrentPaneId() (string, error) {
+	return TmuxCurrentPaneId()
+}
+
+func (c *ControlBackend) WindowTarget(paneId string) (string, error) {
+	lines, err := c.command("display-message", "-p", "-t", paneId, "#{session_id}:#{window_index}")
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.WindowTarget(paneId)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get window target: %w", err)
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return "", fmt.Errorf("empty window target returned")
+	}
+	return strings.TrimSpace(lines[0]), nil
+}
+
+func (c *ControlBackend) ListPanes(target string) ([]TmuxPaneDetails, error) {
+	lines, err := c.command("list-panes", "-t", target, "-F", paneDetailsFormat)
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.ListPanes(target)
+	}
+	if err != nil {
+		logger.Error("Failed to get tmux pane details for target %s: %v", target, err)
+		return nil, err
+	}
+
+	details, err := parsePaneDetails(target, strings.Join(lines, "\n"), func(pid int) string { return "" })
+	for i := range details {
+		details[i].CurrentCommandArgs = c.processArgs(details[i].Id, details[i].CurrentPid)
+	}
+	return details, err
+}
+
+// processArgs returns the command line of the process running in a pane.
+// It is looked up again after the pane printed something.
+func (c *ControlBackend) processArgs(paneId string, pid int) string {
+	c.stateMu.Lock()
+	cached, ok := c.procArgs[paneId]
+	c.stateMu.Unlock()
+	if ok && cached.pid == pid {
+		return cached.args
+	}
+
+	args := GetProcessArgs(pid)
+	c.stateMu.Lock()
+	if c.isWatched(paneId) {
+		c.procArgs[paneId] = controlProcArgs{pid: pid, args: args}
+	}
+	c.stateMu.Unlock()
+	return args
+}
+
+func (c *ControlBackend) CapturePane(paneId string, maxLines int) (string, error) {
+	content, err := c.capture(paneId, fmt.Sprintf("plain %d", maxLines), "capture-pane", "-p", "-t", paneId, "-S", fmt.Sprintf("-%d", maxLines))
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.CapturePane(paneId, maxLines)
+	}
+	if err != nil {
+		logger.Error("Failed to capture pane content from %s: %v", paneId, err)
+		return "", err
+	}
+	return strings.TrimSpace(content), nil
+}
+
+func (c *ControlBackend) CapturePaneAnsi(paneId string, maxLines int) (string, error) {
+	content, err := c.capture(paneId, fmt.Sprintf("ansi %d", maxLines), "capture-pane", "-p", "-e", "-t", paneId, "-S", fmt.Sprintf("-%d", maxLines))
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.CapturePaneAnsi(paneId, maxLines)
+	}
+	if err != nil {
+		logger.Error("Failed to capture pane content with escapes from %s: %v", paneId, err)
+		return "", err
+	}
+	return strings.TrimSpace(content), nil
+}
+
+func (c *ControlBackend) CapturePaneHistory(paneId string) (string, error) {
+	content, err := c.capture(paneId, "history", "capture-pane", "-p", "-J", "-t", paneId, "-S", "-", "-E", "-")
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.CapturePaneHistory(paneId)
+	}
+	if err != nil {
+		logger.Error("Failed to capture pane history from %s: %v", paneId, err)
+		return "", err
+	}
+	return strings.TrimRight(content, "\n"), nil
+}
+
+// capture runs a capture command, or returns the content of the same capture when the pane
+// didn't print anything since. Only panes of the attached session send %output.
+func (c *ControlBackend) capture(paneId string, kind string, args ...string) (string, error) {
+	c.stateMu.Lock()
+	if c.watched == nil {
+		c.stateMu.Unlock()
+		c.loadWatched()
+		c.stateMu.Lock()
+	}
+	p := c.pane(paneId)
+	if content, ok := p.captures[kind]; ok && c.isWatched(paneId) {
+		c.stateMu.Unlock()
+		return content, nil
+	}
+	output := p.output
+	c.stateMu.Unlock()
+
+	lines, err := c.command(args...)
+	if err != nil {
+		return "", err
+	}
+	content := strings.Join(lines, "\n")
+
+	c.stateMu.Lock()
+	// output that arrived meanwhile may be missing in the capture
+	if p.output == output && c.isWatched(paneId) {
+		p.captures[kind] = content
+	}
+	c.stateMu.Unlock()
+	return content, nil
+}
+
+// loadWatched lists the panes of the attached session
+func (c *ControlBackend) loadWatched() {
+	c.stateMu.Lock()
+	session := c.session
+	c.stateMu.Unlock()
+	if session == "" {
+		return
+	}
+	lines, err := c.command("list-panes", "-s", "-t", session, "-F", "#{pane_id}")
+	if err != nil {
+		return
+	}
+	watched := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		watched[strings.TrimSpace(line)] = true
+	}
+	c.stateMu.Lock()
+	if c.session == session {
+		c.watched = watched
+	}
+	c.stateMu.Unlock()
+}
+
+// isWatched reports whether the pane sends %output, stateMu must be held
+func (c *ControlBackend) isWatched(paneId string) bool {
+	return c.watched[paneId]
+}
+
+// pane returns the change state of a pane, stateMu must be held
+func (c *ControlBackend) pane(paneId string) *controlPane {
+	p, ok := c.panes[paneId]
+	if !ok {
+		p = &controlPane{captures: make(map[string]string), changed: make(chan struct{})}
+		c.panes[paneId] = p
+	}
+	return p
+}
+
+// paneOutput marks a pane as changed and wakes up the waiters for its output
+func (c *ControlBackend) paneOutput(paneId string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	p := c.pane(paneId)
+	p.output++
+	if len(p.captures) > 0 {
+		p.captures = make(map[string]string)
+	}
+	delete(c.procArgs, paneId)
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// forgetCaptures drops the captures of all panes and the list of watched panes
+func (c *ControlBackend) forgetCaptures() {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.watched = nil
+	c.procArgs = make(map[string]controlProcArgs)
+	for _, p := range c.panes {
+		p.captures = make(map[string]string)
+		close(p.changed)
+		p.changed = make(chan struct{})
+	}
+}
+
+func (c *ControlBackend) WaitForOutput(paneId string, timeout time.Duration) bool {
+	c.stateMu.Lock()
+	watched := c.isWatched(paneId)
+	p := c.pane(paneId)
+	captured := len(p.captures) > 0
+	changed := p.changed
+	c.stateMu.Unlock()
+
+	if !watched {
+		// there are no notifications for the pane
+		time.Sleep(timeout)
+		return false
+	}
+	if !captured {
+		// it printed something since the last capture
+		return true
+	}
+
+	select {
+	case <-changed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (c *ControlBackend) PaneCurrentPath(paneId string) (string, error) {
+	lines, err := c.command("display-message", "-p", "-t", paneId, "#{pane_current_path}")
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.PaneCurrentPath(paneId)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get current path of pane %s: %w", paneId, err)
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return "", fmt.Errorf("empty current path returned for pane %s", paneId)
+	}
+	return strings.TrimSpace(lines[0]), nil
+}
+
+func (c *ControlBackend) SessionName(paneId string) (string, error) {
+	lines, err := c.command("display-message", "-p", "-t", paneId, "#{session_name}")
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.SessionName(paneId)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get the session of pane %s: %w", paneId, err)
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no session returned for pane %s", paneId)
+	}
+	return strings.TrimSpace(lines[0]), nil
+}
+
+func (c *ControlBackend) SendKeys(paneId string, keys string, enter bool) error {
+	for i, args := range sendKeysArgs(paneId, keys, enter) {
+		_, err := c.command(args...)
+		if errors.Is(err, errControlClosed) && i == 0 {
+			return ExecBackend{}.SendKeys(paneId, keys, enter)
+		}
+		if err != nil {
+			logger.Error("Failed to send keys %v to pane %s: %v", args[3:], paneId, err)
+			return fmt.Errorf("failed to send command to pane: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *ControlBackend) SplitPane(target string) (string, error) {
+	lines, err := c.command("split-window", "-d", "-h", "-t", target, "-P", "-F", "#{pane_id}")
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.SplitPane(target)
+	}
+	if err != nil {
+		logger.Error("Failed to create tmux pane: %v", err)
+		return "", err
+	}
+	c.forgetCaptures()
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no pane id returned")
+	}
+	return strings.TrimSpace(lines[0]), nil
+}
+
+// ClearPane clears a pane like TmuxClearPane: a pane covering it for a moment makes it redraw
+func (c *ControlBackend) ClearPane(paneId string) error {
+	lines, err := c.command("split-window", "-vp", "100", "-t", paneId, "-P", "-F", "#{pane_id}")
+	if errors.Is(err, errControlClosed) {
+		return ExecBackend{}.ClearPane(paneId)
+	}
+	if err != nil || len(lines) == 0 {
+		logger.Error("Failed to split window for pane %s: %v", paneId, err)
+		return fmt.Errorf("failed to clear pane %s: %v", paneId, err)
+	}
+	if _, err := c.command("clear-history", "-t", paneId); err != nil {
+		logger.Error("Failed to clear history for pane %s: %v", paneId, err)
+		return err
+	}
+	if _, err := c.command("kill-pane", "-t", strings.TrimSpace(lines[0])); err != nil {
+		logger.Error("Failed to kill temporary pane: %v", err)
+		return err
+	}
+	c.forgetCaptures()
+	return nil
+}
+
+// controlCommandLine quotes the arguments of a command for the control mode connection
+func controlCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		var b strings.Builder
+		b.WriteByte('"')
+		for _, r := range arg {
+			switch {
+			case r == '"' || r == '\\' || r == '$':
+				b.WriteByte('\\')
+				b.WriteRune(r)
+			case r < ' ' || r == 0x7f:
+				fmt.Fprintf(&b, "\\%03o", r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		b.WriteByte('"')
+		quoted[i] = b.String()
+	}
+	return strings.Join(quoted, " ")
+}
+
+// controlEvent is the reply to a command or a notification of tmux control mode
+type controlEvent struct {
+	name  string   // notification name without %, like output, empty for replies
+	args  string   // the rest of the notification line
+	ours  bool     // a reply to a command of this client
+	err   bool     // the command failed
+	lines []string // output of the command
+}
+
+// controlParser splits the output of tmux control mode into events
+type controlParser struct {
+	inReply bool
+	number  string // command number of the reply being read
+	ours    bool
+	lines   []string
+}
+
+// parse handles a line of control mode output, it returns an event when one is complete.
+// Replies are the lines between %begin and %end or %error guards with the same command number.
+func (p *controlParser) parse(line string) (controlEvent, bool) {
+	if p.inReply {
+		guard, rest, _ := strings.Cut(line, " ")
+		if (guard == "%end" || guard == "%error") && controlGuardNumber(rest) == p.number {
+			event := controlEvent{ours: p.ours, err: guard == "%error", lines: p.lines}
+			*p = controlParser{}
+			return event, true
+		}
+		p.lines = append(p.lines, line)
+		return controlEvent{}, false
+	}
+
+	if !strings.HasPrefix(line, "%") {
+		return controlEvent{}, false
+	}
+	name, args, _ := strings.Cut(line[1:], " ")
+	if name == "begin" {
+		// %begin time number flags, flag 1 marks commands of this client
+		fields := strings.Fields(args)
+		*p = controlParser{inReply: true, number: controlGuardNumber(args)}
+		p.ours = len(fields) == 3 && fields[2] == "1"
+		return controlEvent{}, false
+	}
+	return controlEvent{name: name, args: args}, true
+}
+
+// controlGuardNumber returns the command number of the arguments of a guard line
+func controlGuardNumber(args string) string {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
@@ -0,0 +1,114 @@
+package system
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlParser(t *testing.T) {
+	input := []string{
+		"%begin 1700000000 263 1",
+		"%0,1,19148,bash,0,2000",
+		"%end 1700000000 263 1",
+		"%begin 1700000000 264 0",
+		"%end 1700000000 264 0",
+		"%session-changed $0 main",
+		"%output %0 echo hi\\015\\012",
+		"%begin 1700000001 265 1",
+		"%end 1700000001 2650 1",
+		"%end 1700000001 265 1",
+		"%begin 1700000001 266 1",
+		"parse error: unknown command: bogus",
+		"%error 1700000001 266 1",
+		"%exit",
+	}
+	want := []controlEvent{
+		{ours: true, lines: []string{"%0,1,19148,bash,0,2000"}},
+		{}, // the reply to attach-session, not a command of this client
+		{name: "session-changed", args: "$0 main"},
+		{name: "output", args: "%0 echo hi\\015\\012"},
+		{ours: true, lines: []string{"%end 1700000001 2650 1"}},
+		{ours: true, err: true, lines: []string{"parse error: unknown command: bogus"}},
+		{name: "exit"},
+	}
+
+	var parser controlParser
+	var got []controlEvent
+	for _, line := range input {
+		if event, ok := parser.parse(line); ok {
+			got = append(got, event)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestControlCommandLine(t *testing.T) {
+	got := controlCommandLine([]string{"send-keys", "-t", "%1", "-l", `echo "$HOME" \ done;` + "\t"})
+	want := `"send-keys" "-t" "%1" "-l" "echo \"\$HOME\" \\ done;\011"`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestControlBackend(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Setenv("TMUX", "")
+	out, err := exec.Command("tmux", "new-session", "-d", "-x", "80", "-y", "24", "-P", "-F", "#{pane_id}", "sh").Output()
+	if err != nil {
+		t.Skipf("can't start a tmux server: %v", err)
+	}
+	defer exec.Command("tmux", "kill-server").Run()
+	paneId := strings.TrimSpace(string(out))
+
+	c, err := NewControlBackend(paneId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	panes, err := c.ListPanes(paneId)
+	if err != nil || len(panes) != 1 || panes[0].Id != paneId {
+		t.Fatalf("ListPanes = %+v, %v", panes, err)
+	}
+
+	if _, err := c.CapturePane(paneId, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendKeys(paneId, `echo "a;b" $((40+2));`, true); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	var content string
+	for !strings.Contains(content, "a;b 42") && time.Now().Before(deadline) {
+		c.WaitForOutput(paneId, 500*time.Millisecond)
+		content, _ = c.CapturePane(paneId, 10)
+	}
+	if !strings.Contains(content, "a;b 42") {
+		t.Fatalf("command output missing in the pane:\n%s", content)
+	}
+
+	// once the prompt is back the pane is idle and the capture is reused
+	for i := 0; i < 10 && c.WaitForOutput(paneId, 200*time.Millisecond); i++ {
+		content, _ = c.CapturePane(paneId, 10)
+	}
+	if c.WaitForOutput(paneId, 100*time.Millisecond) {
+		t.Error("WaitForOutput reported output of an idle pane")
+	}
+	if again, _ := c.CapturePane(paneId, 10); again != content {
+		t.Errorf("capture changed without output:\n%s", again)
+	}
+
+	// commands run the tmux binary once the connection is closed
+	c.Close()
+	if content, err := c.CapturePane(paneId, 10); err != nil || !strings.Contains(content, "a;b 42") {
+		t.Errorf("capture after Close = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,313 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fakeWindowTarget is the only window of FakeTmux
+const fakeWindowTarget = "$0:0"
+
+// FakeTmux is an in-memory TmuxBackend for tests. Its panes run a scripted shell:
+// a command typed into a pane prints the output configured in Commands, the prompt
+// changes to the prepared format when PrepareExecPane sets PS1.
+type FakeTmux struct {
+	mu       sync.Mutex
+	Commands map[string]FakeCommand // results by command line
+	// Run is called for commands not in Commands when set, with the fake locked
+	Run     func(pane *FakePane, command string) FakeCommand
+	Sent    []FakeKeys // keys sent to panes, in order
+	Session string     // name of the session of all panes, none by default
+	panes   []*FakePane
+	current string
+}
+
+// FakeCommand is the result of a command run in a FakeTmux pane
+type FakeCommand struct {
+	Output  string
+	Code    int
+	Running bool // keeps running until C-c, the prompt doesn't come back
+}
+
+// FakeKeys records a SendKeys call of FakeTmux
+type FakeKeys struct {
+	Pane  string
+	Keys  string
+	Enter bool
+}
+
+// FakePane is a pane of FakeTmux
+type FakePane struct {
+	Id       string
+	Command  string   // current command, usually a shell
+	Cwd      string   // working directory of the shell
+	Lines    []string // history and screen, without the line of the prompt
+	Prepared bool     // the prompt has the format set by PrepareExecPane
+	Code     int      // exit code of the last command
+	Input    string   // typed after the prompt
+	History  []string // command lines entered, in order
+	Running  bool     // a command is running, typed lines wait for it
+}
+
+var _ TmuxBackend = (*FakeTmux)(nil)
+
+// NewFakeTmux creates a fake tmux server with the pane of tmuxai, %0, as the current pane
+func NewFakeTmux() *FakeTmux {
+	f := &FakeTmux{Commands: make(map[string]FakeCommand)}
+	f.current = f.AddPane("tmuxai").Id
+	return f
+}
+
+// AddPane adds a pane running a command, like "bash", in the working directory of the process
+func (f *FakeTmux) AddPane(command string) *FakePane {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addPane(command)
+}
+
+func (f *FakeTmux) addPane(command string) *FakePane {
+	cwd, _ := os.Getwd()
+	p := &FakePane{Id: fmt.Sprintf("%%%d", len(f.panes)), Command: command, Cwd: cwd}
+	f.panes = append(f.panes, p)
+	return p
+}
+
+// Pane returns a pane by id, or nil
+func (f *FakeTmux) Pane(paneId string) *FakePane {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pane(paneId)
+}
+
+func (f *FakeTmux) pane(paneId string) *FakePane {
+	for _, p := range f.panes {
+		if p.Id == paneId {
+			return p
+		}
+	}
+	return nil
+}
+
+func (f *FakeTmux) CurrentPaneId() (string, error) {
+	if f.current == "" {
+		return "", fmt.Errorf("TMUX_PANE environment variable not set")
+	}
+	return f.current, nil
+}
+
+func (f *FakeTmux) WindowTarget(paneId string) (string, error) {
+	if f.Pane(paneId) == nil {
+		return "", fmt.Errorf("can't find pane: %s", paneId)
+	}
+	return fakeWindowTarget, nil
+}
+
+func (f *FakeTmux) ListPanes(target string) ([]TmuxPaneDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var details []TmuxPaneDetails
+	for i, p := range f.panes {
+		if target != fakeWindowTarget && target != p.Id {
+			continue
+		}
+		active := 0
+		if p.Id == f.current {
+			active = 1
+		}
+		details = append(details, TmuxPaneDetails{
+			Id:             p.Id,
+			IsActive:       active,
+			CurrentPid:     1000 + i,
+			CurrentCommand: p.Command,
+			HistorySize:    len(p.Lines),
+			HistoryLimit:   2000,
+			IsSubShell:     IsSubShell(p.Command),
+		})
+	}
+	if len(details) == 0 {
+		return nil, fmt.Errorf("can't find %s", target)
+	}
+	return details, nil
+}
+
+func (f *FakeTmux) CapturePane(paneId string, maxLines int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.pane(paneId)
+	if p == nil {
+		return "", fmt.Errorf("can't find pane: %s", paneId)
+	}
+	lines := p.screen()
+	if maxLines > 0 && len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// CapturePaneAnsi returns the plain content, fake panes have no colours
+func (f *FakeTmux) CapturePaneAnsi(paneId string, maxLines int) (string, error) {
+	return f.CapturePane(paneId, maxLines)
+}
+
+func (f *FakeTmux) CapturePaneHistory(paneId string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.pane(paneId)
+	if p == nil {
+		return "", fmt.Errorf("can't find pane: %s", paneId)
+	}
+	return strings.TrimRight(strings.Join(p.screen(), "\n"), "\n"), nil
+}
+
+func (f *FakeTmux) PaneCurrentPath(paneId string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.pane(paneId)
+	if p == nil {
+		return "", fmt.Errorf("can't find pane: %s", paneId)
+	}
+	return p.Cwd, nil
+}
+
+func (f *FakeTmux) SessionName(paneId string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pane(paneId) == nil {
+		return "", fmt.Errorf("can't find pane: %s", paneId)
+	}
+	return f.Session, nil
+}
+
+// SendKeys types the keys into the pane like TmuxSendCommandToPane: special keys like
+// C-c, C-l and Enter are pressed, other text is typed after the prompt.
+func (f *FakeTmux) SendKeys(paneId string, keys string, enter bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.pane(paneId)
+	if p == nil {
+		return fmt.Errorf("failed to send command to pane: can't find pane: %s", paneId)
+	}
+	f.Sent = append(f.Sent, FakeKeys{Pane: paneId, Keys: keys, Enter: enter})
+
+	for _, args := range sendKeysArgs(paneId, keys, enter) {
+		if args[3] == "-l" {
+			p.Input += args[4]
+			continue
+		}
+		for _, key := range args[3:] {
+			f.pressKey(p, key)
+		}
+	}
+	return nil
+}
+
+func (f *FakeTmux) SplitPane(target string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if target != fakeWindowTarget && f.pane(target) == nil {
+		return "", fmt.Errorf("can't find %s", target)
+	}
+	return f.addPane("bash").Id, nil
+}
+
+func (f *FakeTmux) ClearPane(paneId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.pane(paneId)
+	if p == nil {
+		return fmt.Errorf("can't find pane: %s", paneId)
+	}
+	p.Lines = nil
+	return nil
+}
+
+// pressKey handles a key of send-keys, text that is not a key name is typed
+func (f *FakeTmux) pressKey(p *FakePane, key string) {
+	switch key {
+	case "Enter":
+		f.runInput(p)
+	case "C-c":
+		p.Running = false
+		p.Lines = append(p.Lines, p.prompt()+p.Input+"^C")
+		p.Input = ""
+		p.Code = 130
+	case "C-l":
+		p.Lines = nil
+	case "C-u":
+		p.Input = ""
+	case "Space":
+		p.Input += " "
+	default:
+		if !getSpecialKeys()[key] && !strings.HasPrefix(key, "C-") && !strings.HasPrefix(key, "M-") {
+			p.Input += key
+		}
+	}
+}
+
+// runInput runs the typed command line and prints its output and the next prompt
+func (f *FakeTmux) runInput(p *FakePane) {
+	command := strings.TrimSpace(p.Input)
+	if p.Running {
+		p.Lines = append(p.Lines, p.Input)
+		p.Input = ""
+		return
+	}
+	p.Lines = append(p.Lines, p.prompt()+p.Input)
+	p.Input = ""
+	if command == "" {
+		return
+	}
+	p.History = append(p.History, command)
+
+	var result FakeCommand
+	name, arg, _ := strings.Cut(command, " ")
+	switch {
+	case strings.HasPrefix(command, "export PS1=") || strings.HasPrefix(command, "export PROMPT=") ||
+		strings.HasPrefix(command, "function fish_prompt"):
+		p.Prepared = true
+	case command == "clear":
+		p.Lines = nil
+	case name == "cd":
+		dir := strings.TrimSpace(arg)
+		if dir == "" {
+			dir, _ = os.UserHomeDir()
+		} else if !filepath.IsAbs(dir) {
+			dir = filepath.Join(p.Cwd, dir)
+		}
+		p.Cwd = dir
+	default:
+		var ok bool
+		if result, ok = f.Commands[command]; !ok {
+			if f.Run != nil {
+				result = f.Run(p, command)
+			} else {
+				result = FakeCommand{Output: fmt.Sprintf("%s: %s: command not found", p.Command, name), Code: 127}
+			}
+		}
+	}
+	if result.Output != "" {
+		p.Lines = append(p.Lines, strings.Split(strings.TrimRight(result.Output, "\n"), "\n")...)
+	}
+	p.Code = result.Code
+	p.Running = result.Running
+}
+
+// prompt returns the shell prompt, in the format of PrepareExecPane once the pane is prepared
+func (p *FakePane) prompt() string {
+	if !p.Prepared {
+		return "$ "
+	}
+	return fmt.Sprintf("user@host:%s[12:00][%d]» ", p.Cwd, p.Code)
+}
+
+// screen returns the lines of the pane including the prompt line
+func (p *FakePane) screen() []string {
+	if p.Running {
+		return append(append([]string{}, p.Lines...), p.Input)
+	}
+	return append(append([]string{}, p.Lines...), p.prompt()+p.Input)
+}
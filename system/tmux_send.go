@@ -10,52 +10,46 @@ import (
 )
 
 func TmuxSendCommandToPane(paneId string, command string, autoenter bool) error {
+	for _, args := range sendKeysArgs(paneId, command, autoenter) {
+		// Only replace semicolons at the end of the line, tmux would take them as a command separator
+		if literal := args[len(args)-1]; args[3] == "-l" && strings.HasSuffix(literal, ";") {
+			args[len(args)-1] = literal[:len(literal)-1] + "\\;"
+		}
+		cmd := exec.Command("tmux", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if err != nil {
+			logger.Error("Failed to send keys %v to pane %s: %v, stderr: %s", args[3:], paneId, err, stderr.String())
+			return fmt.Errorf("failed to send command to pane: %w", err)
+		}
+	}
+	return nil
+}
+
+// sendKeysArgs returns the arguments of the tmux send-keys commands that type a command into a pane.
+// Lines without special keys are sent literally, an Enter follows each line with autoenter.
+func sendKeysArgs(paneId string, command string, autoenter bool) [][]string {
+	var commands [][]string
 	lines := strings.Split(command, "\n")
 	for i, line := range lines {
-
 		if line != "" {
 			if !containsSpecialKey(line) {
-				// Only replace semicolons at the end of the line
-				if strings.HasSuffix(line, ";") {
-					line = line[:len(line)-1] + "\\;"
-				}
-				cmd := exec.Command("tmux", "send-keys", "-t", paneId, "-l", line)
-				var stderr bytes.Buffer
-				cmd.Stderr = &stderr
-				err := cmd.Run()
-				if err != nil {
-					logger.Error("Failed to send command to pane %s: %v, stderr: %s", paneId, err, stderr.String())
-					return fmt.Errorf("failed to send command to pane: %w", err)
-				}
-
+				commands = append(commands, []string{"send-keys", "-t", paneId, "-l", line})
 			} else {
 				args := []string{"send-keys", "-t", paneId}
-				processed := processLineWithSpecialKeys(line)
-				args = append(args, processed...)
-				cmd := exec.Command("tmux", args...)
-				var stderr bytes.Buffer
-				cmd.Stderr = &stderr
-				err := cmd.Run()
-				if err != nil {
-					logger.Error("Failed to send command with special keys to pane %s: %v, stderr: %s", paneId, err, stderr.String())
-					return fmt.Errorf("failed to send command with special keys to pane: %w", err)
-				}
+				commands = append(commands, append(args, processLineWithSpecialKeys(line)...))
 			}
 		}
 
 		// Send Enter key after each line except for empty lines at the end
 		if autoenter {
 			if i < len(lines)-1 || (i == len(lines)-1 && line != "") {
-				enterCmd := exec.Command("tmux", "send-keys", "-t", paneId, "Enter")
-				err := enterCmd.Run()
-				if err != nil {
-					logger.Error("Failed to send Enter key to pane %s: %v", paneId, err)
-					return fmt.Errorf("failed to send Enter key to pane: %w", err)
-				}
+				commands = append(commands, []string{"send-keys", "-t", paneId, "Enter"})
 			}
 		}
 	}
-	return nil
+	return commands
 }
 
 // containsSpecialKey checks if a string contains any tmux special key notation
@@ -0,0 +1,175 @@
+package system
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dlclark/regexp2"
+)
+
+// Tokenizer counts the tokens of text the way a model family does
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// bpePatterns split text into pieces before the byte pair merges, by encoding name
+var bpePatterns = map[string]string{
+	"cl100k_base": `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	"o200k_base": strings.Join([]string{
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`\p{N}{1,3}`,
+		` ?[^\s\p{L}\p{N}]+[\r\n/]*`,
+		`\s*[\r\n]+`,
+		`\s+(?!\S)`,
+		`\s+`,
+	}, "|"),
+}
+
+// BPEEncodings returns the names of the encodings LoadBPE knows
+func BPEEncodings() []string {
+	return []string{"cl100k_base", "o200k_base"}
+}
+
+// BPETokenizer is a byte pair encoding tokenizer compatible with tiktoken
+type BPETokenizer struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp2.Regexp
+}
+
+// LoadBPE loads the ranks of an encoding from a .tiktoken file: a base64 token and its rank per line
+func LoadBPE(name string, path string) (*BPETokenizer, error) {
+	expr, ok := bpePatterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %s", name)
+	}
+	pattern, err := regexp2.Compile(expr, regexp2.None)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", name, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected a token and a rank", path, line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("%s: byte %d has no rank", path, b)
+		}
+	}
+	return &BPETokenizer{name: name, ranks: ranks, pattern: pattern}, nil
+}
+
+func (t *BPETokenizer) Name() string {
+	return t.name
+}
+
+// Count returns the number of tokens of text, special tokens are counted as text
+func (t *BPETokenizer) Count(text string) int {
+	count := 0
+	t.pieces(text, func(piece []byte) {
+		if _, ok := t.ranks[string(piece)]; ok {
+			count++
+		} else {
+			count += len(t.merge(piece)) - 1
+		}
+	})
+	return count
+}
+
+// Encode returns the token ranks of text
+func (t *BPETokenizer) Encode(text string) []int {
+	var tokens []int
+	t.pieces(text, func(piece []byte) {
+		if rank, ok := t.ranks[string(piece)]; ok {
+			tokens = append(tokens, rank)
+			return
+		}
+		bounds := t.merge(piece)
+		for i := 0; i < len(bounds)-1; i++ {
+			tokens = append(tokens, t.ranks[string(piece[bounds[i]:bounds[i+1]])])
+		}
+	})
+	return tokens
+}
+
+// pieces calls fn with each piece of the pre-tokenization of text
+func (t *BPETokenizer) pieces(text string, fn func(piece []byte)) {
+	match, err := t.pattern.FindStringMatch(text)
+	for err == nil && match != nil {
+		fn([]byte(match.String()))
+		match, err = t.pattern.FindNextMatch(match)
+	}
+}
+
+// merge merges the bytes of a piece by rank, lowest first, and returns the bounds of the tokens
+func (t *BPETokenizer) merge(piece []byte) []int {
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		minRank, minIndex := math.MaxInt, -1
+		for i := 0; i < len(bounds)-2; i++ {
+			if rank, ok := t.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok && rank < minRank {
+				minRank, minIndex = rank, i
+			}
+		}
+		if minIndex < 0 {
+			break
+		}
+		bounds = append(bounds[:minIndex+1], bounds[minIndex+2:]...)
+	}
+	return bounds
+}
+
+// HeuristicTokenizer estimates token counts without the ranks of an encoding
+type HeuristicTokenizer struct{}
+
+func (HeuristicTokenizer) Name() string {
+	return "heuristic"
+}
+
+func (HeuristicTokenizer) Count(text string) int {
+	return EstimateTokenCount(text)
+}
+
+// isCJK reports whether r is written without spaces between words, BPE encodings
+// have about one token per character of these scripts
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai)
+}
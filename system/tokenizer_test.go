@@ -0,0 +1,85 @@
+package system
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeRanks writes a .tiktoken file with every single byte and the given merges
+func writeRanks(t *testing.T, merges ...string) string {
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, merge := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(merge)), 256+i)
+	}
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBPETokenizer(t *testing.T) {
+	path := writeRanks(t, "ab", "cd", "abcd", " abcd")
+	for _, encoding := range BPEEncodings() {
+		bpe, err := LoadBPE(encoding, path)
+		if err != nil {
+			t.Fatalf("LoadBPE(%s): %v", encoding, err)
+		}
+		tests := []struct {
+			text string
+			want []int
+		}{
+			{"abcd", []int{258}},
+			{"abce", []int{256, 'c', 'e'}},
+			{" abcd abce", []int{259, ' ', 256, 'c', 'e'}},
+			{"12345", []int{'1', '2', '3', '4', '5'}},
+			{"", nil},
+		}
+		for _, tt := range tests {
+			got := bpe.Encode(tt.text)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s: Encode(%q) = %v, want %v", encoding, tt.text, got, tt.want)
+			}
+			if n := bpe.Count(tt.text); n != len(tt.want) {
+				t.Errorf("%s: Count(%q) = %d, want %d", encoding, tt.text, n, len(tt.want))
+			}
+		}
+	}
+}
+
+func TestLoadBPEErrors(t *testing.T) {
+	if _, err := LoadBPE("p50k_base", writeRanks(t)); err == nil {
+		t.Error("unknown encoding loaded")
+	}
+	path := filepath.Join(t.TempDir(), "partial.tiktoken")
+	os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString([]byte("a"))+" 0\n"), 0644)
+	if _, err := LoadBPE("cl100k_base", path); err == nil || !strings.Contains(err.Error(), "no rank") {
+		t.Errorf("missing bytes: %v", err)
+	}
+}
+
+func TestEstimateTokenCount(t *testing.T) {
+	tests := []struct {
+		text     string
+		min, max int
+	}{
+		{"", 0, 0},
+		{"hello world", 2, 2},
+		{"你好世界", 4, 4},
+		{"if err != nil {\n\treturn err\n}", 8, 14},
+		{"The quick brown fox jumps over the lazy dog.", 9, 12},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokenCount(tt.text); got < tt.min || got > tt.max {
+			t.Errorf("EstimateTokenCount(%q) = %d, want %d to %d", tt.text, got, tt.min, tt.max)
+		}
+	}
+}
@@ -21,6 +21,7 @@ type TmuxPaneDetails struct {
 	IsSubShell         bool
 	HistorySize        int
 	HistoryLimit       int
+	CaptureMode        string
 }
 
 func (p *TmuxPaneDetails) String() string {
@@ -98,11 +99,41 @@ func (p *TmuxPaneDetails) FormatInfo(f *InfoFormatter) string {
 }
 
 func (p *TmuxPaneDetails) Refresh(maxLines int) {
-	content, _ := TmuxCapturePane(p.Id, maxLines)
+	p.RefreshWith(ExecBackend{}, maxLines)
+}
+
+// RefreshWith captures the pane content from a tmux backend
+func (p *TmuxPaneDetails) RefreshWith(backend TmuxBackend, maxLines int) {
+	content, _ := backend.CapturePane(p.Id, maxLines)
 	p.Content = content
+	p.CaptureMode = CaptureModePlain
 	p.LastLine = strings.TrimSpace(strings.Split(p.Content, "\n")[len(strings.Split(p.Content, "\n"))-1])
 	p.IsPrepared = strings.HasSuffix(p.LastLine, "»")
 	if IsShellCommand(p.CurrentCommand) {
 		p.Shell = p.CurrentCommand
 	}
 }
+
+// RefreshAnnotated captures the pane with escape sequences and stores the annotated content.
+// LastLine is still computed from the plain text so prompt detection keeps working.
+func (p *TmuxPaneDetails) RefreshAnnotated(maxLines int) {
+	p.RefreshAnnotatedWith(ExecBackend{}, maxLines)
+}
+
+// RefreshAnnotatedWith is RefreshAnnotated with a tmux backend
+func (p *TmuxPaneDetails) RefreshAnnotatedWith(backend TmuxBackend, maxLines int) {
+	raw, err := backend.CapturePaneAnsi(p.Id, maxLines)
+	if err != nil {
+		p.RefreshWith(backend, maxLines)
+		return
+	}
+	plain := strings.TrimSpace(StripAnsi(raw))
+	lines := strings.Split(plain, "\n")
+	p.Content = AnnotateAnsiCapture(raw)
+	p.CaptureMode = CaptureModeAnsi
+	p.LastLine = strings.TrimSpace(lines[len(lines)-1])
+	p.IsPrepared = strings.HasSuffix(p.LastLine, "»")
+	if IsShellCommand(p.CurrentCommand) {
+		p.Shell = p.CurrentCommand
+	}
+}
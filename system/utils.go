@@ -247,25 +247,63 @@ func PrintMapAsYAML(m map[string]interface{}, indent int) {
 	printNode(root, indent)
 }
 
-// EstimateTokenCount provides a rough estimation of token count for LLM context
-// This is an approximation and not exact for all models
+// EstimateTokenCount estimates the tokens of text for BPE encodings like cl100k_base,
+// it's used when the ranks of the model's encoding are not available.
+// Words of latin letters are a token per up to 6 letters, other letters a token per 3,
+// characters of CJK scripts a token each, numbers a token per 3 digits, symbols a token
+// per 2 and runs of whitespace, except a single space before a word, a token.
 func EstimateTokenCount(text string) int {
-	// Simple approximation:
-	// 1. Split by whitespace for words
-	words := strings.Fields(text)
-	wordCount := len(words)
-
-	// 2. Count punctuation and special characters which might be separate tokens
-	punctCount := 0
+	tokens := 0
+	var letters, others, digits, symbols, spaces int
+	spaceOnly := true // the whitespace run is only spaces
+	endSpaces := func() {
+		if spaces > 1 || spaces == 1 && !spaceOnly {
+			tokens++
+		}
+		spaces, spaceOnly = 0, true
+	}
+	flush := func() {
+		if letters+others > 0 {
+			tokens += max(1, (letters+5)/6+(others+2)/3)
+		}
+		tokens += (digits+2)/3 + (symbols+1)/2
+		letters, others, digits, symbols = 0, 0, 0, 0
+	}
 	for _, r := range text {
-		if unicode.IsPunct(r) || !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsSpace(r) {
-			punctCount++
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+			spaces++
+			spaceOnly = spaceOnly && r == ' '
+			continue
+		case isCJK(r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsMark(r):
+			if digits+symbols > 0 {
+				flush()
+			}
+			if r < unicode.MaxASCII {
+				letters++
+			} else {
+				others++
+			}
+		case unicode.IsNumber(r):
+			if letters+others+symbols > 0 {
+				flush()
+			}
+			digits++
+		default:
+			if letters+others+digits > 0 {
+				flush()
+			}
+			symbols++
 		}
+		endSpaces()
 	}
-
-	// 3. Estimate: most words are 1 token, some longer words might be multiple tokens
-	// Typical ratio is ~0.75 tokens per word for English text + punctuation as separate tokens
-	estimatedTokens := int(float64(wordCount)*1.3) + punctCount
-
-	return estimatedTokens
+	flush()
+	if spaces > 0 {
+		tokens++
+	}
+	return tokens
 }